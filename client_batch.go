@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"fmt"
+)
+
+// Batch collects calls which are sent to SPDK back to back, without
+// waiting for a response before sending the next call, to save a
+// round-trip per call when creating many objects. SPDK does not support
+// JSON-RPC batch arrays, but executes the calls of a connection in order.
+// Over HTTP, the calls are posted one after the other.
+//
+//	var name0, name1 string
+//	err := client.Batch().
+//		Add("bdev_malloc_create", BdevMallocCreateArgs{...}, &name0).
+//		Add("bdev_malloc_create", BdevMallocCreateArgs{...}, &name1).
+//		Do(ctx)
+type Batch struct {
+	client  *Client
+	entries []batchEntry
+}
+
+type batchEntry struct {
+	method string
+	args   interface{}
+	reply  interface{}
+}
+
+// BatchError is returned by Batch.Do when some of the calls failed.
+type BatchError struct {
+	// Methods and Errors have one entry per call, in the order in
+	// which the calls were added. Errors are nil for successful calls.
+	Methods []string
+	Errors  []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	first := -1
+	for i, err := range e.Errors {
+		if err != nil {
+			failed++
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	return fmt.Sprintf("%d of %d batched calls failed, first %s: %s",
+		failed, len(e.Errors), e.Methods[first], e.Errors[first])
+}
+
+// Unwrap makes errors.Is and errors.As match the error of any call.
+func (e *BatchError) Unwrap() []error {
+	errs := []error{}
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Batch starts a new batch of calls.
+func (c *Client) Batch() *Batch {
+	return &Batch{client: c}
+}
+
+// Add appends a call. Like for Invoke, the result gets decoded into
+// reply, which may be nil.
+func (b *Batch) Add(method string, args, reply interface{}) *Batch {
+	b.entries = append(b.entries, batchEntry{method: method, args: args, reply: reply})
+	return b
+}
+
+// Len returns the number of calls in the batch.
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
+
+// Do sends all calls and waits for their responses. It returns a
+// *BatchError if SPDK reported an error for some of the calls, other
+// errors mean that the state of all calls is unknown. An empty batch
+// is not sent at all.
+func (b *Batch) Do(ctx context.Context, options ...CallOption) error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	for _, entry := range b.entries {
+		if err := b.client.checkMethod(entry.method); err != nil {
+			return err
+		}
+	}
+
+	opts, ctx, cancel := newCallOpts(ctx, options)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reqs := make([]*clientRequest, len(b.entries))
+	for i, entry := range b.entries {
+		reqs[i] = newClientRequest(entry.method, entry.args)
+	}
+	resps, err := b.client.transport.roundTripBatch(ctx, reqs, opts)
+	if err != nil {
+		return err
+	}
+
+	batchErr := &BatchError{
+		Methods: make([]string, len(b.entries)),
+		Errors:  make([]error, len(b.entries)),
+	}
+	failed := false
+	for i, entry := range b.entries {
+		batchErr.Methods[i] = entry.method
+		if err := resps[i].decode(entry.reply); err != nil {
+			batchErr.Errors[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return batchErr
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Capabilities describes what the connected SPDK application supports.
+type Capabilities struct {
+	Version SpdkGetVersionResponse
+	methods map[string]bool
+}
+
+// Supports checks whether SPDK knows the method, regardless of
+// whether it is allowed in the current state.
+func (c *Capabilities) Supports(method string) bool {
+	return c.methods[method]
+}
+
+// Methods returns the sorted names of all supported methods,
+// including deprecated aliases if SPDK lists them.
+func (c *Capabilities) Methods() []string {
+	methods := make([]string, 0, len(c.methods))
+	for method := range c.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// UnsupportedMethodError is returned without contacting SPDK for calls
+// of methods which are not listed in the Capabilities of the client.
+// It matches ErrMethodNotFound with errors.Is.
+type UnsupportedMethodError struct {
+	Method  string
+	Version SpdkVersionFields
+}
+
+func (e *UnsupportedMethodError) Error() string {
+	return fmt.Sprintf("method %s unsupported by SPDK %s", e.Method, e.Version)
+}
+
+func (e *UnsupportedMethodError) Unwrap() error {
+	return ErrMethodNotFound
+}
+
+// Capabilities queries SPDK for its version and methods on the first
+// call and then returns the cached result. From then on calls of any
+// method SPDK does not list fail fast with *UnsupportedMethodError. The
+// cache is dropped when a client created with WithReconnect reconnects,
+// as SPDK may have been updated.
+func (c *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	c.capsMutex.Lock()
+	caps := c.caps
+	c.capsMutex.Unlock()
+	if caps != nil {
+		return caps, nil
+	}
+
+	version, err := SpdkGetVersion(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := RpcGetMethods(ctx, c, RpcGetMethodsArgs{IncludeAliases: true})
+	if errors.Is(err, ErrInvalidParams) {
+		// SPDK before v19.10 has no include_aliases.
+		methods, err = RpcGetMethods(ctx, c, RpcGetMethodsArgs{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	caps = &Capabilities{
+		Version: version,
+		methods: make(map[string]bool),
+	}
+	for _, method := range methods {
+		caps.methods[method] = true
+	}
+
+	c.capsMutex.Lock()
+	c.caps = caps
+	c.capsMutex.Unlock()
+	return caps, nil
+}
+
+// checkMethod fails for methods known to be unsupported.
+func (c *Client) checkMethod(method string) error {
+	c.capsMutex.Lock()
+	caps := c.caps
+	c.capsMutex.Unlock()
+	if caps == nil || caps.Supports(method) {
+		return nil
+	}
+	return &UnsupportedMethodError{Method: method, Version: caps.Version.Fields}
+}
+
+func (c *Client) resetCapabilities() {
+	c.capsMutex.Lock()
+	c.caps = nil
+	c.capsMutex.Unlock()
+}
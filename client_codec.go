@@ -8,146 +8,84 @@ package spdkctrl
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/rpc"
-	"sync"
 )
 
-type clientCodec struct {
-	dec *json.Decoder // for reading JSON values
-	enc *json.Encoder // for writing JSON values
-	c   io.Closer
-
-	// temporary work space
-	req  clientRequest
-	resp clientResponse
-
-	// JSON-RPC responses include the request id but not the request method.
-	// Package rpc expects both.
-	// We save the request method in pending when sending a request
-	// and then look it up by request ID when filling out the rpc Response.
-	mutex   sync.Mutex        // protects pending
-	pending map[uint64]string // map request id to method name
-}
-
-// clientRequest represents the payload sent to the server. Compared to
-// net/rpc/json, two changes were made:
-// - add Version (aka jsonrpc)
-// - change Params from list to a single value
-// - Params must be a pointer so that we can use nil to
-//   suppress the creation of the "params" entry (as expected by e.g. get_nbd_disks)
+// clientRequest represents the payload sent to the server.
+// Params is omitted when nil, as expected by e.g. nbd_get_disks.
 type clientRequest struct {
-	Version string       `json:"jsonrpc"`
-	Method  string       `json:"method"`
-	Params  *interface{} `json:"params,omitempty"`
-	ID      uint64       `json:"id"`
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      uint64      `json:"id"`
 }
 
-type clientResponse struct {
-	ID     uint64           `json:"id"`
-	Result *json.RawMessage `json:"result"`
-	Error  interface{}      `json:"error"`
+func newClientRequest(method string, params interface{}) *clientRequest {
+	return &clientRequest{
+		Version: "2.0",
+		Method:  method,
+		Params:  params,
+	}
 }
 
-// newClientCodec returns a new rpc.ClientCodec using JSON-RPC on conn.
-func newClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
-	return &clientCodec{
-		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
-		c:       conn,
-		req:     clientRequest{Version: "2.0"},
-		pending: make(map[uint64]string),
-	}
+type clientResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
 }
 
-func (c *clientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
-	c.mutex.Lock()
-	c.pending[r.Seq] = r.ServiceMethod
-	c.mutex.Unlock()
-	c.req.Method = r.ServiceMethod
-	if param == nil {
-		c.req.Params = nil
-	} else {
-		c.req.Params = &param
-	}
-	c.req.ID = r.Seq
-	return c.enc.Encode(&c.req)
+// errorObject is the error member of a response as sent by SPDK.
+// Pointers are used to detect missing members.
+type errorObject struct {
+	Code    *float64        `json:"code"`
+	Message *string         `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
 
-func (r *clientResponse) reset() {
-	r.ID = 0
-	r.Result = nil
-	r.Error = nil
+// hasError checks for an error member which is present and not null.
+func (r *clientResponse) hasError() bool {
+	return len(r.Error) != 0 && string(r.Error) != "null"
 }
 
-// ReadResponseHeader parses the response from SPDK. Returning
-// an error here is treated as a failed connection, so we can only
-// do that for real connection problems.
-func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
-	c.resp.reset()
-	if err := c.dec.Decode(&c.resp); err != nil {
-		return err
+// err returns the error reported by SPDK, nil if the call succeeded.
+func (r *clientResponse) err() error {
+	if !r.hasError() {
+		return nil
 	}
 
-	c.mutex.Lock()
-	r.ServiceMethod = c.pending[c.resp.ID]
-	delete(c.pending, c.resp.ID)
-	c.mutex.Unlock()
-
-	r.Error = ""
-	r.Seq = c.resp.ID
-	if c.resp.Error != nil || c.resp.Result == nil {
-		// SPDK returns a map[string]interface {}
-		// with "code" and "message" as keys.
-		m, ok := c.resp.Error.(map[string]interface{})
-		if ok {
-			code, haveCode := m["code"]
-			message, haveMessage := m["message"]
-			if !haveCode || !haveMessage {
-				return fmt.Errorf("invalid error %v", c.resp.Error)
-			}
-			var codeVal int
-			switch code.(type) {
-			case int:
-				codeVal = code.(int)
-			case float64:
-				codeVal = int(code.(float64))
-			default:
-				haveCode = false
-			}
-			messageVal, haveMessage := message.(string)
-			if !haveCode || !haveMessage {
-				return fmt.Errorf("invalid error content %v", c.resp.Error)
-			}
-			// It would be nice to return the real error code through
-			// net/rpc, but it only supports simple strings. Therefore
-			// we have to encode the available information as string.
-			r.Error = fmt.Sprintf("code: %d msg: %s", codeVal, messageVal)
-		} else {
-			// The following code is from the original
-			// net/rpc/json: it expects a simple string
-			// as error.
-			x, ok := c.resp.Error.(string)
-			if !ok {
-				return fmt.Errorf("invalid error %v", c.resp.Error)
-			}
-			if x == "" {
-				x = "unspecified error"
-			}
-			r.Error = x
+	var obj errorObject
+	if err := json.Unmarshal(r.Error, &obj); err == nil {
+		// SPDK returns an object with "code" and "message"
+		// and optionally "data".
+		if obj.Code == nil || obj.Message == nil {
+			return fmt.Errorf("invalid error %s", r.Error)
+		}
+		return &JSONRPCError{
+			Code:    int(*obj.Code),
+			Message: *obj.Message,
+			Data:    obj.Data,
 		}
 	}
-	return nil
-}
 
-func (c *clientCodec) ReadResponseBody(x interface{}) error {
-	if x == nil {
-		return nil
+	// Other JSON-RPC servers may report a simple string.
+	var x string
+	if err := json.Unmarshal(r.Error, &x); err != nil {
+		return fmt.Errorf("invalid error %s", r.Error)
 	}
-	return json.Unmarshal(*c.resp.Result, x)
+	if x == "" {
+		x = "unspecified error"
+	}
+	return errors.New(x)
 }
 
-func (c *clientCodec) Close() error {
-	return c.c.Close()
+// decode stores the result in reply, or returns the error reported by SPDK.
+func (r *clientResponse) decode(reply interface{}) error {
+	if err := r.err(); err != nil {
+		return err
+	}
+	if reply == nil || len(r.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Result, reply)
 }
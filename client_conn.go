@@ -0,0 +1,267 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrShutdown is returned for calls on a closed Client.
+var ErrShutdown = errors.New("connection is shut down")
+
+// ErrConnectionLost is returned for calls that were in flight when the
+// connection to SPDK broke. It is unknown whether SPDK executed them.
+// With WithReconnect such calls may be retried once the client is
+// connected again.
+var ErrConnectionLost = errors.New("connection to SPDK lost")
+
+// transport delivers requests to SPDK and returns the matching responses.
+type transport interface {
+	// roundTrip assigns an id to the request, sends it and waits
+	// for the response or for ctx to be done.
+	roundTrip(ctx context.Context, req *clientRequest, opts *callOpts) (*clientResponse, error)
+	// roundTripBatch sends all requests without waiting for responses
+	// in between, SPDK does not support JSON-RPC batch arrays. The
+	// responses are returned in the order of the requests.
+	roundTripBatch(ctx context.Context, reqs []*clientRequest, opts *callOpts) ([]*clientResponse, error)
+	close() error
+}
+
+// pendingCall is a request that was sent and still waits for its response.
+type pendingCall struct {
+	quiet bool
+	done  chan struct{}
+	resp  *clientResponse
+	err   error
+}
+
+// streamConn is a JSON-RPC 2.0 client on top of a stream connection,
+// like the unix socket of a SPDK application. Any number of requests
+// may be in flight at the same time: requests are written as soon as
+// they are issued and a single reader dispatches the responses to the
+// callers by request id. Responses nobody is waiting for anymore are
+// dropped.
+type streamConn struct {
+	conn   io.ReadWriteCloser
+	logger *log.Logger
+
+	writeMutex sync.Mutex // serializes writes of complete messages
+
+	mutex   sync.Mutex // protects the following fields
+	seq     uint64
+	pending map[uint64]*pendingCall
+	err     error // set once the connection is broken or closed
+	closed  bool
+
+	done chan struct{} // closed together with setting err
+}
+
+func newStreamConn(conn io.ReadWriteCloser, logger *log.Logger) *streamConn {
+	s := &streamConn{
+		conn:    conn,
+		logger:  logger,
+		pending: make(map[uint64]*pendingCall),
+		done:    make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+func (s *streamConn) roundTrip(ctx context.Context, req *clientRequest, opts *callOpts) (*clientResponse, error) {
+	resps, err := s.exchange(ctx, []*clientRequest{req}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return resps[0], nil
+}
+
+func (s *streamConn) roundTripBatch(ctx context.Context, reqs []*clientRequest, opts *callOpts) ([]*clientResponse, error) {
+	return s.exchange(ctx, reqs, opts)
+}
+
+// exchange registers the requests as pending, writes them one after
+// the other and waits for all responses.
+func (s *streamConn) exchange(ctx context.Context, reqs []*clientRequest, opts *callOpts) ([]*clientResponse, error) {
+	calls := make([]*pendingCall, len(reqs))
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil, ErrShutdown
+	}
+	if s.err != nil {
+		err := s.err
+		s.mutex.Unlock()
+		return nil, err
+	}
+	for i, req := range reqs {
+		s.seq++
+		req.ID = s.seq
+		calls[i] = &pendingCall{
+			quiet: opts.quiet,
+			done:  make(chan struct{}),
+		}
+		s.pending[req.ID] = calls[i]
+	}
+	s.mutex.Unlock()
+
+	for _, req := range reqs {
+		if err := s.write(req, opts); err != nil {
+			s.forget(reqs)
+			return nil, err
+		}
+	}
+
+	resps := make([]*clientResponse, len(reqs))
+	for i, call := range calls {
+		select {
+		case <-call.done:
+			if call.err != nil {
+				s.forget(reqs)
+				return nil, call.err
+			}
+			resps[i] = call.resp
+		case <-ctx.Done():
+			s.forget(reqs)
+			return nil, ctx.Err()
+		}
+	}
+	return resps, nil
+}
+
+func (s *streamConn) write(msg interface{}, opts *callOpts) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if !opts.quiet {
+		s.logger.Debugf("write: %s", data)
+	}
+	data = append(data, '\n')
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if _, err := s.conn.Write(data); err != nil {
+		s.logger.Errorf("write error: %s", err)
+		// A partial message leaves the stream in an unknown state.
+		err = fmt.Errorf("%w: %v", ErrConnectionLost, err)
+		s.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+// forget removes calls whose caller is no longer waiting.
+func (s *streamConn) forget(reqs []*clientRequest) {
+	s.mutex.Lock()
+	for _, req := range reqs {
+		delete(s.pending, req.ID)
+	}
+	s.mutex.Unlock()
+}
+func (s *streamConn) readLoop() {
+	dec := json.NewDecoder(s.conn)
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			s.readError(err)
+			return
+		}
+
+		var resp clientResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			s.logger.Errorf("invalid response %s: %s", msg, err)
+			s.shutdown(fmt.Errorf("%w: invalid response: %v", ErrConnectionLost, err))
+			s.conn.Close()
+			return
+		}
+		s.dispatch(&resp)
+	}
+}
+
+func (s *streamConn) dispatch(resp *clientResponse) {
+	// Request ids start at 1, a null or missing id decodes as 0. SPDK
+	// sends such an error when it could not parse a request. Which one
+	// is unknown and others may have been applied, so the connection
+	// is given up like on a read error.
+	if resp.ID == 0 && resp.hasError() {
+		s.logger.Errorf("error response without id: %s", resp.Error)
+		s.shutdown(fmt.Errorf("%w: error response without id: %v", ErrConnectionLost, resp.Error))
+		s.conn.Close()
+		return
+	}
+
+	s.mutex.Lock()
+	call, ok := s.pending[resp.ID]
+	delete(s.pending, resp.ID)
+	s.mutex.Unlock()
+
+	if !ok {
+		s.logger.Debugf("dropping response for abandoned request %d", resp.ID)
+		return
+	}
+	if !call.quiet {
+		s.logger.Debugf("read: id %d result %s error %s", resp.ID, resp.Result, resp.Error)
+	}
+	call.resp = resp
+	close(call.done)
+}
+
+func (s *streamConn) readError(err error) {
+	s.mutex.Lock()
+	closed := s.closed
+	s.mutex.Unlock()
+
+	// Filter connection close err
+	if closed || err == io.EOF ||
+		strings.Contains(err.Error(), "use of closed network connection") ||
+		strings.Contains(err.Error(), "connection reset by peer") {
+		s.logger.Debugf("read error: %s", err)
+	} else {
+		s.logger.Errorf("read error: %s", err)
+	}
+	s.shutdown(fmt.Errorf("%w: %v", ErrConnectionLost, err))
+}
+
+// shutdown fails all pending calls with err. Only the first error is kept.
+func (s *streamConn) shutdown(err error) {
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = err
+		close(s.done)
+	}
+	pending := s.pending
+	s.pending = make(map[uint64]*pendingCall)
+	err = s.err
+	s.mutex.Unlock()
+
+	for _, call := range pending {
+		call.err = err
+		close(call.done)
+	}
+}
+
+func (s *streamConn) close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrShutdown
+	}
+	s.closed = true
+	s.mutex.Unlock()
+
+	s.shutdown(ErrShutdown)
+	return s.conn.Close()
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// From SPDK's include/spdk/jsonrpc.h, copied verbatim.
+const (
+	ERROR_PARSE_ERROR      = -32700
+	ERROR_INVALID_REQUEST  = -32600
+	ERROR_METHOD_NOT_FOUND = -32601
+	ERROR_INVALID_PARAMS   = -32602
+	ERROR_INTERNAL_ERROR   = -32603
+
+	ERROR_INVALID_STATE = -1
+)
+
+// JSONRPCError is the error object returned by SPDK for a failed call.
+// Besides the codes defined above, SPDK RPC handlers commonly report
+// a negated errno value as code (e.g. -ENODEV when a bdev does not exist).
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("code: %d msg: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is a *JSONRPCError with the same code,
+// which makes errors.Is(err, ErrExist) and similar checks work.
+func (e *JSONRPCError) Is(target error) bool {
+	t, ok := target.(*JSONRPCError)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code
+}
+
+// Sentinel errors for use with errors.Is. Only the code is compared.
+var (
+	ErrParseError     = &JSONRPCError{Code: ERROR_PARSE_ERROR, Message: "Parse error"}
+	ErrInvalidRequest = &JSONRPCError{Code: ERROR_INVALID_REQUEST, Message: "Invalid request"}
+	ErrMethodNotFound = &JSONRPCError{Code: ERROR_METHOD_NOT_FOUND, Message: "Method not found"}
+	ErrInvalidParams  = &JSONRPCError{Code: ERROR_INVALID_PARAMS, Message: "Invalid parameters"}
+	ErrInternalError  = &JSONRPCError{Code: ERROR_INTERNAL_ERROR, Message: "Internal error"}
+	ErrInvalidState   = &JSONRPCError{Code: ERROR_INVALID_STATE, Message: "Invalid state"}
+
+	// Negated Linux errno values as returned by SPDK. They are spelled
+	// out because the client may run on a different OS than SPDK.
+	ErrNoEntry      = &JSONRPCError{Code: -2, Message: "No such file or directory"}
+	ErrIO           = &JSONRPCError{Code: -5, Message: "Input/output error"}
+	ErrNoMemory     = &JSONRPCError{Code: -12, Message: "Cannot allocate memory"}
+	ErrBusy         = &JSONRPCError{Code: -16, Message: "Device or resource busy"}
+	ErrExist        = &JSONRPCError{Code: -17, Message: "File exists"}
+	ErrNoDevice     = &JSONRPCError{Code: -19, Message: "No such device"}
+	ErrInvalid      = &JSONRPCError{Code: -22, Message: "Invalid argument"}
+	ErrNoSpace      = &JSONRPCError{Code: -28, Message: "No space left on device"}
+	ErrNotSupported = &JSONRPCError{Code: -95, Message: "Operation not supported"}
+	ErrAlready      = &JSONRPCError{Code: -114, Message: "Operation already in progress"}
+)
+
+// IsJSONError checks that the error has the expected error code. Use
+// code == 0 to check for any JSONError.
+func IsJSONError(err error, code int) bool {
+	var jsonErr *JSONRPCError
+	if !errors.As(err, &jsonErr) {
+		return false
+	}
+	return code == 0 || jsonErr.Code == code
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// httpTransport POSTs each request to a JSON-RPC over HTTP bridge like
+// SPDK's scripts/rpc_http_proxy.py, which forwards it to the RPC socket.
+type httpTransport struct {
+	url      string
+	client   *http.Client
+	user     string
+	password string
+	logger   *log.Logger
+
+	mutex  sync.Mutex // protects the following fields
+	seq    uint64
+	closed bool
+}
+
+func isHTTPTarget(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+func newHTTPTransport(target string, opts *clientOpts) (*httpTransport, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in target %q", target)
+	}
+
+	t := &httpTransport{
+		client:   opts.httpClient,
+		user:     opts.user,
+		password: opts.password,
+		logger:   opts.logger,
+	}
+	// Credentials in the URL are used unless given explicitly,
+	// they must not end up in the request line or in log messages.
+	if u.User != nil {
+		if t.user == "" {
+			t.user = u.User.Username()
+			t.password, _ = u.User.Password()
+		}
+		u.User = nil
+	}
+	t.url = u.String()
+	if t.client == nil {
+		// Connect with the same dialer and timeout as for
+		// other targets.
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = opts.dial
+		t.client = &http.Client{Transport: transport}
+	}
+	return t, nil
+}
+
+func (t *httpTransport) roundTrip(ctx context.Context, req *clientRequest, opts *callOpts) (*clientResponse, error) {
+	return t.post(ctx, req, opts)
+}
+
+// roundTripBatch posts the requests one after the other, as the proxy
+// passes them on to SPDK, which does not support batch arrays.
+func (t *httpTransport) roundTripBatch(ctx context.Context, reqs []*clientRequest, opts *callOpts) ([]*clientResponse, error) {
+	resps := make([]*clientResponse, len(reqs))
+	for i, req := range reqs {
+		resp, err := t.post(ctx, req, opts)
+		if err != nil {
+			return nil, err
+		}
+		resps[i] = resp
+	}
+	return resps, nil
+}
+
+// post assigns an id to the request, posts it and returns the response.
+func (t *httpTransport) post(ctx context.Context, req *clientRequest, opts *callOpts) (*clientResponse, error) {
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return nil, ErrShutdown
+	}
+	t.seq++
+	req.ID = t.seq
+	t.mutex.Unlock()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.quiet {
+		t.logger.Debugf("post %s: %s", t.url, data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if t.user != "" {
+		httpReq.SetBasicAuth(t.user, t.password)
+	}
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		t.logger.Errorf("post error: %s", err)
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.quiet {
+		t.logger.Debugf("response %s: %s", httpResp.Status, body)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP request to %s failed: %s", t.url, httpResp.Status)
+	}
+
+	var resp clientResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %w", t.url, err)
+	}
+	// Errors for requests SPDK could not parse have no id.
+	if resp.ID != req.ID && !resp.hasError() {
+		return nil, fmt.Errorf("response for request id %d has id %d", req.ID, resp.ID)
+	}
+	return &resp, nil
+}
+
+func (t *httpTransport) close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return ErrShutdown
+	}
+	t.closed = true
+	t.client.CloseIdleConnections()
+	return nil
+}
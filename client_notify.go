@@ -0,0 +1,174 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultNotificationInterval = time.Second
+	// notificationBatchSize limits each notify_get_notifications call.
+	notificationBatchSize = 100
+)
+
+// WatchNotifications polls SPDK for notifications of the given types,
+// all types if none are given, and delivers them in order on the
+// returned channel. Notifications emitted before the call are skipped.
+// The channel is closed when ctx is done, the client gets closed or
+// SPDK does not support notifications.
+//
+// Notifications can get lost: SPDK only keeps the most recent ones and
+// starts counting from zero again when it is restarted. The watcher
+// notices both and then delivers a Notification with only Gap set,
+// followed by all notifications SPDK still has. Consumers which derive
+// state from notifications, like a cache of bdevs, should resync when
+// they receive a gap.
+//
+// The interval between polls is set with WithNotificationInterval.
+func (c *Client) WatchNotifications(ctx context.Context, types ...string) <-chan Notification {
+	out := make(chan Notification)
+	w := &notificationWatcher{client: c, out: out}
+	if len(types) > 0 {
+		w.types = make(map[string]bool)
+		for _, t := range types {
+			w.types[t] = true
+		}
+	}
+	go w.run(ctx)
+	return out
+}
+
+type notificationWatcher struct {
+	client *Client
+	types  map[string]bool // nil for all types
+	out    chan<- Notification
+
+	started bool
+	// last is the last notification seen, nil if there was none yet.
+	last *Notification
+}
+
+func (w *notificationWatcher) run(ctx context.Context) {
+	defer close(w.out)
+
+	ticker := time.NewTicker(w.client.notificationInterval)
+	defer ticker.Stop()
+	for {
+		err := w.poll(ctx)
+		switch {
+		case ctx.Err() != nil, errors.Is(err, ErrShutdown):
+			return
+		case errors.Is(err, ErrMethodNotFound):
+			w.client.logger.Errorf("SPDK does not support notifications: %s", err)
+			return
+		case err != nil:
+			w.client.logger.Warnf("polling notifications failed: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *notificationWatcher) poll(ctx context.Context) error {
+	if !w.started {
+		notifications, err := w.fetch(ctx, 0)
+		if err != nil {
+			return err
+		}
+		w.started = true
+		w.remember(notifications)
+		return nil
+	}
+	if w.last == nil {
+		notifications, err := w.fetch(ctx, 0)
+		if err != nil {
+			return err
+		}
+		return w.deliver(ctx, notifications)
+	}
+
+	// Fetching from the last notification seen instead of the one after
+	// it tells whether SPDK still has that one.
+	notifications, err := w.fetch(ctx, w.last.ID)
+	if err != nil {
+		return err
+	}
+	if len(notifications) > 0 && notifications[0] == *w.last {
+		return w.deliver(ctx, notifications[1:])
+	}
+
+	if len(notifications) == 0 || notifications[0].ID == w.last.ID {
+		// SPDK was restarted, its notifications start from zero.
+		w.client.logger.Warnf("notifications restarted after id %d", w.last.ID)
+		notifications, err = w.fetch(ctx, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		w.client.logger.Warnf("notifications %d to %d were lost",
+			w.last.ID+1, notifications[0].ID-1)
+	}
+	if err := w.send(ctx, Notification{Gap: true}); err != nil {
+		return err
+	}
+	w.last = nil
+	return w.deliver(ctx, notifications)
+}
+
+// fetch returns all notifications starting with id.
+func (w *notificationWatcher) fetch(ctx context.Context, id uint64) ([]Notification, error) {
+	var all []Notification
+	for {
+		notifications, err := NotifyGetNotifications(ctx, w.client, NotifyGetNotificationsArgs{
+			ID:  id,
+			Max: notificationBatchSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, notifications...)
+		if len(notifications) < notificationBatchSize {
+			return all, nil
+		}
+		id = notifications[len(notifications)-1].ID + 1
+	}
+}
+
+func (w *notificationWatcher) deliver(ctx context.Context, notifications []Notification) error {
+	for _, n := range notifications {
+		if w.types == nil || w.types[n.Type] {
+			if err := w.send(ctx, n); err != nil {
+				return err
+			}
+		}
+		w.remember([]Notification{n})
+	}
+	return nil
+}
+
+func (w *notificationWatcher) remember(notifications []Notification) {
+	if len(notifications) > 0 {
+		last := notifications[len(notifications)-1]
+		w.last = &last
+	}
+}
+
+func (w *notificationWatcher) send(ctx context.Context, n Notification) error {
+	select {
+	case w.out <- n:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
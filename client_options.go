@@ -0,0 +1,187 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DialFunc establishes the connection to a SPDK application.
+// network is "unix", "tcp" or the scheme of a custom target.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+type clientOpts struct {
+	dialer      DialFunc
+	dialTimeout time.Duration
+	logger      *log.Logger
+
+	notificationInterval time.Duration
+
+	// for stream targets
+	reconnect         bool
+	reconnectMinDelay time.Duration
+	reconnectMaxDelay time.Duration
+	connStateHandler  func(ConnState)
+
+	// for http:// and https:// targets
+	httpClient *http.Client
+	user       string
+	password   string
+}
+
+// ClientOption is the argument type for Dial.
+type ClientOption func(*clientOpts)
+
+// WithDialer replaces the default net.Dialer. The dialer is also
+// used for targets with a scheme unknown to Dial, for example
+// "vsock://3:5260" with a dialer that understands "vsock".
+func WithDialer(dialer DialFunc) ClientOption {
+	return func(o *clientOpts) {
+		o.dialer = dialer
+	}
+}
+
+// WithDialTimeout limits the time to establish the connection,
+// in addition to any deadline of the context passed to Dial.
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOpts) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithClientLogger sets the logger for the client.
+func WithClientLogger(logger *log.Logger) ClientOption {
+	return func(o *clientOpts) {
+		o.logger = logger
+	}
+}
+
+// WithClientLogOutput logs all requests and responses to out,
+// like the logFile parameter of NewClient.
+func WithClientLogOutput(out io.Writer) ClientOption {
+	return func(o *clientOpts) {
+		logger := log.New()
+		logger.SetOutput(out)
+		logger.Level = log.DebugLevel
+		o.logger = logger
+	}
+}
+
+// WithNotificationInterval sets the interval between polls of
+// Client.WatchNotifications, one second by default.
+func WithNotificationInterval(interval time.Duration) ClientOption {
+	return func(o *clientOpts) {
+		o.notificationInterval = interval
+	}
+}
+
+// WithReconnect keeps the client usable across restarts of SPDK: when
+// the connection breaks, calls in flight fail with ErrConnectionLost and
+// the target is dialed again, waiting minDelay after the first failed
+// attempt and doubling that up to maxDelay. New calls wait for the
+// connection until their context is done. Zero delays select defaults.
+// Hooks registered with Client.OnReconnect run after each reconnect.
+func WithReconnect(minDelay, maxDelay time.Duration) ClientOption {
+	return func(o *clientOpts) {
+		o.reconnect = true
+		o.reconnectMinDelay = minDelay
+		o.reconnectMaxDelay = maxDelay
+	}
+}
+
+// WithConnStateHandler registers a function which gets called when the
+// state of a client created with WithReconnect changes. It is called
+// from an internal goroutine and must not block.
+func WithConnStateHandler(handler func(ConnState)) ClientOption {
+	return func(o *clientOpts) {
+		o.connStateHandler = handler
+	}
+}
+
+// WithBasicAuth sets the credentials for http:// and https:// targets.
+// Alternatively they can be part of the target URL.
+func WithBasicAuth(user, password string) ClientOption {
+	return func(o *clientOpts) {
+		o.user = user
+		o.password = password
+	}
+}
+
+// WithHTTPClient replaces the default http.Client used for
+// http:// and https:// targets, e.g. to configure TLS.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(o *clientOpts) {
+		o.httpClient = client
+	}
+}
+
+func newClientOpts(options []ClientOption) *clientOpts {
+	opts := &clientOpts{}
+	for _, op := range options {
+		op(opts)
+	}
+	if opts.logger == nil {
+		opts.logger = log.New()
+	}
+	if opts.notificationInterval <= 0 {
+		opts.notificationInterval = defaultNotificationInterval
+	}
+	return opts
+}
+
+// parseTarget splits a Dial target into network and address.
+// A target without scheme is the path of a unix socket.
+func parseTarget(target string) (string, string, error) {
+	if !strings.Contains(target, "://") {
+		return "unix", target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		// unix:///var/tmp/spdk.sock and unix://spdk.sock
+		return "unix", u.Host + u.Path, nil
+	case "tcp", "tcp4", "tcp6":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("missing host in target %q", target)
+		}
+		return u.Scheme, u.Host, nil
+	default:
+		return u.Scheme, u.Host + u.Path, nil
+	}
+}
+
+func (o *clientOpts) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if o.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.dialTimeout)
+		defer cancel()
+	}
+
+	if o.dialer != nil {
+		return o.dialer(ctx, network, address)
+	}
+	switch network {
+	case "unix", "tcp", "tcp4", "tcp6":
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	default:
+		return nil, fmt.Errorf("unsupported network %q without custom dialer", network)
+	}
+}
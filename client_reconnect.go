@@ -0,0 +1,234 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConnState is the state of the connection of a Client
+// created with WithReconnect.
+type ConnState int
+
+const (
+	// ConnStateConnected is entered after the connection
+	// was established again.
+	ConnStateConnected ConnState = iota
+	// ConnStateReconnecting is entered when the connection
+	// broke, calls wait until it is established again.
+	ConnStateReconnecting
+	// ConnStateClosed is entered by Client.Close.
+	ConnStateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnStateConnected:
+		return "connected"
+	case ConnStateReconnecting:
+		return "reconnecting"
+	case ConnStateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultReconnectMinDelay = 100 * time.Millisecond
+	defaultReconnectMaxDelay = 10 * time.Second
+)
+
+// reconnectConn is a streamConn which gets replaced by a new one when
+// the connection breaks, for example because SPDK was restarted. Calls
+// in flight at that time fail with ErrConnectionLost, new calls wait
+// until the connection is available again.
+type reconnectConn struct {
+	dial     func(ctx context.Context) (net.Conn, error)
+	logger   *log.Logger
+	minDelay time.Duration
+	maxDelay time.Duration
+	onState  func(ConnState)
+	// reconnected is called after the connection was established again.
+	reconnected func(ctx context.Context)
+
+	// ctx is cancelled by close and aborts reconnecting.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex  sync.Mutex // protects the following fields
+	conn   *streamConn
+	ready  chan struct{} // closed once conn is set again
+	closed bool
+}
+
+// newReconnectConn starts supervising conn. reconnected is set before,
+// as the connection may break right away.
+func newReconnectConn(conn net.Conn, opts *clientOpts, dial func(ctx context.Context) (net.Conn, error), reconnected func(ctx context.Context)) *reconnectConn {
+	r := &reconnectConn{
+		dial:        dial,
+		logger:      opts.logger,
+		minDelay:    opts.reconnectMinDelay,
+		maxDelay:    opts.reconnectMaxDelay,
+		onState:     opts.connStateHandler,
+		reconnected: reconnected,
+		conn:        newStreamConn(conn, opts.logger),
+		ready:       make(chan struct{}),
+	}
+	if r.minDelay <= 0 {
+		r.minDelay = defaultReconnectMinDelay
+	}
+	if r.maxDelay < r.minDelay {
+		r.maxDelay = defaultReconnectMaxDelay
+		if r.maxDelay < r.minDelay {
+			r.maxDelay = r.minDelay
+		}
+	}
+	close(r.ready)
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	go r.supervise(r.conn)
+	return r
+}
+
+func (r *reconnectConn) roundTrip(ctx context.Context, req *clientRequest, opts *callOpts) (*clientResponse, error) {
+	conn, err := r.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.roundTrip(ctx, req, opts)
+}
+
+func (r *reconnectConn) roundTripBatch(ctx context.Context, reqs []*clientRequest, opts *callOpts) ([]*clientResponse, error) {
+	conn, err := r.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.roundTripBatch(ctx, reqs, opts)
+}
+
+// current waits for the connection to be available.
+func (r *reconnectConn) current(ctx context.Context) (*streamConn, error) {
+	for {
+		r.mutex.Lock()
+		if r.closed {
+			r.mutex.Unlock()
+			return nil, ErrShutdown
+		}
+		conn, ready := r.conn, r.ready
+		r.mutex.Unlock()
+
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-ready:
+		case <-r.ctx.Done():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (r *reconnectConn) supervise(conn *streamConn) {
+	for {
+		select {
+		case <-conn.done:
+		case <-r.ctx.Done():
+			return
+		}
+
+		r.mutex.Lock()
+		if r.closed {
+			r.mutex.Unlock()
+			return
+		}
+		r.conn = nil
+		r.ready = make(chan struct{})
+		r.mutex.Unlock()
+
+		r.logger.Warnf("connection to SPDK lost, reconnecting")
+		r.setState(ConnStateReconnecting)
+
+		conn = r.redial()
+		if conn == nil {
+			return
+		}
+
+		r.mutex.Lock()
+		if r.closed {
+			r.mutex.Unlock()
+			conn.close()
+			return
+		}
+		r.conn = conn
+		close(r.ready)
+		r.mutex.Unlock()
+
+		r.logger.Infof("connection to SPDK established again")
+		r.setState(ConnStateConnected)
+		if r.reconnected != nil {
+			r.reconnected(r.ctx)
+		}
+	}
+}
+
+// redial tries to connect with exponential backoff until it succeeds
+// or the client gets closed, in which case it returns nil.
+func (r *reconnectConn) redial() *streamConn {
+	delay := r.minDelay
+	for {
+		conn, err := r.dial(r.ctx)
+		if err == nil {
+			return newStreamConn(conn, r.logger)
+		}
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		r.logger.Debugf("reconnect failed, retrying in %s: %s", delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return nil
+		}
+		delay *= 2
+		if delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+func (r *reconnectConn) setState(state ConnState) {
+	if r.onState != nil {
+		r.onState(state)
+	}
+}
+
+func (r *reconnectConn) close() error {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return ErrShutdown
+	}
+	r.closed = true
+	conn := r.conn
+	r.mutex.Unlock()
+
+	r.cancel()
+	var err error
+	if conn != nil {
+		err = conn.close()
+	}
+	r.setState(ConnStateClosed)
+	return err
+}
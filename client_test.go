@@ -7,10 +7,23 @@ SPDX-License-Identifier: Apache-2.0
 package spdkctrl_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/dong-liuliu/spdkctrl/spdktest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +58,744 @@ func TestClient(t *testing.T) {
 	err = client.Close()
 	assert.NoError(t, err, "Failed to close SPDK client: %s", err)
 }
+
+// serveOnce accepts a single connection on a temporary unix socket and
+// hands it to serve. It returns the socket path.
+func serveOnce(t *testing.T, serve func(conn net.Conn)) string {
+	sockPath := filepath.Join(t.TempDir(), "spdk.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %s", sockPath, err)
+	}
+	serveListener(t, listener, serve)
+	return sockPath
+}
+
+func serveListener(t *testing.T, listener net.Listener, serve func(conn net.Conn)) {
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+}
+
+type testRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     uint64          `json:"id"`
+}
+
+func TestClientInvokeContext(t *testing.T) {
+	sockPath := serveOnce(t, func(conn net.Conn) {
+		dec := json.NewDecoder(conn)
+		enc := json.NewEncoder(conn)
+
+		// Hold back the response to the first request until the
+		// second one arrives, then answer both.
+		var first, second testRequest
+		if dec.Decode(&first) != nil || dec.Decode(&second) != nil {
+			return
+		}
+		enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": first.ID, "result": "late"})
+		enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": second.ID, "result": "ok"})
+	})
+
+	client, err := spdk.NewClient(sockPath, nil)
+	assert.NoError(t, err, "Failed to connect socket %s: %s", sockPath, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var reply string
+	err = client.Invoke(ctx, "slow_method", nil, &reply)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, reply, "Reply of abandoned call was written")
+
+	err = client.Invoke(context.Background(), "fast_method", nil, &reply)
+	assert.NoError(t, err, "Failed to invoke after abandoned call: %s", err)
+	assert.Equal(t, "ok", reply)
+
+	// Give the late response a chance to be processed.
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, "ok", reply)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = client.Invoke(ctx, "cancelled_method", nil, &reply)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestClientJSONRPCError(t *testing.T) {
+	sockPath := serveOnce(t, func(conn net.Conn) {
+		dec := json.NewDecoder(conn)
+		enc := json.NewEncoder(conn)
+
+		var req testRequest
+		for dec.Decode(&req) == nil {
+			response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			switch req.Method {
+			case "bdev_get_bdevs":
+				response["error"] = map[string]interface{}{
+					"code":    -19,
+					"message": "No such device",
+					"data":    map[string]string{"name": "Malloc9"},
+				}
+			default:
+				response["error"] = map[string]interface{}{
+					"code":    spdk.ERROR_METHOD_NOT_FOUND,
+					"message": "Method not found",
+				}
+			}
+			enc.Encode(response)
+		}
+	})
+
+	client, err := spdk.NewClient(sockPath, nil)
+	assert.NoError(t, err, "Failed to connect socket %s: %s", sockPath, err)
+	defer client.Close()
+
+	_, err = spdk.BdevGetBdevs(context.Background(), client, spdk.BdevGetBdevsArgs{Name: "Malloc9"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+	assert.False(t, errors.Is(err, spdk.ErrExist), "Unexpected match of error %s", err)
+	assert.True(t, spdk.IsJSONError(err, -19), "Unexpected error code in %s", err)
+	assert.True(t, spdk.IsJSONError(err, 0), "Not a JSON error: %s", err)
+
+	var jsonErr *spdk.JSONRPCError
+	if assert.ErrorAs(t, err, &jsonErr) {
+		assert.Equal(t, "No such device", jsonErr.Message)
+		assert.JSONEq(t, `{"name": "Malloc9"}`, string(jsonErr.Data))
+	}
+
+	err = client.Invoke(context.Background(), "no_such_method", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrMethodNotFound)
+	assert.EqualError(t, err, "code: -32601 msg: Method not found")
+	assert.False(t, spdk.IsJSONError(errors.New("code: -32601 msg: x"), 0))
+}
+
+func TestClientPipelining(t *testing.T) {
+	const numCalls = 8
+
+	sockPath := serveOnce(t, func(conn net.Conn) {
+		dec := json.NewDecoder(conn)
+		enc := json.NewEncoder(conn)
+
+		// Collect all requests before answering them in reverse order.
+		requests := []testRequest{}
+		for len(requests) < numCalls {
+			var req testRequest
+			if dec.Decode(&req) != nil {
+				return
+			}
+			requests = append(requests, req)
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			var params spdk.BdevGetBdevsArgs
+			json.Unmarshal(requests[i].Params, &params)
+			enc.Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      requests[i].ID,
+				"result":  []spdk.Bdev{{Name: params.Name}},
+			})
+		}
+	})
+
+	client, err := spdk.NewClient(sockPath, nil)
+	assert.NoError(t, err, "Failed to connect socket %s: %s", sockPath, err)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numCalls; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			response, err := spdk.BdevGetBdevs(context.Background(), client, spdk.BdevGetBdevsArgs{Name: name})
+			if assert.NoError(t, err, "Failed to list bdev %s: %s", name, err) && assert.Len(t, response, 1) {
+				assert.Equal(t, name, response[0].Name)
+			}
+		}(fmt.Sprintf("Malloc%d", i))
+	}
+	wg.Wait()
+
+	assert.NoError(t, client.Close())
+	err = client.Invoke(context.Background(), "bdev_get_bdevs", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrShutdown)
+}
+
+func TestClientCallTimeout(t *testing.T) {
+	sockPath := serveOnce(t, func(conn net.Conn) {
+		// Read requests, never respond.
+		dec := json.NewDecoder(conn)
+		var req testRequest
+		for dec.Decode(&req) == nil {
+		}
+	})
+
+	client, err := spdk.NewClient(sockPath, nil)
+	assert.NoError(t, err, "Failed to connect socket %s: %s", sockPath, err)
+	defer client.Close()
+
+	err = client.Call(context.Background(), "bdev_get_bdevs", nil, nil,
+		spdk.WithCallTimeout(20*time.Millisecond), spdk.WithoutCallLogging())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// echoMethod answers every request with its method name.
+func echoMethod(conn net.Conn) {
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	var req testRequest
+	for dec.Decode(&req) == nil {
+		enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": req.Method})
+	}
+}
+
+func testDialedClient(t *testing.T, client *spdk.Client, err error) {
+	if !assert.NoError(t, err, "Failed to dial: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	var reply string
+	err = client.Invoke(context.Background(), "spdk_get_version", nil, &reply)
+	assert.NoError(t, err, "Failed to invoke: %s", err)
+	assert.Equal(t, "spdk_get_version", reply)
+}
+
+func TestDial(t *testing.T) {
+	sockPath := serveOnce(t, echoMethod)
+	client, err := spdk.Dial(context.Background(), "unix://"+sockPath)
+	testDialedClient(t, client, err)
+
+	sockPath = serveOnce(t, echoMethod)
+	client, err = spdk.Dial(context.Background(), sockPath, spdk.WithClientLogOutput(os.Stdout))
+	testDialedClient(t, client, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on TCP: %s", err)
+	}
+	serveListener(t, listener, echoMethod)
+	client, err = spdk.Dial(context.Background(), "tcp://"+listener.Addr().String())
+	testDialedClient(t, client, err)
+
+	var dialedNetwork, dialedAddress string
+	client, err = spdk.Dial(context.Background(), "pipe://spdk0",
+		spdk.WithDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialedNetwork, dialedAddress = network, address
+			local, remote := net.Pipe()
+			go echoMethod(remote)
+			return local, nil
+		}))
+	testDialedClient(t, client, err)
+	assert.Equal(t, "pipe", dialedNetwork)
+	assert.Equal(t, "spdk0", dialedAddress)
+
+	_, err = spdk.Dial(context.Background(), "pipe://spdk0")
+	assert.Error(t, err, "Unexpected dial without dialer")
+}
+
+func TestDialTimeout(t *testing.T) {
+	_, err := spdk.Dial(context.Background(), "unix:///nonexistent/spdk.sock",
+		spdk.WithDialTimeout(20*time.Millisecond),
+		spdk.WithDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDialHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "spdk" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req testRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if req.Method == "bdev_get_bdevs" {
+			response["result"] = []spdk.Bdev{{Name: "Malloc0"}}
+		} else {
+			response["error"] = map[string]interface{}{"code": spdk.ERROR_METHOD_NOT_FOUND, "message": "Method not found"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client, err := spdk.Dial(context.Background(), server.URL, spdk.WithBasicAuth("spdk", "secret"))
+	if !assert.NoError(t, err, "Failed to dial %s: %s", server.URL, err) {
+		return
+	}
+	response, err := spdk.BdevGetBdevs(context.Background(), client, spdk.BdevGetBdevsArgs{})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	assert.Equal(t, spdk.BdevGetBdevsResponse{{Name: "Malloc0"}}, response)
+
+	err = client.Invoke(context.Background(), "no_such_method", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrMethodNotFound)
+	assert.NoError(t, client.Close())
+	err = client.Invoke(context.Background(), "bdev_get_bdevs", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrShutdown)
+
+	// Credentials as part of the URL.
+	client, err = spdk.Dial(context.Background(), strings.Replace(server.URL, "http://", "http://spdk:secret@", 1))
+	if assert.NoError(t, err, "Failed to dial: %s", err) {
+		_, err = spdk.BdevGetBdevs(context.Background(), client, spdk.BdevGetBdevsArgs{})
+		assert.NoError(t, err, "Failed to list bdevs: %s", err)
+		client.Close()
+	}
+
+	client, err = spdk.Dial(context.Background(), server.URL, spdk.WithBasicAuth("spdk", "wrong"))
+	if assert.NoError(t, err, "Failed to dial: %s", err) {
+		_, err = spdk.BdevGetBdevs(context.Background(), client, spdk.BdevGetBdevsArgs{})
+		assert.ErrorContains(t, err, "401")
+		client.Close()
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "spdk.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %s", sockPath, err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if i == 0 {
+				// The first connection breaks while
+				// a request is in flight.
+				var req testRequest
+				json.NewDecoder(conn).Decode(&req)
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				echoMethod(conn)
+			}()
+		}
+	}()
+
+	states := make(chan spdk.ConnState, 10)
+	client, err := spdk.Dial(context.Background(), sockPath,
+		spdk.WithReconnect(time.Millisecond, 10*time.Millisecond),
+		spdk.WithConnStateHandler(func(state spdk.ConnState) { states <- state }))
+	if !assert.NoError(t, err, "Failed to dial %s: %s", sockPath, err) {
+		return
+	}
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnect(func(ctx context.Context) error {
+		var reply string
+		err := client.Invoke(ctx, "notify_get_types", nil, &reply)
+		reconnected <- struct{}{}
+		return err
+	})
+
+	err = client.Invoke(context.Background(), "bdev_get_bdevs", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrConnectionLost)
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for reconnect")
+	}
+	assert.Equal(t, spdk.ConnStateReconnecting, <-states)
+	assert.Equal(t, spdk.ConnStateConnected, <-states)
+
+	var reply string
+	err = client.Invoke(context.Background(), "bdev_get_bdevs", nil, &reply)
+	assert.NoError(t, err, "Failed to invoke after reconnect: %s", err)
+	assert.Equal(t, "bdev_get_bdevs", reply)
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, spdk.ConnStateClosed, <-states)
+	err = client.Invoke(context.Background(), "bdev_get_bdevs", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrShutdown)
+}
+
+func TestClientReconnectAfterDial(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "spdk.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %s", sockPath, err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if i == 0 {
+				// The first connection breaks right away, while
+				// Dial may still be setting up the client.
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				echoMethod(conn)
+			}()
+		}
+	}()
+
+	states := make(chan spdk.ConnState, 10)
+	client, err := spdk.Dial(context.Background(), sockPath,
+		spdk.WithReconnect(time.Millisecond, 10*time.Millisecond),
+		spdk.WithConnStateHandler(func(state spdk.ConnState) { states <- state }))
+	if !assert.NoError(t, err, "Failed to dial %s: %s", sockPath, err) {
+		return
+	}
+	defer client.Close()
+
+	for _, want := range []spdk.ConnState{spdk.ConnStateReconnecting, spdk.ConnStateConnected} {
+		select {
+		case state := <-states:
+			assert.Equal(t, want, state)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for state %s", want)
+		}
+	}
+
+	var reply string
+	err = client.Invoke(context.Background(), "bdev_get_bdevs", nil, &reply)
+	assert.NoError(t, err, "Failed to invoke after reconnect: %s", err)
+	assert.Equal(t, "bdev_get_bdevs", reply)
+}
+
+func TestClientBatch(t *testing.T) {
+	ctx := context.Background()
+	server := spdktest.Run(t)
+	client, err := spdk.NewClient(server.SocketPath(), nil)
+	if !assert.NoError(t, err, "Failed to connect fake SPDK: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	assert.NoError(t, client.Batch().Do(ctx), "Failed to send empty batch")
+
+	names := make([]string, 10)
+	batch := client.Batch()
+	for i := range names {
+		batch.Add("bdev_malloc_create", spdk.BdevMallocCreateArgs{
+			Name:      fmt.Sprintf("Malloc%d", i),
+			NumBlocks: 1024,
+			BlockSize: 4096,
+		}, &names[i])
+	}
+	assert.Equal(t, 10, batch.Len())
+	err = batch.Do(ctx)
+	assert.NoError(t, err, "Failed to create malloc bdevs: %s", err)
+	for i, name := range names {
+		assert.Equal(t, fmt.Sprintf("Malloc%d", i), name)
+	}
+
+	var bdevs spdk.BdevGetBdevsResponse
+	var deleted bool
+	err = client.Batch().
+		Add("bdev_malloc_create", spdk.BdevMallocCreateArgs{Name: "Malloc3", NumBlocks: 1024, BlockSize: 4096}, nil).
+		Add("bdev_malloc_delete", spdk.BdevMallocDeleteArgs{Name: "Malloc9"}, &deleted).
+		Add("bdev_get_bdevs", nil, &bdevs).
+		Do(ctx)
+	assert.ErrorIs(t, err, spdk.ErrExist)
+	var batchErr *spdk.BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.ErrorIs(t, batchErr.Errors[0], spdk.ErrExist)
+		assert.Equal(t, "bdev_malloc_create", batchErr.Methods[0])
+		assert.NoError(t, batchErr.Errors[1])
+		assert.NoError(t, batchErr.Errors[2])
+	}
+	assert.True(t, deleted)
+	assert.Len(t, bdevs, 9)
+}
+
+func TestClientBatchHTTP(t *testing.T) {
+	// The proxy passes requests on to SPDK, which rejects arrays.
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req testRequest
+		if json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		methods = append(methods, req.Method)
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": req.Method})
+	}))
+	defer server.Close()
+
+	client, err := spdk.Dial(context.Background(), server.URL)
+	if !assert.NoError(t, err, "Failed to dial %s: %s", server.URL, err) {
+		return
+	}
+	defer client.Close()
+
+	var first, second string
+	err = client.Batch().
+		Add("bdev_get_bdevs", nil, &first).
+		Add("nbd_get_disks", nil, &second).
+		Do(context.Background())
+	assert.NoError(t, err, "Failed to send batch: %s", err)
+	assert.Equal(t, "bdev_get_bdevs", first)
+	assert.Equal(t, "nbd_get_disks", second)
+	assert.Equal(t, []string{"bdev_get_bdevs", "nbd_get_disks"}, methods)
+}
+
+func TestClientErrorWithoutID(t *testing.T) {
+	sockPath := serveOnce(t, func(conn net.Conn) {
+		dec := json.NewDecoder(conn)
+		enc := json.NewEncoder(conn)
+
+		// SPDK answers requests it cannot parse with a null id.
+		var first, second testRequest
+		if dec.Decode(&first) != nil || dec.Decode(&second) != nil {
+			return
+		}
+		enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": nil,
+			"error": map[string]interface{}{"code": spdk.ERROR_INVALID_REQUEST, "message": "Invalid Request"}})
+		echoMethod(conn)
+	})
+	client, err := spdk.NewClient(sockPath, nil)
+	if !assert.NoError(t, err, "Failed to connect: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = client.Batch().
+		Add("bdev_get_bdevs", nil, nil).
+		Add("nbd_get_disks", nil, nil).
+		Do(ctx)
+	// It is unknown which call failed, so the outcome of all of them
+	// is unknown, as if the connection broke.
+	assert.ErrorIs(t, err, spdk.ErrConnectionLost)
+	assert.NotErrorIs(t, err, spdk.ErrInvalidRequest)
+	assert.NotErrorIs(t, err, context.DeadlineExceeded)
+
+	var reply string
+	err = client.Invoke(ctx, "bdev_get_bdevs", nil, &reply)
+	assert.ErrorIs(t, err, spdk.ErrConnectionLost)
+}
+
+// lockedBuffer is a bytes.Buffer the client may log to
+// while the test reads it.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestClientSecretsNotLogged(t *testing.T) {
+	ctx := context.Background()
+	server := spdktest.Run(t)
+	var out lockedBuffer
+	client, err := spdk.Dial(ctx, server.SocketPath(), spdk.WithClientLogOutput(&out))
+	if !assert.NoError(t, err, "Failed to connect fake SPDK: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	_, err = spdk.IscsiCreateAuthGroup(ctx, client, spdk.IscsiCreateAuthGroupArgs{
+		Tag: 1, Secrets: []spdk.IscsiChapSecret{{User: "user1", Secret: "create-secret"}}})
+	assert.NoError(t, err, "Failed to create auth group: %s", err)
+	_, err = spdk.IscsiAuthGroupAddSecret(ctx, client, spdk.IscsiAuthGroupAddSecretArgs{
+		Tag: 1, User: "user2", Secret: "add-secret", Muser: "muser2", Msecret: "mutual-secret"})
+	assert.NoError(t, err, "Failed to add secret: %s", err)
+	groups, err := spdk.IscsiGetAuthGroups(ctx, client)
+	assert.NoError(t, err, "Failed to get auth groups: %s", err)
+	assert.Len(t, groups, 1)
+	_, err = spdk.IscsiDeleteAuthGroup(ctx, client, spdk.IscsiDeleteAuthGroupArgs{Tag: 1})
+	assert.NoError(t, err, "Failed to delete auth group: %s", err)
+
+	log := out.String()
+	assert.Contains(t, log, "iscsi_delete_auth_group")
+	for _, secret := range []string{"create-secret", "add-secret", "mutual-secret"} {
+		assert.NotContains(t, log, secret)
+	}
+}
+
+func TestClientInvokeRaw(t *testing.T) {
+	ctx := context.Background()
+	server := spdktest.Run(t)
+	client, err := spdk.NewClient(server.SocketPath(), nil)
+	if !assert.NoError(t, err, "Failed to connect fake SPDK: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	result, err := client.InvokeRaw(ctx, "bdev_malloc_create",
+		json.RawMessage(`{"name": "Malloc0", "num_blocks": 1024, "block_size": 512}`))
+	assert.NoError(t, err, "Failed to create malloc bdev: %s", err)
+	assert.JSONEq(t, `"Malloc0"`, string(result))
+
+	result, err = client.InvokeRaw(ctx, "bdev_get_bdevs", nil)
+	assert.NoError(t, err, "Failed to get bdevs: %s", err)
+	var bdevs spdk.BdevGetBdevsResponse
+	assert.NoError(t, json.Unmarshal(result, &bdevs))
+	assert.Len(t, bdevs, 1)
+
+	_, err = client.InvokeRaw(ctx, "bdev_malloc_create",
+		json.RawMessage(`{"name": "Malloc0", "num_blocks": 1024, "block_size": 512}`))
+	assert.ErrorIs(t, err, spdk.ErrExist)
+	_, err = client.InvokeRaw(ctx, "no_such_method", nil)
+	assert.ErrorIs(t, err, spdk.ErrMethodNotFound)
+
+	value, err := client.InvokeMap(ctx, "bdev_get_bdevs", map[string]interface{}{"name": "Malloc0"})
+	assert.NoError(t, err, "Failed to get bdev: %s", err)
+	if list, ok := value.([]interface{}); assert.True(t, ok, "unexpected result %v", value) && assert.Len(t, list, 1) {
+		bdev := list[0].(map[string]interface{})
+		assert.Equal(t, "Malloc0", bdev["name"])
+		assert.Equal(t, float64(512), bdev["block_size"])
+	}
+
+	value, err = client.InvokeMap(ctx, "bdev_malloc_delete", map[string]interface{}{"name": "Malloc0"})
+	assert.NoError(t, err, "Failed to delete bdev: %s", err)
+	assert.Equal(t, true, value)
+	_, err = client.InvokeMap(ctx, "bdev_malloc_delete", map[string]interface{}{"name": "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+}
+
+func TestWatchNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := spdktest.Run(t)
+	sockPath := server.SocketPath()
+	connected := make(chan struct{}, 1)
+	client, err := spdk.Dial(ctx, sockPath,
+		spdk.WithNotificationInterval(10*time.Millisecond),
+		spdk.WithReconnect(10*time.Millisecond, 100*time.Millisecond),
+		spdk.WithConnStateHandler(func(state spdk.ConnState) {
+			if state == spdk.ConnStateConnected {
+				connected <- struct{}{}
+			}
+		}))
+	if !assert.NoError(t, err, "Failed to connect fake SPDK: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	createMalloc := func(name string) {
+		_, err := spdk.BdevMallocCreate(ctx, client, spdk.BdevMallocCreateArgs{Name: name, NumBlocks: 1024, BlockSize: 512})
+		assert.NoError(t, err, "Failed to create %s: %s", name, err)
+	}
+	next := func(notifications <-chan spdk.Notification) spdk.Notification {
+		select {
+		case n := <-notifications:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for notification")
+			return spdk.Notification{}
+		}
+	}
+
+	// Notifications from before the watch started are skipped.
+	createMalloc("Malloc0")
+	notifications := client.WatchNotifications(ctx, spdk.NotificationBdevRegister)
+	time.Sleep(50 * time.Millisecond)
+
+	createMalloc("Malloc1")
+	assert.Equal(t, spdk.Notification{Type: spdk.NotificationBdevRegister, Ctx: "Malloc1", ID: 1}, next(notifications))
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc1"})
+	assert.NoError(t, err, "Failed to delete Malloc1: %s", err)
+	createMalloc("Malloc2")
+	assert.Equal(t, spdk.Notification{Type: spdk.NotificationBdevRegister, Ctx: "Malloc2", ID: 3}, next(notifications))
+
+	// After a restart SPDK counts from zero again.
+	server.Close()
+	server, err = spdktest.NewServer(sockPath)
+	if !assert.NoError(t, err, "Failed to restart fake SPDK: %s", err) {
+		return
+	}
+	defer server.Close()
+	<-connected
+	createMalloc("Malloc3")
+	assert.Equal(t, spdk.Notification{Gap: true}, next(notifications))
+	assert.Equal(t, spdk.Notification{Type: spdk.NotificationBdevRegister, Ctx: "Malloc3", ID: 0}, next(notifications))
+
+	// Notifications dropped by SPDK.
+	server.Handle("notify_get_notifications", func(params json.RawMessage) (interface{}, error) {
+		var args spdk.NotifyGetNotificationsArgs
+		json.Unmarshal(params, &args)
+		if args.ID > 5 {
+			return []spdk.Notification{}, nil
+		}
+		return []spdk.Notification{{Type: spdk.NotificationBdevRegister, Ctx: "Malloc9", ID: 5}}, nil
+	})
+	assert.Equal(t, spdk.Notification{Gap: true}, next(notifications))
+	assert.Equal(t, spdk.Notification{Type: spdk.NotificationBdevRegister, Ctx: "Malloc9", ID: 5}, next(notifications))
+
+	cancel()
+	for range notifications {
+	}
+}
+
+func TestClientCapabilities(t *testing.T) {
+	ctx := context.Background()
+	server := spdktest.Run(t)
+	client, err := spdk.NewClient(server.SocketPath(), nil)
+	if !assert.NoError(t, err, "Failed to connect fake SPDK: %s", err) {
+		return
+	}
+	defer client.Close()
+
+	caps, err := client.Capabilities(ctx)
+	if !assert.NoError(t, err, "Failed to get capabilities: %s", err) {
+		return
+	}
+	assert.Equal(t, "v23.01", caps.Version.Fields.String())
+	assert.True(t, caps.Supports("bdev_malloc_create"))
+	assert.False(t, caps.Supports("bdev_ocf_create"))
+	assert.Contains(t, caps.Methods(), "rpc_get_methods")
+	cached, err := client.Capabilities(ctx)
+	assert.NoError(t, err)
+	assert.Same(t, caps, cached)
+
+	// Methods added after the capabilities were cached are not called.
+	called := false
+	server.Handle("bdev_foo_create", func(params json.RawMessage) (interface{}, error) {
+		called = true
+		return true, nil
+	})
+	err = client.Invoke(ctx, "bdev_foo_create", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrMethodNotFound)
+	var unsupported *spdk.UnsupportedMethodError
+	if assert.ErrorAs(t, err, &unsupported) {
+		assert.Equal(t, "method bdev_foo_create unsupported by SPDK v23.01", unsupported.Error())
+	}
+	err = client.Batch().
+		Add("bdev_get_bdevs", nil, nil).
+		Add("bdev_foo_create", nil, nil).
+		Do(ctx)
+	assert.ErrorAs(t, err, &unsupported)
+	assert.False(t, called)
+
+	assert.Equal(t, "v20.01.1-pre", spdk.SpdkVersionFields{Major: 20, Minor: 1, Patch: 1, Suffix: "-pre"}.String())
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AnyParams can be passed to FakeInvoker.Expect to accept any parameters.
+var AnyParams = anyParams{}
+
+type anyParams struct{}
+
+// FakeHandler computes the result of a call to a FakeInvoker.
+// params is the JSON encoding of the call arguments, nil if there
+// were none.
+type FakeHandler func(params json.RawMessage) (interface{}, error)
+
+// FakeCall is an expected call, see FakeInvoker.Expect.
+type FakeCall struct {
+	method string
+	params interface{}
+	result interface{}
+	err    error
+}
+
+// Return sets the result which gets decoded into the reply of the call.
+func (c *FakeCall) Return(result interface{}) *FakeCall {
+	c.result = result
+	return c
+}
+
+// ReturnError makes the call fail with err, typically a *JSONRPCError.
+func (c *FakeCall) ReturnError(err error) *FakeCall {
+	c.err = err
+	return c
+}
+
+// FakeRecord is a call received by a FakeInvoker.
+type FakeRecord struct {
+	Method string
+	Params json.RawMessage
+}
+
+// FakeInvoker is an Invoker for unit tests that runs without SPDK. Calls
+// are served from a script of expected calls, which must arrive in the
+// order in which they were added with Expect, and from handlers for
+// methods that may be called at any time. Calls not covered by either
+// fail with ERROR_METHOD_NOT_FOUND and are reported by Verify.
+//
+// Arguments and results pass through JSON like with a real client, so
+// expected parameters may be given as the Args struct or as a map.
+type FakeInvoker struct {
+	mutex    sync.Mutex
+	expected []*FakeCall
+	handlers map[string]FakeHandler
+	calls    []FakeRecord
+	errs     []error
+}
+
+func NewFakeInvoker() *FakeInvoker {
+	return &FakeInvoker{
+		handlers: make(map[string]FakeHandler),
+	}
+}
+
+// Expect adds a call to the script. params are compared with the
+// arguments of the actual call unless they are AnyParams.
+func (f *FakeInvoker) Expect(method string, params interface{}) *FakeCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	call := &FakeCall{method: method, params: params}
+	f.expected = append(f.expected, call)
+	return call
+}
+
+// Handle serves all calls of method which are not scripted with Expect.
+func (f *FakeInvoker) Handle(method string, handler FakeHandler) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handlers[method] = handler
+}
+
+// Calls returns all calls received so far.
+func (f *FakeInvoker) Calls() []FakeRecord {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]FakeRecord{}, f.calls...)
+}
+
+// Verify returns an error if there were unexpected calls or if not all
+// expected calls were made.
+func (f *FakeInvoker) Verify() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	errs := append([]error{}, f.errs...)
+	for _, call := range f.expected {
+		errs = append(errs, fmt.Errorf("missing call %s", call.method))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FakeInvoker) Invoke(ctx context.Context, method string, args, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var params json.RawMessage
+	if args != nil {
+		var err error
+		params, err = json.Marshal(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := f.call(method, params)
+	if err != nil {
+		return err
+	}
+	if reply == nil || result == nil {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, reply)
+}
+
+func (f *FakeInvoker) call(method string, params json.RawMessage) (interface{}, error) {
+	f.mutex.Lock()
+	f.calls = append(f.calls, FakeRecord{Method: method, Params: params})
+
+	if len(f.expected) > 0 && f.expected[0].method == method {
+		call := f.expected[0]
+		f.expected = f.expected[1:]
+		if err := matchParams(call.params, params); err != nil {
+			err = fmt.Errorf("call %s: %w", method, err)
+			f.errs = append(f.errs, err)
+			f.mutex.Unlock()
+			return nil, err
+		}
+		f.mutex.Unlock()
+		return call.result, call.err
+	}
+
+	handler, ok := f.handlers[method]
+	if ok {
+		f.mutex.Unlock()
+		return handler(params)
+	}
+
+	var err error
+	if len(f.expected) > 0 {
+		err = fmt.Errorf("unexpected call %s, expected %s", method, f.expected[0].method)
+	} else {
+		err = fmt.Errorf("unexpected call %s", method)
+	}
+	f.errs = append(f.errs, err)
+	f.mutex.Unlock()
+	return nil, &JSONRPCError{Code: ERROR_METHOD_NOT_FOUND, Message: err.Error()}
+}
+
+// matchParams compares the JSON encodings of expected and actual parameters.
+func matchParams(expected interface{}, actual json.RawMessage) error {
+	if _, ok := expected.(anyParams); ok {
+		return nil
+	}
+
+	var want, got interface{}
+	if expected != nil {
+		data, err := json.Marshal(expected)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &want); err != nil {
+			return err
+		}
+	}
+	if actual != nil {
+		if err := json.Unmarshal(actual, &got); err != nil {
+			return err
+		}
+	}
+
+	// Re-encoding yields a canonical form with sorted keys.
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(wantJSON, gotJSON) {
+		return fmt.Errorf("unexpected params %s, expected %s", gotJSON, wantJSON)
+	}
+	return nil
+}
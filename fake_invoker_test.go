@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeInvoker(t *testing.T) {
+	ctx := context.Background()
+	fake := spdk.NewFakeInvoker()
+
+	fake.Expect("bdev_malloc_create", spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096}).
+		Return("Malloc0")
+	fake.Expect("bdev_lvol_create_lvstore", map[string]interface{}{"bdev_name": "Malloc0", "lvs_name": "Lvs0"}).
+		Return("a4b1b8f0-3b0e-4a3c-8e2d-6b4f0c5e9d11")
+	fake.Expect("nbd_start_disk", spdk.AnyParams).
+		ReturnError(spdk.ErrBusy)
+	fake.Handle("bdev_get_bdevs", func(params json.RawMessage) (interface{}, error) {
+		var args spdk.BdevGetBdevsArgs
+		json.Unmarshal(params, &args)
+		return []spdk.Bdev{{Name: args.Name, BlockSize: 4096}}, nil
+	})
+
+	name, err := spdk.BdevMallocCreate(ctx, fake, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+	assert.NoError(t, err, "Failed to create malloc bdev: %s", err)
+	assert.Equal(t, "Malloc0", name)
+
+	bdevs, err := spdk.BdevGetBdevs(ctx, fake, spdk.BdevGetBdevsArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	assert.Equal(t, spdk.BdevGetBdevsResponse{{Name: "Malloc0", BlockSize: 4096}}, bdevs)
+
+	uuid, err := spdk.BdevLvolCreateLvstore(ctx, fake, spdk.BdevLvolCreateLvstoreArgs{BdevName: "Malloc0", LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvstore: %s", err)
+	assert.NotEmpty(t, uuid)
+
+	_, err = spdk.NbdStartDisk(ctx, fake, spdk.NbdStartDiskArgs{BdevName: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+
+	assert.NoError(t, fake.Verify())
+
+	calls := fake.Calls()
+	if assert.Len(t, calls, 4) {
+		// Without device, nbd_start_disk must not send nbd_device.
+		assert.Equal(t, "nbd_start_disk", calls[3].Method)
+		assert.JSONEq(t, `{"bdev_name": "Malloc0"}`, string(calls[3].Params))
+	}
+}
+
+func TestFakeInvokerVerify(t *testing.T) {
+	ctx := context.Background()
+	fake := spdk.NewFakeInvoker()
+
+	fake.Expect("bdev_malloc_delete", spdk.BdevMallocDeleteArgs{Name: "Malloc0"}).Return(true)
+	fake.Expect("bdev_aio_delete", spdk.BdevAioDeleteArgs{Name: "Aio0"}).Return(true)
+
+	_, err := spdk.BdevMallocDelete(ctx, fake, spdk.BdevMallocDeleteArgs{Name: "Malloc1"})
+	assert.Error(t, err, "Unexpected success with wrong params")
+
+	_, err = spdk.VhostGetControllers(ctx, fake, spdk.VhostGetControllersArgs{})
+	assert.ErrorIs(t, err, spdk.ErrMethodNotFound)
+
+	// Parameters are validated before anything is sent.
+	_, err = spdk.BdevLvolDeleteLvstore(ctx, fake, spdk.BdevLvolDeleteLvstoreArgs{})
+	assert.Error(t, err, "Unexpected success without uuid and lvs_name")
+
+	err = fake.Verify()
+	assert.ErrorContains(t, err, "unexpected params")
+	assert.ErrorContains(t, err, "unexpected call vhost_get_controllers")
+	assert.ErrorContains(t, err, "missing call bdev_aio_delete")
+	// vhost_get_controllers was retried with its legacy name.
+	assert.ErrorContains(t, err, "unexpected call get_vhost_controllers")
+	assert.Len(t, fake.Calls(), 3)
+}
+
+func TestLegacyMethods(t *testing.T) {
+	ctx := context.Background()
+	fake := spdk.NewFakeInvoker()
+
+	fake.Expect("bdev_get_bdevs", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("get_bdevs", spdk.BdevGetBdevsArgs{Name: "Malloc0"}).
+		Return(spdk.BdevGetBdevsResponse{{Name: "Malloc0"}})
+	bdevs, err := spdk.BdevGetBdevs(ctx, fake, spdk.BdevGetBdevsArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to get bdevs with legacy name: %s", err)
+	assert.Len(t, bdevs, 1)
+
+	// Params unknown to the legacy method get translated.
+	fake.Expect("rpc_get_methods", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("get_rpc_methods", map[string]interface{}{"current": true}).Return([]string{"get_bdevs"})
+	methods, err := spdk.RpcGetMethods(ctx, fake, spdk.RpcGetMethodsArgs{Current: true, IncludeAliases: true})
+	assert.NoError(t, err, "Failed to get methods with legacy name: %s", err)
+	assert.Equal(t, []string{"get_bdevs"}, methods)
+
+	// Other errors are not retried.
+	fake.Expect("bdev_malloc_delete", spdk.AnyParams).ReturnError(spdk.ErrNoDevice)
+	_, err = spdk.BdevMallocDelete(ctx, fake, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+
+	// The error of the current name is returned if both are unknown.
+	fake.Expect("nbd_get_disks", spdk.AnyParams).ReturnError(&spdk.JSONRPCError{Code: spdk.ERROR_METHOD_NOT_FOUND, Message: "nbd_get_disks"})
+	fake.Expect("get_nbd_disks", spdk.AnyParams).ReturnError(&spdk.JSONRPCError{Code: spdk.ERROR_METHOD_NOT_FOUND, Message: "get_nbd_disks"})
+	_, err = spdk.NbdGetDisks(ctx, fake, spdk.NbdGetDisksArgs{})
+	assert.ErrorContains(t, err, "msg: nbd_get_disks")
+
+	// Legacy methods take sizes in bytes only.
+	fake.Expect("bdev_lvol_resize", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("resize_lvol_bdev", map[string]interface{}{"name": "Lvs0/Lvol0", "size": 8 << 20}).Return(true)
+	mib := int64(8)
+	_, err = spdk.BdevLvolResize(ctx, fake, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol0", SizeInMib: &mib})
+	assert.NoError(t, err, "Failed to resize lvol with legacy name: %s", err)
+
+	// A size of 0 is sent, only a missing one is rejected.
+	var zero int64
+	fake.Expect("bdev_lvol_resize", map[string]interface{}{"name": "Lvs0/Lvol0", "size": 0}).Return(true)
+	_, err = spdk.BdevLvolResize(ctx, fake, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol0", Size: &zero})
+	assert.NoError(t, err, "Failed to resize lvol to 0: %s", err)
+	_, err = spdk.BdevLvolResize(ctx, fake, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol0"})
+	assert.Error(t, err)
+
+	// Likewise retry counts of 0 disable retries.
+	var retries int
+	fake.Expect("bdev_nvme_set_options", map[string]interface{}{"transport_retry_count": 0, "bdev_retry_count": 0}).Return(true)
+	_, err = spdk.BdevNvmeSetOptions(ctx, fake, spdk.BdevNvmeSetOptionsArgs{TransportRetryCount: &retries, BdevRetryCount: &retries})
+	assert.NoError(t, err, "Failed to disable NVMe retries: %s", err)
+
+	// The table can be extended.
+	spdk.LegacyMethods["bdev_foo_create"] = spdk.LegacyMethod{
+		Name:   "construct_foo_bdev",
+		Params: spdk.RenameParams(map[string]string{"name": "foo_name"}),
+	}
+	defer delete(spdk.LegacyMethods, "bdev_foo_create")
+	fake.Expect("bdev_foo_create", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("construct_foo_bdev", map[string]interface{}{"foo_name": "Foo0", "size": 1 << 40}).Return("Foo0")
+	var name string
+	err = spdk.InvokeWithLegacy(ctx, fake, "bdev_foo_create", map[string]interface{}{"name": "Foo0", "size": 1 << 40}, &name)
+	assert.NoError(t, err, "Failed to call extended legacy method: %s", err)
+	assert.Equal(t, "Foo0", name)
+
+	assert.NoError(t, fake.Verify())
+}
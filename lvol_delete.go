@@ -0,0 +1,259 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LvolDeleteStep is an RPC call made by DeleteLvolRecursive or
+// DeleteLvstoreAndContents. All of them return a bool.
+type LvolDeleteStep struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+}
+
+func (s LvolDeleteStep) String() string {
+	params, err := json.Marshal(s.Params)
+	if err != nil {
+		return s.Method
+	}
+	return s.Method + " " + string(params)
+}
+
+// LvolDeletePlan are the steps of a deletion in the order
+// in which they are made.
+type LvolDeletePlan []LvolDeleteStep
+
+// String returns one step per line.
+func (p LvolDeletePlan) String() string {
+	var b strings.Builder
+	for _, step := range p {
+		b.WriteString(step.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Ways to keep the clones of a snapshot deleted by DeleteLvolRecursive.
+// Clones which are snapshots themselves are read-only, SPDK cannot
+// inflate them. The deleted snapshot is merged into such a clone
+// instead, which works when there is only one.
+const (
+	// LvolPreserveNone deletes the clones with the snapshot.
+	LvolPreserveNone = ""
+	// LvolPreserveInflate allocates all clusters of the clones,
+	// which then depend on no snapshot at all.
+	LvolPreserveInflate = "inflate"
+	// LvolPreserveDecouple copies the clusters of the snapshot into
+	// the clones, which then depend on the parent of the snapshot.
+	LvolPreserveDecouple = "decouple"
+)
+
+type DeleteLvolRecursiveArgs struct {
+	//UUID or alias of the logical volume to delete
+	Name string
+	//PreserveClones is one of LvolPreserveNone, LvolPreserveInflate
+	//or LvolPreserveDecouple.
+	PreserveClones string
+	//DryRun only returns the plan without making any call
+	//which changes something.
+	DryRun bool
+}
+
+// DeleteLvolRecursive deletes a logical volume with the clones which
+// depend on it, or keeps them as PreserveClones asks for. Before that,
+// nbd disks, vhost controllers and vhost-scsi targets and NVMe-oF
+// namespaces using the deleted lvols are removed. iSCSI target nodes
+// are not, SPDK cannot remove a LUN from one. The steps made are
+// returned, on error the last one is the step that failed.
+func DeleteLvolRecursive(ctx context.Context, client Invoker, args DeleteLvolRecursiveArgs) (LvolDeletePlan, error) {
+	switch args.PreserveClones {
+	case LvolPreserveNone, LvolPreserveInflate, LvolPreserveDecouple:
+	default:
+		return nil, fmt.Errorf("invalid parameters")
+	}
+	if args.Name == "" {
+		return nil, fmt.Errorf("invalid parameters")
+	}
+
+	bdevs, err := BdevGetBdevs(ctx, client, BdevGetBdevsArgs{Name: args.Name})
+	if err != nil {
+		return nil, err
+	}
+	var info LvolDriverSpecific
+	ok := len(bdevs) == 1
+	if ok {
+		ok, err = bdevs[0].DecodeDriverSpecific("lvol", &info)
+		if err != nil {
+			return nil, fmt.Errorf("lvol %s: %w", args.Name, err)
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("lvol %s: %w", args.Name, ErrNoDevice)
+	}
+	tree, err := GetLvolTree(ctx, client, GetLvolTreeArgs{Uuid: info.LvolStoreUUID})
+	if err != nil {
+		return nil, err
+	}
+	node := tree.Find(bdevs[0].UUID)
+	if node == nil {
+		return nil, fmt.Errorf("lvol %s: %w", args.Name, ErrNoDevice)
+	}
+
+	deleted := node.DeleteOrder()
+	var preserved []*LvolNode
+	if args.PreserveClones != LvolPreserveNone {
+		deleted = []*LvolNode{node}
+		snapshots := 0
+		for _, c := range node.Clones {
+			if c.Snapshot {
+				snapshots++
+			} else {
+				preserved = append(preserved, c)
+			}
+		}
+		if snapshots > 1 {
+			return nil, fmt.Errorf("lvol %s has more than one snapshot as clone: %w", args.Name, ErrBusy)
+		}
+	}
+	plan, err := lvolUserSteps(ctx, client, deleted)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range preserved {
+		if args.PreserveClones == LvolPreserveInflate {
+			plan = append(plan, LvolDeleteStep{"bdev_lvol_inflate", BdevLvolInflateArgs{Name: c.Uuid}})
+		} else {
+			plan = append(plan, LvolDeleteStep{"bdev_lvol_decouple_parent", BdevLvolDecoupleParentArgs{Name: c.Uuid}})
+		}
+	}
+	for _, n := range deleted {
+		plan = append(plan, LvolDeleteStep{"bdev_lvol_delete", BdevLvolDeleteArgs{Name: n.Uuid}})
+	}
+
+	if args.DryRun {
+		return plan, nil
+	}
+	return plan.run(ctx, client)
+}
+
+type DeleteLvstoreAndContentsArgs struct {
+	//Either uuid or lvs_name must be specified, but not both.
+	Uuid    string
+	LvsName string
+	//DryRun only returns the plan without making any call
+	//which changes something.
+	DryRun bool
+}
+
+// DeleteLvstoreAndContents deletes all logical volumes of a logical
+// volume store like DeleteLvolRecursive, then the store itself.
+func DeleteLvstoreAndContents(ctx context.Context, client Invoker, args DeleteLvstoreAndContentsArgs) (LvolDeletePlan, error) {
+	tree, err := GetLvolTree(ctx, client, GetLvolTreeArgs{Uuid: args.Uuid, LvsName: args.LvsName})
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := tree.DeleteOrder()
+	plan, err := lvolUserSteps(ctx, client, deleted)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range deleted {
+		plan = append(plan, LvolDeleteStep{"bdev_lvol_delete", BdevLvolDeleteArgs{Name: n.Uuid}})
+	}
+	plan = append(plan, LvolDeleteStep{"bdev_lvol_delete_lvstore", BdevLvolDeleteLvstoreArgs{Uuid: tree.Lvstore.Uuid}})
+
+	if args.DryRun {
+		return plan, nil
+	}
+	return plan.run(ctx, client)
+}
+
+// run makes the steps of p until one fails and returns the steps made,
+// including the failed one.
+func (p LvolDeletePlan) run(ctx context.Context, client Invoker) (LvolDeletePlan, error) {
+	for i, step := range p {
+		var response bool
+		if err := InvokeWithLegacy(ctx, client, step.Method, step.Params, &response); err != nil {
+			return p[:i+1], fmt.Errorf("%s: %w", step, err)
+		}
+	}
+	return p, nil
+}
+
+// lvolUserSteps returns the steps which remove the nbd disks, vhost
+// controllers and targets and NVMe-oF namespaces using one of nodes.
+// Applications without one of these subsystems do not know its methods.
+func lvolUserSteps(ctx context.Context, client Invoker, nodes []*LvolNode) (LvolDeletePlan, error) {
+	names := make(map[string]bool)
+	for _, n := range nodes {
+		names[n.Uuid] = true
+		names[n.Alias] = true
+	}
+	// Lvols may have no alias, and users report no bdev
+	// after hot-removal.
+	delete(names, "")
+	var plan LvolDeletePlan
+
+	disks, err := NbdGetDisks(ctx, client, NbdGetDisksArgs{})
+	if err != nil && !errors.Is(err, ErrMethodNotFound) {
+		return nil, err
+	}
+	for _, d := range disks {
+		if names[d.BdevName] {
+			plan = append(plan, LvolDeleteStep{"nbd_stop_disk", NbdStopDiskArgs{NbdDevice: d.NbdDevice}})
+		}
+	}
+
+	controllers, err := VhostGetControllers(ctx, client, VhostGetControllersArgs{})
+	if err != nil && !errors.Is(err, ErrMethodNotFound) {
+		return nil, err
+	}
+	for _, c := range controllers {
+		deleteController := false
+		switch backend := c.Backend.(type) {
+		case VhostBlkBackendSpecific:
+			deleteController = names[backend.Bdev]
+		case VhostNvmeBackendSpecific:
+			for _, ns := range backend {
+				deleteController = deleteController || names[ns.Bdev]
+			}
+		case VhostScsiBackendSpecific:
+			for _, target := range backend {
+				for _, lun := range target.Luns {
+					if names[lun.BdevName] {
+						plan = append(plan, LvolDeleteStep{"vhost_scsi_controller_remove_target",
+							VhostScsiControllerRemoveTargetArgs{Ctrlr: c.Ctrlr, ScsiTargetNum: int(target.ScsiDevNum)}})
+						break
+					}
+				}
+			}
+		}
+		if deleteController {
+			plan = append(plan, LvolDeleteStep{"vhost_delete_controller", VhostDeleteControllerArgs{Ctrlr: c.Ctrlr}})
+		}
+	}
+
+	subsystems, err := NvmfGetSubsystems(ctx, client, NvmfGetSubsystemsArgs{})
+	if err != nil && !errors.Is(err, ErrMethodNotFound) {
+		return nil, err
+	}
+	for _, subsystem := range subsystems {
+		for _, ns := range subsystem.Namespaces {
+			if names[ns.BdevName] {
+				plan = append(plan, LvolDeleteStep{"nvmf_subsystem_remove_ns", NvmfSubsystemRemoveNsArgs{Nqn: subsystem.Nqn, Nsid: ns.Nsid}})
+			}
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteLvolRecursiveUnnamed(t *testing.T) {
+	ctx := context.Background()
+	fake := spdk.NewFakeInvoker()
+
+	// The lvol has no alias, the vhost-blk controller lost its bdev.
+	// Neither is taken for the other.
+	vol0 := lvolBdev("u-vol0", "", map[string]interface{}{"num_allocated_clusters": 1})
+	fake.Expect("bdev_get_bdevs", spdk.BdevGetBdevsArgs{Name: "u-vol0"}).Return([]interface{}{vol0})
+	fake.Expect("bdev_lvol_get_lvstores", spdk.BdevLvolGetLvstoresArgs{Uuid: "lvs-uuid"}).
+		Return([]spdk.Lvstore{{Uuid: "lvs-uuid", Name: "Lvs0", ClusterSize: 4 << 20}})
+	fake.Expect("bdev_lvol_get_lvols", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("bdev_get_bdevs", spdk.BdevGetBdevsArgs{}).Return([]interface{}{vol0})
+	fake.Expect("nbd_get_disks", spdk.AnyParams).Return([]interface{}{})
+	fake.Expect("vhost_get_controllers", spdk.AnyParams).Return([]interface{}{
+		map[string]interface{}{"ctrlr": "vhostblk0", "backend_specific": map[string]interface{}{
+			"block": map[string]interface{}{"readonly": false, "bdev": ""}}},
+	})
+	fake.Expect("nvmf_get_subsystems", spdk.AnyParams).Return([]interface{}{})
+
+	plan, err := spdk.DeleteLvolRecursive(ctx, fake, spdk.DeleteLvolRecursiveArgs{Name: "u-vol0", DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to plan deletion: %s", err)
+	}
+	assert.Equal(t, spdk.LvolDeletePlan{
+		{Method: "bdev_lvol_delete", Params: spdk.BdevLvolDeleteArgs{Name: "u-vol0"}},
+	}, plan)
+	assert.NoError(t, fake.Verify())
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// LvolNode is a logical volume in an LvolTree.
+type LvolNode struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias"`
+	Uuid  string `json:"uuid"`
+	// Size is the provisioned size in bytes.
+	Size int64 `json:"size"`
+	// AllocatedSize is the size of the clusters allocated by the lvol
+	// itself in bytes. Clusters shared with its snapshot are not included.
+	AllocatedSize int64 `json:"allocated_size"`
+	ThinProvision bool  `json:"thin_provision"`
+	Snapshot      bool  `json:"snapshot"`
+	Degraded      bool  `json:"degraded,omitempty"`
+	// ExternalSnapshot is the bdev an esnap clone was created from,
+	// which is not part of the tree.
+	ExternalSnapshot string `json:"external_snapshot,omitempty"`
+	// Parent is the snapshot the lvol was created from, nil for roots.
+	Parent *LvolNode `json:"-"`
+	// Clones are the lvols created from a snapshot, including the one
+	// the snapshot was taken of.
+	Clones []*LvolNode `json:"clones,omitempty"`
+}
+
+// Ancestors returns the snapshots n depends on, nearest first.
+func (n *LvolNode) Ancestors() []*LvolNode {
+	var ancestors []*LvolNode
+	for p := n.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p)
+	}
+	return ancestors
+}
+
+// Descendants returns the lvols which depend on n, each one before its
+// clones.
+func (n *LvolNode) Descendants() []*LvolNode {
+	var descendants []*LvolNode
+	for _, c := range n.Clones {
+		descendants = append(descendants, c)
+		descendants = append(descendants, c.Descendants()...)
+	}
+	return descendants
+}
+
+// TotalAllocatedSize is the AllocatedSize of n and its descendants,
+// which is what deleting all of them frees.
+func (n *LvolNode) TotalAllocatedSize() int64 {
+	size := n.AllocatedSize
+	for _, c := range n.Clones {
+		size += c.TotalAllocatedSize()
+	}
+	return size
+}
+
+// CanDelete tells whether SPDK deletes n without deleting others first.
+// A snapshot with one clone can be deleted, its clusters are merged into
+// the clone, but one with more clones cannot.
+func (n *LvolNode) CanDelete() bool {
+	return len(n.Clones) <= 1
+}
+
+// DeleteOrder returns n and its descendants in an order in which they
+// can be deleted: clones before the snapshots they were created from.
+func (n *LvolNode) DeleteOrder() []*LvolNode {
+	var order []*LvolNode
+	for _, c := range n.Clones {
+		order = append(order, c.DeleteOrder()...)
+	}
+	return append(order, n)
+}
+
+// LvolTree are the logical volumes of an lvstore, linked by the
+// snapshots they were created from. It marshals to nested JSON.
+type LvolTree struct {
+	Lvstore Lvstore `json:"lvstore"`
+	// Roots are the lvols without parent snapshot, sorted by name like
+	// the clones of each snapshot.
+	Roots []*LvolNode `json:"lvols"`
+}
+
+// Lvols returns all lvols of the tree, each one before its clones.
+func (t *LvolTree) Lvols() []*LvolNode {
+	var lvols []*LvolNode
+	for _, root := range t.Roots {
+		lvols = append(lvols, root)
+		lvols = append(lvols, root.Descendants()...)
+	}
+	return lvols
+}
+
+// Find returns the lvol with the given name, alias or UUID, nil if
+// there is none.
+func (t *LvolTree) Find(name string) *LvolNode {
+	if name == "" {
+		return nil
+	}
+	for _, n := range t.Lvols() {
+		if n.Name == name || n.Alias == name || n.Uuid == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// AllocatedSize is the AllocatedSize of all lvols in bytes.
+func (t *LvolTree) AllocatedSize() int64 {
+	var size int64
+	for _, root := range t.Roots {
+		size += root.TotalAllocatedSize()
+	}
+	return size
+}
+
+// DeleteOrder returns all lvols in an order in which they can be
+// deleted, see LvolNode.DeleteOrder.
+func (t *LvolTree) DeleteOrder() []*LvolNode {
+	var order []*LvolNode
+	for _, root := range t.Roots {
+		order = append(order, root.DeleteOrder()...)
+	}
+	return order
+}
+
+// WriteDOT writes the tree as a Graphviz digraph with edges from
+// snapshots to their clones. Snapshots are drawn as boxes, external
+// snapshots as dashed boxes.
+func (t *LvolTree) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(t.Lvstore.Name))
+	external := map[string]bool{}
+	for _, n := range t.Lvols() {
+		attrs := "label=" + dotQuote(n.Name)
+		if n.Snapshot {
+			attrs += " shape=box"
+		}
+		fmt.Fprintf(&b, "\t%s [%s];\n", dotQuote(n.Uuid), attrs)
+		if n.Parent != nil {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(n.Parent.Uuid), dotQuote(n.Uuid))
+		}
+		if n.ExternalSnapshot != "" {
+			if !external[n.ExternalSnapshot] {
+				external[n.ExternalSnapshot] = true
+				fmt.Fprintf(&b, "\t%s [shape=box style=dashed];\n", dotQuote(n.ExternalSnapshot))
+			}
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(n.ExternalSnapshot), dotQuote(n.Uuid))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+type GetLvolTreeArgs struct {
+	//Either uuid or lvs_name must be specified, but not both.
+	Uuid    string
+	LvsName string
+}
+
+// GetLvolTree builds the LvolTree of an lvstore from bdev_get_bdevs and
+// bdev_lvol_get_lvols. SPDK before v23.01 has no bdev_lvol_get_lvols,
+// then names are taken from the bdev aliases.
+func GetLvolTree(ctx context.Context, client Invoker, args GetLvolTreeArgs) (*LvolTree, error) {
+	if err := checkLvstoreSelector(args.Uuid, args.LvsName, true); err != nil {
+		return nil, err
+	}
+	lvstores, err := BdevLvolGetLvstores(ctx, client, BdevLvolGetLvstoresArgs{Uuid: args.Uuid, LvsName: args.LvsName})
+	if err != nil {
+		return nil, err
+	}
+	if len(lvstores) != 1 {
+		return nil, fmt.Errorf("lvstore %s%s: %w", args.Uuid, args.LvsName, ErrNoDevice)
+	}
+	tree := &LvolTree{Lvstore: lvstores[0]}
+
+	lvols, err := BdevLvolGetLvols(ctx, client, BdevLvolGetLvolsArgs{LvsUuid: tree.Lvstore.Uuid})
+	if err != nil && !errors.Is(err, ErrMethodNotFound) {
+		return nil, err
+	}
+	lvolsByUuid := make(map[string]Lvol)
+	for _, l := range lvols {
+		lvolsByUuid[l.Uuid] = l
+	}
+	bdevs, err := BdevGetBdevs(ctx, client, BdevGetBdevsArgs{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Clones name their snapshot, which is looked up in byName. Lvols
+	// without name, e.g. without alias, are not in it.
+	nodes := make(map[string]*LvolNode)
+	byName := make(map[string]*LvolNode)
+	parents := make(map[*LvolNode]string)
+	for _, b := range bdevs {
+		var info LvolDriverSpecific
+		ok, err := b.DecodeDriverSpecific("lvol", &info)
+		if err != nil {
+			return nil, fmt.Errorf("bdev %s: %w", b.Name, err)
+		}
+		if !ok || info.LvolStoreUUID != tree.Lvstore.Uuid {
+			continue
+		}
+		n := &LvolNode{
+			Uuid:             b.UUID,
+			Size:             b.BlockSize * b.NumBlocks,
+			AllocatedSize:    info.NumAllocatedClusters * int64(tree.Lvstore.ClusterSize),
+			ThinProvision:    info.ThinProvision,
+			Snapshot:         info.Snapshot,
+			ExternalSnapshot: info.ExternalSnapshotName,
+		}
+		if l, ok := lvolsByUuid[b.UUID]; ok {
+			n.Name = l.Name
+			n.Alias = l.Alias
+			n.Degraded = l.IsDegraded
+		} else {
+			for _, alias := range b.Aliases {
+				if strings.HasPrefix(alias, tree.Lvstore.Name+"/") {
+					n.Alias = alias
+					n.Name = strings.TrimPrefix(alias, tree.Lvstore.Name+"/")
+				}
+			}
+		}
+		nodes[n.Uuid] = n
+		if n.Name != "" {
+			byName[n.Name] = n
+		}
+		if info.Clone {
+			parents[n] = info.BaseSnapshot
+		}
+	}
+
+	all := make([]*LvolNode, 0, len(nodes))
+	for _, n := range nodes {
+		all = append(all, n)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Uuid < all[j].Uuid
+	})
+	for _, n := range all {
+		if parent, ok := byName[parents[n]]; ok && parent != n {
+			n.Parent = parent
+			parent.Clones = append(parent.Clones, n)
+		} else {
+			tree.Roots = append(tree.Roots, n)
+		}
+	}
+	return tree, nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func lvolBdev(uuid, alias string, info map[string]interface{}) map[string]interface{} {
+	info["lvol_store_uuid"] = "lvs-uuid"
+	info["base_bdev"] = "Malloc0"
+	return map[string]interface{}{
+		"name":            uuid,
+		"aliases":         []string{alias},
+		"uuid":            uuid,
+		"block_size":      4096,
+		"num_blocks":      4096,
+		"driver_specific": map[string]interface{}{"lvol": info},
+	}
+}
+
+func TestLvolTree(t *testing.T) {
+	ctx := context.Background()
+	fake := spdk.NewFakeInvoker()
+
+	// SPDK before v23.01 has no bdev_lvol_get_lvols,
+	// the names come from the bdev aliases.
+	fake.Expect("bdev_lvol_get_lvstores", spdk.BdevLvolGetLvstoresArgs{LvsName: "Lvs0"}).
+		Return([]spdk.Lvstore{{Uuid: "lvs-uuid", Name: "Lvs0", ClusterSize: 4 << 20}})
+	fake.Expect("bdev_lvol_get_lvols", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("bdev_get_bdevs", spdk.BdevGetBdevsArgs{}).Return([]interface{}{
+		map[string]interface{}{"name": "Malloc0", "product_name": "Malloc disk"},
+		lvolBdev("u-vol1", "Lvs0/vol1", map[string]interface{}{
+			"thin_provision": true, "num_allocated_clusters": 2, "clone": true, "base_snapshot": "snap1"}),
+		lvolBdev("u-snap1", "Lvs0/snap1", map[string]interface{}{
+			"num_allocated_clusters": 1, "snapshot": true, "clone": true, "base_snapshot": "snap0",
+			"clones": []string{"vol1"}}),
+		lvolBdev("u-solo", "Lvs0/solo", map[string]interface{}{"num_allocated_clusters": 3}),
+		lvolBdev("u-vol0", "Lvs0/vol0", map[string]interface{}{
+			"thin_provision": true, "num_allocated_clusters": 1, "clone": true, "base_snapshot": "snap0"}),
+		lvolBdev("u-snap0", "Lvs0/snap0", map[string]interface{}{
+			"num_allocated_clusters": 5, "snapshot": true, "clones": []string{"vol0", "snap1"}}),
+	})
+	tree, err := spdk.GetLvolTree(ctx, fake, spdk.GetLvolTreeArgs{LvsName: "Lvs0"})
+	if err != nil {
+		t.Fatalf("Failed to get lvol tree: %s", err)
+	}
+	assert.NoError(t, fake.Verify())
+
+	names := func(nodes []*spdk.LvolNode) []string {
+		result := []string{}
+		for _, n := range nodes {
+			result = append(result, n.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"snap0", "solo"}, names(tree.Roots))
+	assert.Equal(t, []string{"snap0", "snap1", "vol1", "vol0", "solo"}, names(tree.Lvols()))
+	assert.Equal(t, []string{"vol1", "snap1", "vol0", "snap0", "solo"}, names(tree.DeleteOrder()))
+	assert.Equal(t, int64(12*4<<20), tree.AllocatedSize())
+
+	vol1 := tree.Find("Lvs0/vol1")
+	if assert.NotNil(t, vol1) {
+		assert.Equal(t, "u-vol1", vol1.Uuid)
+		assert.Equal(t, int64(16<<20), vol1.Size)
+		assert.Equal(t, int64(8<<20), vol1.AllocatedSize)
+		assert.Equal(t, []string{"snap1", "snap0"}, names(vol1.Ancestors()))
+	}
+	snap0 := tree.Find("u-snap0")
+	if assert.NotNil(t, snap0) {
+		assert.False(t, snap0.CanDelete())
+		assert.Equal(t, []string{"snap1", "vol1", "vol0"}, names(snap0.Descendants()))
+		assert.Equal(t, int64(9*4<<20), snap0.TotalAllocatedSize())
+	}
+	assert.True(t, tree.Find("snap1").CanDelete())
+	assert.Nil(t, tree.Find("vol2"))
+
+	var dot bytes.Buffer
+	if err := tree.WriteDOT(&dot); err != nil {
+		t.Fatalf("Failed to write DOT: %s", err)
+	}
+	assert.Equal(t, `digraph "Lvs0" {
+	"u-snap0" [label="snap0" shape=box];
+	"u-snap1" [label="snap1" shape=box];
+	"u-snap0" -> "u-snap1";
+	"u-vol1" [label="vol1"];
+	"u-snap1" -> "u-vol1";
+	"u-vol0" [label="vol0"];
+	"u-snap0" -> "u-vol0";
+	"u-solo" [label="solo"];
+}
+`, dot.String())
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("Failed to marshal lvol tree: %s", err)
+	}
+	var decoded struct {
+		Lvols []struct {
+			Name   string
+			Clones []struct {
+				Name   string
+				Clones []struct{ Name string }
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode lvol tree: %s", err)
+	}
+	if assert.Len(t, decoded.Lvols, 2) && assert.Len(t, decoded.Lvols[0].Clones, 2) {
+		assert.Equal(t, "snap1", decoded.Lvols[0].Clones[0].Name)
+		assert.Equal(t, "vol1", decoded.Lvols[0].Clones[0].Clones[0].Name)
+	}
+
+	_, err = spdk.GetLvolTree(ctx, fake, spdk.GetLvolTreeArgs{})
+	assert.Error(t, err)
+	// Lvols without alias have no name. They are all kept, but
+	// clones cannot be linked to such snapshots.
+	fake.Expect("bdev_lvol_get_lvstores", spdk.BdevLvolGetLvstoresArgs{LvsName: "Lvs0"}).
+		Return([]spdk.Lvstore{{Uuid: "lvs-uuid", Name: "Lvs0", ClusterSize: 4 << 20}})
+	fake.Expect("bdev_lvol_get_lvols", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("bdev_get_bdevs", spdk.BdevGetBdevsArgs{}).Return([]interface{}{
+		lvolBdev("u-vol1", "", map[string]interface{}{"clone": true, "base_snapshot": "snap0"}),
+		lvolBdev("u-snap0", "", map[string]interface{}{"snapshot": true, "clones": []string{"vol1"}}),
+		lvolBdev("u-vol0", "", map[string]interface{}{}),
+		lvolBdev("u-vol2", "Lvs0/vol2", map[string]interface{}{"clone": true, "base_snapshot": "snap0"}),
+	})
+	tree, err = spdk.GetLvolTree(ctx, fake, spdk.GetLvolTreeArgs{LvsName: "Lvs0"})
+	if err != nil {
+		t.Fatalf("Failed to get lvol tree: %s", err)
+	}
+	uuids := []string{}
+	for _, n := range tree.Roots {
+		uuids = append(uuids, n.Uuid)
+	}
+	assert.Equal(t, []string{"u-snap0", "u-vol0", "u-vol1", "u-vol2"}, uuids)
+	assert.Nil(t, tree.Find(""))
+	assert.NoError(t, fake.Verify())
+
+	// An lvol whose driver specific information does not decode
+	// fails the tree instead of being left out.
+	fake.Expect("bdev_lvol_get_lvstores", spdk.BdevLvolGetLvstoresArgs{LvsName: "Lvs0"}).
+		Return([]spdk.Lvstore{{Uuid: "lvs-uuid", Name: "Lvs0", ClusterSize: 4 << 20}})
+	fake.Expect("bdev_lvol_get_lvols", spdk.AnyParams).ReturnError(spdk.ErrMethodNotFound)
+	fake.Expect("bdev_get_bdevs", spdk.BdevGetBdevsArgs{}).Return([]interface{}{
+		lvolBdev("u-vol0", "Lvs0/vol0", map[string]interface{}{"num_allocated_clusters": "1"}),
+	})
+	_, err = spdk.GetLvolTree(ctx, fake, spdk.GetLvolTreeArgs{LvsName: "Lvs0"})
+	assert.Error(t, err)
+	assert.NoError(t, fake.Verify())
+}
@@ -25,6 +25,7 @@ type SupportedIOTypes struct {
 
 type Bdev struct {
 	Name             string           `json:"name"`
+	Aliases          []string         `json:"aliases,omitempty"`
 	ProductName      string           `json:"product_name"`
 	UUID             string           `json:"uuid"`
 	BlockSize        int64            `json:"block_size"`
@@ -41,9 +42,9 @@ type BdevGetBdevsArgs struct {
 
 type BdevGetBdevsResponse []Bdev
 
-func BdevGetBdevs(ctx context.Context, client *Client, args BdevGetBdevsArgs) (BdevGetBdevsResponse, error) {
+func BdevGetBdevs(ctx context.Context, client Invoker, args BdevGetBdevsArgs) (BdevGetBdevsResponse, error) {
 	var response BdevGetBdevsResponse
-	err := client.Invoke(ctx, "bdev_get_bdevs", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_get_bdevs", args, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -58,9 +59,9 @@ type BdevMallocCreateArgs struct {
 }
 
 //BdevMallocCreateResponse is "string": name of newly created bdev
-func BdevMallocCreate(ctx context.Context, client *Client, args BdevMallocCreateArgs) (string, error) {
+func BdevMallocCreate(ctx context.Context, client Invoker, args BdevMallocCreateArgs) (string, error) {
 	var response string
-	err := client.Invoke(ctx, "bdev_malloc_create", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_malloc_create", args, &response)
 	if err != nil {
 		return "", err
 	}
@@ -72,9 +73,9 @@ type BdevMallocDeleteArgs struct {
 }
 
 //BdevMallocDeleteResponse is "bool": indication of delete result
-func BdevMallocDelete(ctx context.Context, client *Client, args BdevMallocDeleteArgs) (bool, error) {
+func BdevMallocDelete(ctx context.Context, client Invoker, args BdevMallocDeleteArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "bdev_malloc_delete", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_malloc_delete", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -88,9 +89,9 @@ type BdevAioCreateArgs struct {
 }
 
 //BdevAioCreateResponse is "string": name of newly created bdev
-func BdevAioCreate(ctx context.Context, client *Client, args BdevAioCreateArgs) (string, error) {
+func BdevAioCreate(ctx context.Context, client Invoker, args BdevAioCreateArgs) (string, error) {
 	var response string
-	err := client.Invoke(ctx, "bdev_aio_create", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_aio_create", args, &response)
 	if err != nil {
 		return "", err
 	}
@@ -102,9 +103,9 @@ type BdevAioDeleteArgs struct {
 }
 
 //BdevAioDeleteResponse is "bool": indication of delete result
-func BdevAioDelete(ctx context.Context, client *Client, args BdevAioDeleteArgs) (bool, error) {
+func BdevAioDelete(ctx context.Context, client Invoker, args BdevAioDeleteArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "bdev_aio_delete", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_aio_delete", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,289 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// The driver_specific member of a Bdev has one member named after the
+// bdev module, sometimes more for bdevs stacked on other modules. Bdev
+// has accessors which decode those of common modules. They return false
+// when there is no member of the module or when it does not decode,
+// DecodeDriverSpecific tells these apart.
+
+// RawDriverSpecific returns the member of module as JSON, nil if there
+// is none. It is meant for modules without accessor.
+func (b Bdev) RawDriverSpecific(module string) json.RawMessage {
+	if b.DriverSpecific == nil {
+		return nil
+	}
+	members, ok := (*b.DriverSpecific).(map[string]interface{})
+	if !ok || members[module] == nil {
+		return nil
+	}
+	data, err := json.Marshal(members[module])
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// DecodeDriverSpecific decodes the member of module into v. It returns
+// false without error when there is no such member.
+func (b Bdev) DecodeDriverSpecific(module string, v interface{}) (bool, error) {
+	data := b.RawDriverSpecific(module)
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("driver_specific %s: %w", module, err)
+	}
+	return true, nil
+}
+
+func (b Bdev) decode(module string, v interface{}) bool {
+	ok, err := b.DecodeDriverSpecific(module, v)
+	return ok && err == nil
+}
+
+type LvolDriverSpecific struct {
+	LvolStoreUUID        string `json:"lvol_store_uuid"`
+	BaseBdev             string `json:"base_bdev"`
+	ThinProvision        bool   `json:"thin_provision"`
+	NumAllocatedClusters int64  `json:"num_allocated_clusters"`
+	Snapshot             bool   `json:"snapshot"`
+	Clone                bool   `json:"clone"`
+	// BaseSnapshot is the name of the snapshot a clone was created from.
+	BaseSnapshot string `json:"base_snapshot,omitempty"`
+	// Clones are the names of the clones of a snapshot.
+	Clones               []string `json:"clones,omitempty"`
+	EsnapClone           bool     `json:"esnap_clone,omitempty"`
+	ExternalSnapshotName string   `json:"external_snapshot_name,omitempty"`
+}
+
+// Lvol returns the driver specific information of a logical volume.
+func (b Bdev) Lvol() (LvolDriverSpecific, bool) {
+	var info LvolDriverSpecific
+	return info, b.decode("lvol", &info)
+}
+
+type AioDriverSpecific struct {
+	Filename          string `json:"filename"`
+	BlockSizeOverride bool   `json:"block_size_override"`
+	Readonly          bool   `json:"readonly"`
+	Fallocate         bool   `json:"fallocate,omitempty"`
+}
+
+// Aio returns the driver specific information of an aio bdev.
+func (b Bdev) Aio() (AioDriverSpecific, bool) {
+	var info AioDriverSpecific
+	return info, b.decode("aio", &info)
+}
+
+// MallocDriverSpecific is empty, the malloc module reports no driver
+// specific information.
+type MallocDriverSpecific struct{}
+
+// Malloc checks whether the bdev is a malloc bdev. As there is no
+// driver specific information, this is based on the product name.
+func (b Bdev) Malloc() (MallocDriverSpecific, bool) {
+	var info MallocDriverSpecific
+	if b.decode("malloc", &info) {
+		return info, true
+	}
+	return info, b.ProductName == "Malloc disk"
+}
+
+// NullDriverSpecific is empty, the null module reports no driver
+// specific information.
+type NullDriverSpecific struct{}
+
+// Null checks whether the bdev is a null bdev. As there is no driver
+// specific information, this is based on the product name.
+func (b Bdev) Null() (NullDriverSpecific, bool) {
+	var info NullDriverSpecific
+	if b.decode("null", &info) {
+		return info, true
+	}
+	return info, b.ProductName == "Null disk"
+}
+
+type NvmeTransportID struct {
+	Trtype  string `json:"trtype"`
+	Adrfam  string `json:"adrfam,omitempty"`
+	Traddr  string `json:"traddr"`
+	Trsvcid string `json:"trsvcid,omitempty"`
+	Subnqn  string `json:"subnqn,omitempty"`
+}
+
+type NvmeCtrlrData struct {
+	Cntlid           int    `json:"cntlid"`
+	VendorID         string `json:"vendor_id"`
+	ModelNumber      string `json:"model_number"`
+	SerialNumber     string `json:"serial_number"`
+	FirmwareRevision string `json:"firmware_revision"`
+	Subnqn           string `json:"subnqn,omitempty"`
+}
+
+type NvmeNsData struct {
+	ID       int  `json:"id"`
+	CanShare bool `json:"can_share,omitempty"`
+}
+
+// NvmeDriverSpecific describes one path to the namespace of a
+// NVMe bdev.
+type NvmeDriverSpecific struct {
+	// PciAddress is set for local PCIe controllers.
+	PciAddress string          `json:"pci_address,omitempty"`
+	Trid       NvmeTransportID `json:"trid"`
+	CtrlrData  NvmeCtrlrData   `json:"ctrlr_data"`
+	NsData     NvmeNsData      `json:"ns_data"`
+	Vs         struct {
+		NvmeVersion string `json:"nvme_version"`
+	} `json:"vs"`
+}
+
+// Nvme returns the driver specific information of a NVMe bdev, one
+// entry per path. SPDK before v21.07 reports a single path as object.
+func (b Bdev) Nvme() ([]NvmeDriverSpecific, bool) {
+	data := bytes.TrimSpace(b.RawDriverSpecific("nvme"))
+	if len(data) > 0 && data[0] == '{' {
+		var info NvmeDriverSpecific
+		if json.Unmarshal(data, &info) != nil {
+			return nil, false
+		}
+		return []NvmeDriverSpecific{info}, true
+	}
+	var info []NvmeDriverSpecific
+	return info, b.decode("nvme", &info)
+}
+
+type RaidBaseBdev struct {
+	Name         string `json:"name"`
+	UUID         string `json:"uuid,omitempty"`
+	IsConfigured bool   `json:"is_configured"`
+	DataOffset   int64  `json:"data_offset,omitempty"`
+	DataSize     int64  `json:"data_size,omitempty"`
+}
+
+// UnmarshalJSON also accepts the name of the base bdev, which is what
+// SPDK before v23.09 reports.
+func (r *RaidBaseBdev) UnmarshalJSON(data []byte) error {
+	var name *string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*r = RaidBaseBdev{}
+		if name != nil {
+			r.Name = *name
+			r.IsConfigured = true
+		}
+		return nil
+	}
+	type raidBaseBdev RaidBaseBdev
+	return json.Unmarshal(data, (*raidBaseBdev)(r))
+}
+
+type RaidDriverSpecific struct {
+	UUID        string `json:"uuid,omitempty"`
+	StripSizeKB int64  `json:"strip_size_kb"`
+	// State is one of the RaidState values.
+	State string `json:"state"`
+	// RaidLevel is one of the RaidLevel values.
+	RaidLevel               string         `json:"raid_level"`
+	Superblock              bool           `json:"superblock,omitempty"`
+	NumBaseBdevs            int            `json:"num_base_bdevs"`
+	NumBaseBdevsDiscovered  int            `json:"num_base_bdevs_discovered"`
+	NumBaseBdevsOperational int            `json:"num_base_bdevs_operational,omitempty"`
+	BaseBdevsList           []RaidBaseBdev `json:"base_bdevs_list"`
+	// Process is the background process of the RAID bdev,
+	// nil if none is running.
+	Process *RaidProcess `json:"process,omitempty"`
+}
+
+// Raid returns the driver specific information of a RAID bdev.
+func (b Bdev) Raid() (RaidDriverSpecific, bool) {
+	var info RaidDriverSpecific
+	return info, b.decode("raid", &info)
+}
+
+type PassthruDriverSpecific struct {
+	Name         string `json:"name"`
+	BaseBdevName string `json:"base_bdev_name"`
+}
+
+// Passthru returns the driver specific information of a passthru bdev.
+func (b Bdev) Passthru() (PassthruDriverSpecific, bool) {
+	var info PassthruDriverSpecific
+	return info, b.decode("passthru", &info)
+}
+
+type SplitDriverSpecific struct {
+	BaseBdev     string `json:"base_bdev"`
+	OffsetBlocks int64  `json:"offset_blocks"`
+}
+
+// Split returns the driver specific information of a split bdev.
+func (b Bdev) Split() (SplitDriverSpecific, bool) {
+	var info SplitDriverSpecific
+	return info, b.decode("split", &info)
+}
+
+// DelayDriverSpecific has the latencies in microseconds.
+type DelayDriverSpecific struct {
+	Name            string `json:"name"`
+	BaseBdevName    string `json:"base_bdev_name"`
+	AvgReadLatency  int64  `json:"avg_read_latency"`
+	P99ReadLatency  int64  `json:"p99_read_latency"`
+	AvgWriteLatency int64  `json:"avg_write_latency"`
+	P99WriteLatency int64  `json:"p99_write_latency"`
+}
+
+// Delay returns the driver specific information of a delay bdev.
+func (b Bdev) Delay() (DelayDriverSpecific, bool) {
+	var info DelayDriverSpecific
+	return info, b.decode("delay", &info)
+}
+
+type UringDriverSpecific struct {
+	Filename string `json:"filename"`
+}
+
+// Uring returns the driver specific information of an uring bdev.
+func (b Bdev) Uring() (UringDriverSpecific, bool) {
+	var info UringDriverSpecific
+	return info, b.decode("uring", &info)
+}
+
+type CryptoDriverSpecific struct {
+	Name         string `json:"name"`
+	BaseBdevName string `json:"base_bdev_name"`
+	// KeyName is reported by SPDK v23.01 and later, which
+	// manages keys with accel_crypto_key_create.
+	KeyName   string `json:"key_name,omitempty"`
+	CryptoPmd string `json:"crypto_pmd,omitempty"`
+	Cipher    string `json:"cipher,omitempty"`
+}
+
+// Crypto returns the driver specific information of a crypto bdev.
+func (b Bdev) Crypto() (CryptoDriverSpecific, bool) {
+	var info CryptoDriverSpecific
+	return info, b.decode("crypto", &info)
+}
+
+type CompressDriverSpecific struct {
+	Name         string `json:"name"`
+	BaseBdevName string `json:"base_bdev_name"`
+	PmPath       string `json:"pm_path"`
+}
+
+// Compress returns the driver specific information of a compress bdev.
+func (b Bdev) Compress() (CompressDriverSpecific, bool) {
+	var info CompressDriverSpecific
+	return info, b.decode("compress", &info)
+}
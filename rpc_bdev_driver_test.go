@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeBdev(t *testing.T, data string) spdk.Bdev {
+	var bdev spdk.Bdev
+	if err := json.Unmarshal([]byte(data), &bdev); err != nil {
+		t.Fatalf("Failed to decode bdev: %s", err)
+	}
+	return bdev
+}
+
+func TestBdevDriverSpecific(t *testing.T) {
+	lvolBdev := decodeBdev(t, `{
+		"name": "8d4b4a5b-bd5f-4a2e-b5f5-5a3ba3bd2b8d",
+		"product_name": "Logical Volume",
+		"driver_specific": {"lvol": {
+			"lvol_store_uuid": "a9e0ac7a-7ffb-4e24-9c8b-0a5ae0a1d7b5",
+			"base_bdev": "Malloc0",
+			"thin_provision": true,
+			"num_allocated_clusters": 3,
+			"snapshot": false,
+			"clone": true,
+			"base_snapshot": "snap0"
+		}}}`)
+	lvol, ok := lvolBdev.Lvol()
+	assert.True(t, ok)
+	assert.Equal(t, spdk.LvolDriverSpecific{
+		LvolStoreUUID:        "a9e0ac7a-7ffb-4e24-9c8b-0a5ae0a1d7b5",
+		BaseBdev:             "Malloc0",
+		ThinProvision:        true,
+		NumAllocatedClusters: 3,
+		Clone:                true,
+		BaseSnapshot:         "snap0",
+	}, lvol)
+	_, ok = lvolBdev.Aio()
+	assert.False(t, ok)
+	_, ok = lvolBdev.Malloc()
+	assert.False(t, ok)
+
+	aio, ok := decodeBdev(t, `{"driver_specific": {"aio": {"filename": "/tmp/aio", "block_size_override": true, "readonly": false}}}`).Aio()
+	assert.True(t, ok)
+	assert.Equal(t, spdk.AioDriverSpecific{Filename: "/tmp/aio", BlockSizeOverride: true}, aio)
+
+	_, ok = decodeBdev(t, `{"product_name": "Malloc disk", "driver_specific": {}}`).Malloc()
+	assert.True(t, ok)
+
+	// SPDK before v21.07 reports one NVMe path as object.
+	for _, nvme := range []string{
+		`{"pci_address": "0000:00:04.0", "trid": {"trtype": "PCIe", "traddr": "0000:00:04.0"}, "ns_data": {"id": 1}}`,
+		`[{"pci_address": "0000:00:04.0", "trid": {"trtype": "PCIe", "traddr": "0000:00:04.0"}, "ns_data": {"id": 1}}]`,
+	} {
+		paths, ok := decodeBdev(t, `{"driver_specific": {"nvme": `+nvme+`}}`).Nvme()
+		if assert.True(t, ok, "nvme %s", nvme) && assert.Len(t, paths, 1) {
+			assert.Equal(t, "0000:00:04.0", paths[0].PciAddress)
+			assert.Equal(t, "PCIe", paths[0].Trid.Trtype)
+			assert.Equal(t, 1, paths[0].NsData.ID)
+		}
+	}
+
+	// Base bdevs are names before SPDK v23.09.
+	for _, list := range []string{
+		`["Malloc0", null]`,
+		`[{"name": "Malloc0", "is_configured": true}, {"name": null, "is_configured": false}]`,
+	} {
+		raid, ok := decodeBdev(t, `{"driver_specific": {"raid": {
+			"strip_size_kb": 64, "state": "online", "raid_level": "raid1",
+			"num_base_bdevs": 2, "num_base_bdevs_discovered": 1,
+			"base_bdevs_list": `+list+`}}}`).Raid()
+		if assert.True(t, ok, "raid %s", list) {
+			assert.Equal(t, "raid1", raid.RaidLevel)
+			assert.Equal(t, []spdk.RaidBaseBdev{{Name: "Malloc0", IsConfigured: true}, {}}, raid.BaseBdevsList)
+		}
+	}
+
+	// Stacked bdevs may report more than one module.
+	stacked := decodeBdev(t, `{"driver_specific": {
+		"passthru": {"name": "pt0", "base_bdev_name": "Malloc0"},
+		"split": {"base_bdev": "Malloc0", "offset_blocks": 1024}}}`)
+	passthru, ok := stacked.Passthru()
+	assert.True(t, ok)
+	assert.Equal(t, "Malloc0", passthru.BaseBdevName)
+	split, ok := stacked.Split()
+	assert.True(t, ok)
+	assert.Equal(t, int64(1024), split.OffsetBlocks)
+
+	// Unknown modules are available as raw JSON.
+	ocf := decodeBdev(t, `{"driver_specific": {"ocf": {"mode": "wt"}}}`)
+	assert.JSONEq(t, `{"mode": "wt"}`, string(ocf.RawDriverSpecific("ocf")))
+	_, ok = ocf.Delay()
+	assert.False(t, ok)
+
+	// Members which do not decode are no match for the accessors,
+	// DecodeDriverSpecific reports them.
+	malformed := decodeBdev(t, `{"product_name": "Logical Volume", "driver_specific": {"lvol": {"num_allocated_clusters": "3"}}}`)
+	_, ok = malformed.Lvol()
+	assert.False(t, ok)
+	var info spdk.LvolDriverSpecific
+	ok, err := malformed.DecodeDriverSpecific("lvol", &info)
+	assert.Error(t, err)
+	assert.False(t, ok)
+	ok, err = malformed.DecodeDriverSpecific("aio", &info)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, ok = decodeBdev(t, `{"driver_specific": {"nvme": {"ns_data": {"id": "1"}}}}`).Nvme()
+	assert.False(t, ok)
+}
+
+func TestNvmeControllerFormats(t *testing.T) {
+	var controllers spdk.BdevNvmeGetControllersResponse
+	// SPDK before v21.07 has only the trid of the controller.
+	err := json.Unmarshal([]byte(`[
+		{"name": "Nvme0", "trid": {"trtype": "PCIe", "traddr": "0000:00:04.0"}},
+		{"name": "Nvme1", "ctrlrs": [{"state": "enabled", "cntlid": 1, "trid": {"trtype": "TCP", "traddr": "127.0.0.1", "trsvcid": "4420"}}]}
+	]`), &controllers)
+	assert.NoError(t, err, "Failed to decode controllers: %s", err)
+	if assert.Len(t, controllers, 2) {
+		assert.Equal(t, []spdk.NvmeControllerPath{{Trid: spdk.NvmeTransportID{Trtype: "PCIe", Traddr: "0000:00:04.0"}}}, controllers[0].Ctrlrs)
+		assert.Equal(t, "Nvme1", controllers[1].Name)
+		assert.Equal(t, []spdk.NvmeControllerPath{{
+			State:  "enabled",
+			Cntlid: 1,
+			Trid:   spdk.NvmeTransportID{Trtype: "TCP", Traddr: "127.0.0.1", Trsvcid: "4420"},
+		}}, controllers[1].Ctrlrs)
+	}
+}
@@ -0,0 +1,492 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+)
+
+type IscsiPortal struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+}
+
+type IscsiCreatePortalGroupArgs struct {
+	Tag     int           `json:"tag"`
+	Portals []IscsiPortal `json:"portals"`
+	// Private portal groups are not reported by SendTargets discovery.
+	Private bool `json:"private,omitempty"`
+	// Wait defers listening until iscsi_start_portal_group.
+	Wait bool `json:"wait,omitempty"`
+}
+
+// IscsiCreatePortalGroupResponse is "bool": indication of result
+func IscsiCreatePortalGroup(ctx context.Context, client Invoker, args IscsiCreatePortalGroupArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_create_portal_group", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiDeletePortalGroupArgs struct {
+	Tag int `json:"tag"`
+}
+
+// IscsiDeletePortalGroupResponse is "bool": indication of result
+func IscsiDeletePortalGroup(ctx context.Context, client Invoker, args IscsiDeletePortalGroupArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_delete_portal_group", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiPortalGroup struct {
+	Tag     int           `json:"tag"`
+	Private bool          `json:"private"`
+	Portals []IscsiPortal `json:"portals"`
+}
+
+type IscsiGetPortalGroupsResponse []IscsiPortalGroup
+
+func IscsiGetPortalGroups(ctx context.Context, client Invoker) (IscsiGetPortalGroupsResponse, error) {
+	var response IscsiGetPortalGroupsResponse
+	err := InvokeWithLegacy(ctx, client, "iscsi_get_portal_groups", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// IscsiChap are the CHAP settings of discovery sessions,
+// a portal group or a target node.
+type IscsiChap struct {
+	DisableChap bool `json:"disable_chap,omitempty"`
+	RequireChap bool `json:"require_chap,omitempty"`
+	MutualChap  bool `json:"mutual_chap,omitempty"`
+	// ChapGroup is the tag of the auth group with the secrets.
+	ChapGroup int `json:"chap_group,omitempty"`
+}
+
+type IscsiPortalGroupSetAuthArgs struct {
+	Tag int `json:"tag"`
+	IscsiChap
+}
+
+// IscsiPortalGroupSetAuthResponse is "bool": indication of result
+func IscsiPortalGroupSetAuth(ctx context.Context, client Invoker, args IscsiPortalGroupSetAuthArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_portal_group_set_auth", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiCreateInitiatorGroupArgs struct {
+	Tag int `json:"tag"`
+	// Initiators are IQNs, IP addresses or "ANY".
+	Initiators []string `json:"initiators"`
+	// Netmasks are like "192.168.1.0/24" or "ANY".
+	Netmasks []string `json:"netmasks"`
+}
+
+// IscsiCreateInitiatorGroupResponse is "bool": indication of result
+func IscsiCreateInitiatorGroup(ctx context.Context, client Invoker, args IscsiCreateInitiatorGroupArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_create_initiator_group", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiDeleteInitiatorGroupArgs struct {
+	Tag int `json:"tag"`
+}
+
+// IscsiDeleteInitiatorGroupResponse is "bool": indication of result
+func IscsiDeleteInitiatorGroup(ctx context.Context, client Invoker, args IscsiDeleteInitiatorGroupArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_delete_initiator_group", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiInitiatorGroupInitiatorsArgs struct {
+	Tag        int      `json:"tag"`
+	Initiators []string `json:"initiators,omitempty"`
+	Netmasks   []string `json:"netmasks,omitempty"`
+}
+
+// IscsiInitiatorGroupAddInitiatorsResponse is "bool": indication of result
+func IscsiInitiatorGroupAddInitiators(ctx context.Context, client Invoker, args IscsiInitiatorGroupInitiatorsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_initiator_group_add_initiators", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// IscsiInitiatorGroupRemoveInitiatorsResponse is "bool": indication of result
+func IscsiInitiatorGroupRemoveInitiators(ctx context.Context, client Invoker, args IscsiInitiatorGroupInitiatorsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_initiator_group_remove_initiators", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiInitiatorGroup struct {
+	Tag        int      `json:"tag"`
+	Initiators []string `json:"initiators"`
+	Netmasks   []string `json:"netmasks"`
+}
+
+type IscsiGetInitiatorGroupsResponse []IscsiInitiatorGroup
+
+func IscsiGetInitiatorGroups(ctx context.Context, client Invoker) (IscsiGetInitiatorGroupsResponse, error) {
+	var response IscsiGetInitiatorGroupsResponse
+	err := InvokeWithLegacy(ctx, client, "iscsi_get_initiator_groups", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// IscsiPgIgMap allows the initiators of an initiator group to log in
+// to a target node through the portals of a portal group.
+type IscsiPgIgMap struct {
+	PgTag int `json:"pg_tag"`
+	IgTag int `json:"ig_tag"`
+}
+
+type IscsiLun struct {
+	BdevName string `json:"bdev_name"`
+	LunID    int    `json:"lun_id"`
+}
+
+type IscsiCreateTargetNodeArgs struct {
+	// Name gets prefixed with the node base of iscsi_get_options
+	// unless it contains a colon.
+	Name       string         `json:"name"`
+	AliasName  string         `json:"alias_name"`
+	PgIgMaps   []IscsiPgIgMap `json:"pg_ig_maps"`
+	Luns       []IscsiLun     `json:"luns"`
+	QueueDepth int            `json:"queue_depth"`
+	IscsiChap
+	HeaderDigest bool `json:"header_digest,omitempty"`
+	DataDigest   bool `json:"data_digest,omitempty"`
+}
+
+// IscsiCreateTargetNodeResponse is "bool": indication of result
+func IscsiCreateTargetNode(ctx context.Context, client Invoker, args IscsiCreateTargetNodeArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_create_target_node", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiDeleteTargetNodeArgs struct {
+	// Name is the full name including the node base.
+	Name string `json:"name"`
+}
+
+// IscsiDeleteTargetNodeResponse is "bool": indication of result
+func IscsiDeleteTargetNode(ctx context.Context, client Invoker, args IscsiDeleteTargetNodeArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_delete_target_node", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiTargetNode struct {
+	Name       string         `json:"name"`
+	AliasName  string         `json:"alias_name"`
+	PgIgMaps   []IscsiPgIgMap `json:"pg_ig_maps"`
+	Luns       []IscsiLun     `json:"luns"`
+	QueueDepth int            `json:"queue_depth"`
+	IscsiChap
+	HeaderDigest bool `json:"header_digest"`
+	DataDigest   bool `json:"data_digest"`
+}
+
+type IscsiGetTargetNodesResponse []IscsiTargetNode
+
+func IscsiGetTargetNodes(ctx context.Context, client Invoker) (IscsiGetTargetNodesResponse, error) {
+	var response IscsiGetTargetNodesResponse
+	err := InvokeWithLegacy(ctx, client, "iscsi_get_target_nodes", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// IscsiTargetNodeAddLunArgs adds a LUN to a target node. SPDK has no
+// RPC to remove a single LUN, the target node has to be recreated.
+type IscsiTargetNodeAddLunArgs struct {
+	Name     string `json:"name"`
+	BdevName string `json:"bdev_name"`
+	// LunID nil selects the lowest free LUN id.
+	LunID *int `json:"lun_id,omitempty"`
+}
+
+// IscsiTargetNodeAddLunResponse is "bool": indication of result
+func IscsiTargetNodeAddLun(ctx context.Context, client Invoker, args IscsiTargetNodeAddLunArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_target_node_add_lun", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiTargetNodePgIgMapsArgs struct {
+	Name     string         `json:"name"`
+	PgIgMaps []IscsiPgIgMap `json:"pg_ig_maps"`
+}
+
+// IscsiTargetNodeAddPgIgMapsResponse is "bool": indication of result
+func IscsiTargetNodeAddPgIgMaps(ctx context.Context, client Invoker, args IscsiTargetNodePgIgMapsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_target_node_add_pg_ig_maps", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// IscsiTargetNodeRemovePgIgMapsResponse is "bool": indication of result
+func IscsiTargetNodeRemovePgIgMaps(ctx context.Context, client Invoker, args IscsiTargetNodePgIgMapsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_target_node_remove_pg_ig_maps", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiTargetNodeSetAuthArgs struct {
+	Name string `json:"name"`
+	IscsiChap
+}
+
+// IscsiTargetNodeSetAuthResponse is "bool": indication of result
+func IscsiTargetNodeSetAuth(ctx context.Context, client Invoker, args IscsiTargetNodeSetAuthArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_target_node_set_auth", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// IscsiChapSecret is a CHAP user. Calls which carry secrets are kept
+// out of the client log.
+type IscsiChapSecret struct {
+	User   string `json:"user"`
+	Secret string `json:"secret"`
+	// Muser and Msecret are for mutual CHAP.
+	Muser   string `json:"muser,omitempty"`
+	Msecret string `json:"msecret,omitempty"`
+}
+
+type IscsiCreateAuthGroupArgs struct {
+	Tag     int               `json:"tag"`
+	Secrets []IscsiChapSecret `json:"secrets,omitempty"`
+}
+
+// IscsiCreateAuthGroupResponse is "bool": indication of result
+func IscsiCreateAuthGroup(ctx context.Context, client Invoker, args IscsiCreateAuthGroupArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_create_auth_group", args, &response, WithoutCallLogging())
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiDeleteAuthGroupArgs struct {
+	Tag int `json:"tag"`
+}
+
+// IscsiDeleteAuthGroupResponse is "bool": indication of result
+func IscsiDeleteAuthGroup(ctx context.Context, client Invoker, args IscsiDeleteAuthGroupArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_delete_auth_group", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiAuthGroup struct {
+	Tag     int               `json:"tag"`
+	Secrets []IscsiChapSecret `json:"secrets"`
+}
+
+type IscsiGetAuthGroupsResponse []IscsiAuthGroup
+
+func IscsiGetAuthGroups(ctx context.Context, client Invoker) (IscsiGetAuthGroupsResponse, error) {
+	var response IscsiGetAuthGroupsResponse
+	err := InvokeWithLegacy(ctx, client, "iscsi_get_auth_groups", nil, &response, WithoutCallLogging())
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type IscsiAuthGroupAddSecretArgs struct {
+	Tag     int    `json:"tag"`
+	User    string `json:"user"`
+	Secret  string `json:"secret"`
+	Muser   string `json:"muser,omitempty"`
+	Msecret string `json:"msecret,omitempty"`
+}
+
+// IscsiAuthGroupAddSecretResponse is "bool": indication of result
+func IscsiAuthGroupAddSecret(ctx context.Context, client Invoker, args IscsiAuthGroupAddSecretArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_auth_group_add_secret", args, &response, WithoutCallLogging())
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiAuthGroupRemoveSecretArgs struct {
+	Tag  int    `json:"tag"`
+	User string `json:"user"`
+}
+
+// IscsiAuthGroupRemoveSecretResponse is "bool": indication of result
+func IscsiAuthGroupRemoveSecret(ctx context.Context, client Invoker, args IscsiAuthGroupRemoveSecretArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_auth_group_remove_secret", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiSetDiscoveryAuthArgs struct {
+	IscsiChap
+}
+
+// IscsiSetDiscoveryAuthResponse is "bool": indication of result
+func IscsiSetDiscoveryAuth(ctx context.Context, client Invoker, args IscsiSetDiscoveryAuthArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_set_discovery_auth", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type IscsiConnection struct {
+	ID             int    `json:"id"`
+	Cid            int    `json:"cid"`
+	Tsih           int    `json:"tsih"`
+	LcoreID        int    `json:"lcore_id"`
+	InitiatorAddr  string `json:"initiator_addr"`
+	TargetAddr     string `json:"target_addr"`
+	TargetNodeName string `json:"target_node_name"`
+}
+
+type IscsiGetConnectionsResponse []IscsiConnection
+
+func IscsiGetConnections(ctx context.Context, client Invoker) (IscsiGetConnectionsResponse, error) {
+	var response IscsiGetConnectionsResponse
+	err := InvokeWithLegacy(ctx, client, "iscsi_get_connections", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type IscsiOptions struct {
+	NodeBase                    string `json:"node_base"`
+	AuthFile                    string `json:"auth_file"`
+	MaxSessions                 int    `json:"max_sessions"`
+	MaxConnectionsPerSession    int    `json:"max_connections_per_session"`
+	MaxQueueDepth               int    `json:"max_queue_depth"`
+	DefaultTime2wait            int    `json:"default_time2wait"`
+	DefaultTime2retain          int    `json:"default_time2retain"`
+	FirstBurstLength            int    `json:"first_burst_length"`
+	ImmediateData               bool   `json:"immediate_data"`
+	AllowDuplicatedIsid         bool   `json:"allow_duplicated_isid"`
+	ErrorRecoveryLevel          int    `json:"error_recovery_level"`
+	NopTimeout                  int    `json:"nop_timeout"`
+	NopInInterval               int    `json:"nop_in_interval"`
+	DisableChap                 bool   `json:"disable_chap"`
+	RequireChap                 bool   `json:"require_chap"`
+	MutualChap                  bool   `json:"mutual_chap"`
+	ChapGroup                   int    `json:"chap_group"`
+	MaxLargeDatainPerConnection int    `json:"max_large_datain_per_connection"`
+	MaxR2tPerConnection         int    `json:"max_r2t_per_connection"`
+	PduPoolSize                 int    `json:"pdu_pool_size"`
+	ImmediateDataPoolSize       int    `json:"immediate_data_pool_size"`
+	DataOutPoolSize             int    `json:"data_out_pool_size"`
+}
+
+// IscsiGetOptionsResponse is IscsiOptions: the global iSCSI options
+func IscsiGetOptions(ctx context.Context, client Invoker) (IscsiOptions, error) {
+	var response IscsiOptions
+	err := InvokeWithLegacy(ctx, client, "iscsi_get_options", nil, &response)
+	if err != nil {
+		return IscsiOptions{}, err
+	}
+	return response, nil
+}
+
+// IscsiSetOptionsArgs are the global iSCSI options. SPDK only accepts
+// them before the iSCSI subsystem is initialized, i.e. when started with
+// --wait-for-rpc. Unset fields keep their default.
+type IscsiSetOptionsArgs struct {
+	NodeBase                 string `json:"node_base,omitempty"`
+	AuthFile                 string `json:"auth_file,omitempty"`
+	MaxSessions              int    `json:"max_sessions,omitempty"`
+	MaxConnectionsPerSession int    `json:"max_connections_per_session,omitempty"`
+	MaxQueueDepth            int    `json:"max_queue_depth,omitempty"`
+	DefaultTime2wait         int    `json:"default_time2wait,omitempty"`
+	DefaultTime2retain       int    `json:"default_time2retain,omitempty"`
+	FirstBurstLength         int    `json:"first_burst_length,omitempty"`
+	// ImmediateData is enabled by default.
+	ImmediateData       *bool `json:"immediate_data,omitempty"`
+	AllowDuplicatedIsid bool  `json:"allow_duplicated_isid,omitempty"`
+	ErrorRecoveryLevel  int   `json:"error_recovery_level,omitempty"`
+	NopTimeout          int   `json:"nop_timeout,omitempty"`
+	NopInInterval       int   `json:"nop_in_interval,omitempty"`
+	// IscsiChap are the settings of discovery sessions.
+	IscsiChap
+	MaxLargeDatainPerConnection int `json:"max_large_datain_per_connection,omitempty"`
+	MaxR2tPerConnection         int `json:"max_r2t_per_connection,omitempty"`
+	PduPoolSize                 int `json:"pdu_pool_size,omitempty"`
+	ImmediateDataPoolSize       int `json:"immediate_data_pool_size,omitempty"`
+	DataOutPoolSize             int `json:"data_out_pool_size,omitempty"`
+}
+
+// IscsiSetOptionsResponse is "bool": indication of result
+func IscsiSetOptions(ctx context.Context, client Invoker, args IscsiSetOptionsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "iscsi_set_options", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
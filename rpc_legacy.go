@@ -0,0 +1,202 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// LegacyMethod describes the name under which SPDK before v20.01
+// provided a method.
+type LegacyMethod struct {
+	Name string
+	// Params converts the params of the current method for the legacy
+	// one. It may modify params, which is nil if there were none. A nil
+	// Params passes them on unchanged.
+	Params func(params map[string]interface{}) (map[string]interface{}, error)
+}
+
+// LegacyMethods maps current method names to their deprecated aliases
+// for InvokeWithLegacy, which is used by the RPC functions of this
+// package. Entries may be added, but not while calls are in progress,
+// typically from an init function.
+var LegacyMethods = map[string]LegacyMethod{
+	"rpc_get_methods":  {Name: "get_rpc_methods", Params: DropParams("include_aliases")},
+	"spdk_get_version": {Name: "get_spdk_version"},
+
+	"notify_get_types":         {Name: "get_notification_types"},
+	"notify_get_notifications": {Name: "get_notifications"},
+
+	"bdev_get_bdevs":     {Name: "get_bdevs"},
+	"bdev_malloc_create": {Name: "construct_malloc_bdev"},
+	"bdev_malloc_delete": {Name: "delete_malloc_bdev"},
+	"bdev_aio_create":    {Name: "construct_aio_bdev"},
+	"bdev_aio_delete":    {Name: "delete_aio_bdev"},
+
+	"bdev_lvol_create_lvstore":  {Name: "construct_lvol_store"},
+	"bdev_lvol_delete_lvstore":  {Name: "destroy_lvol_store"},
+	"bdev_lvol_get_lvstores":    {Name: "get_lvol_stores"},
+	"bdev_lvol_create":          {Name: "construct_lvol_bdev"},
+	"bdev_lvol_delete":          {Name: "destroy_lvol_bdev"},
+	"bdev_lvol_snapshot":        {Name: "snapshot_lvol_bdev"},
+	"bdev_lvol_clone":           {Name: "clone_lvol_bdev"},
+	"bdev_lvol_set_read_only":   {Name: "set_read_only_lvol_bdev"},
+	"bdev_lvol_decouple_parent": {Name: "decouple_parent_lvol_bdev"},
+	"bdev_lvol_resize":          {Name: "resize_lvol_bdev", Params: lvolSizeInBytes},
+	"bdev_lvol_rename":          {Name: "rename_lvol_bdev"},
+	"bdev_lvol_rename_lvstore":  {Name: "rename_lvol_store"},
+	"bdev_lvol_inflate":         {Name: "inflate_lvol_bdev"},
+
+	"bdev_raid_create":    {Name: "construct_raid_bdev"},
+	"bdev_raid_delete":    {Name: "destroy_raid_bdev"},
+	"bdev_raid_get_bdevs": {Name: "get_raid_bdevs"},
+
+	"vhost_create_blk_controller":         {Name: "construct_vhost_blk_controller"},
+	"vhost_delete_controller":             {Name: "remove_vhost_controller"},
+	"vhost_get_controllers":               {Name: "get_vhost_controllers"},
+	"vhost_create_scsi_controller":        {Name: "construct_vhost_scsi_controller"},
+	"vhost_scsi_controller_add_target":    {Name: "add_vhost_scsi_lun"},
+	"vhost_scsi_controller_remove_target": {Name: "remove_vhost_scsi_target"},
+	"vhost_controller_set_coalescing":     {Name: "set_vhost_controller_coalescing"},
+
+	"bdev_virtio_attach_controller": {Name: "construct_virtio_dev"},
+	"bdev_virtio_detach_controller": {Name: "remove_virtio_bdev"},
+	"bdev_virtio_scsi_get_devices":  {Name: "get_virtio_scsi_devs"},
+
+	"nbd_start_disk": {Name: "start_nbd_disk"},
+	"nbd_get_disks":  {Name: "get_nbd_disks"},
+	"nbd_stop_disk":  {Name: "stop_nbd_disk"},
+
+	"bdev_nvme_attach_controller": {Name: "construct_nvme_bdev"},
+	"bdev_nvme_detach_controller": {Name: "delete_nvme_controller"},
+	"bdev_nvme_get_controllers":   {Name: "get_nvme_controllers"},
+	"bdev_nvme_set_options": {
+		Name:   "set_bdev_nvme_options",
+		Params: RenameParams(map[string]string{"transport_retry_count": "retry_count"}),
+	},
+	"bdev_nvme_set_hotplug": {Name: "set_bdev_nvme_hotplug"},
+
+	"nvmf_create_subsystem": {Name: "nvmf_subsystem_create"},
+	"nvmf_delete_subsystem": {Name: "delete_nvmf_subsystem"},
+	"nvmf_get_subsystems":   {Name: "get_nvmf_subsystems"},
+
+	"iscsi_create_portal_group":               {Name: "add_portal_group"},
+	"iscsi_delete_portal_group":               {Name: "delete_portal_group"},
+	"iscsi_get_portal_groups":                 {Name: "get_portal_groups"},
+	"iscsi_create_initiator_group":            {Name: "add_initiator_group"},
+	"iscsi_delete_initiator_group":            {Name: "delete_initiator_group"},
+	"iscsi_get_initiator_groups":              {Name: "get_initiator_groups"},
+	"iscsi_initiator_group_add_initiators":    {Name: "add_initiators_to_initiator_group"},
+	"iscsi_initiator_group_remove_initiators": {Name: "delete_initiators_from_initiator_group"},
+	"iscsi_create_target_node":                {Name: "construct_target_node"},
+	"iscsi_delete_target_node":                {Name: "delete_target_node"},
+	"iscsi_get_target_nodes":                  {Name: "get_target_nodes"},
+	"iscsi_target_node_add_lun":               {Name: "target_node_add_lun"},
+	"iscsi_target_node_add_pg_ig_maps":        {Name: "add_pg_ig_maps"},
+	"iscsi_target_node_remove_pg_ig_maps":     {Name: "delete_pg_ig_maps"},
+	"iscsi_target_node_set_auth":              {Name: "set_iscsi_target_node_auth"},
+	"iscsi_create_auth_group":                 {Name: "add_iscsi_auth_group"},
+	"iscsi_delete_auth_group":                 {Name: "delete_iscsi_auth_group"},
+	"iscsi_get_auth_groups":                   {Name: "get_iscsi_auth_groups"},
+	"iscsi_auth_group_add_secret":             {Name: "add_secret_to_iscsi_auth_group"},
+	"iscsi_auth_group_remove_secret":          {Name: "delete_secret_from_iscsi_auth_group"},
+	"iscsi_set_discovery_auth":                {Name: "set_iscsi_discovery_auth"},
+	"iscsi_get_connections":                   {Name: "get_iscsi_connections"},
+	"iscsi_get_options":                       {Name: "get_iscsi_global_params"},
+	"iscsi_set_options":                       {Name: "set_iscsi_options"},
+}
+
+// DropParams returns a LegacyMethod.Params which removes params
+// unknown to the legacy method.
+func DropParams(names ...string) func(params map[string]interface{}) (map[string]interface{}, error) {
+	return func(params map[string]interface{}) (map[string]interface{}, error) {
+		for _, name := range names {
+			delete(params, name)
+		}
+		return params, nil
+	}
+}
+
+// RenameParams returns a LegacyMethod.Params which renames params,
+// mapping current to legacy names.
+func RenameParams(names map[string]string) func(params map[string]interface{}) (map[string]interface{}, error) {
+	return func(params map[string]interface{}) (map[string]interface{}, error) {
+		for current, legacy := range names {
+			if value, ok := params[current]; ok {
+				delete(params, current)
+				params[legacy] = value
+			}
+		}
+		return params, nil
+	}
+}
+
+// InvokeWithLegacy calls method like Invoker.Invoke. If SPDK reports
+// ERROR_METHOD_NOT_FOUND and LegacyMethods has an entry for method, the
+// legacy method is called instead, with translated params. This costs an
+// additional round-trip for each call to old SPDK versions, unless
+// Client.Capabilities was called, which makes the first call fail fast.
+// options are used by clients implementing CallInvoker.
+func InvokeWithLegacy(ctx context.Context, client Invoker, method string, args, reply interface{}, options ...CallOption) error {
+	err := invoke(ctx, client, method, args, reply, options)
+	if !errors.Is(err, ErrMethodNotFound) {
+		return err
+	}
+	legacy, ok := LegacyMethods[method]
+	if !ok {
+		return err
+	}
+
+	legacyArgs := args
+	if legacy.Params != nil {
+		params, err := paramsMap(args)
+		if err != nil {
+			return err
+		}
+		params, err = legacy.Params(params)
+		if err != nil {
+			return err
+		}
+		legacyArgs = nil
+		if len(params) > 0 {
+			legacyArgs = params
+		}
+	}
+
+	if legacyErr := invoke(ctx, client, legacy.Name, legacyArgs, reply, options); !errors.Is(legacyErr, ErrMethodNotFound) {
+		return legacyErr
+	}
+	// Neither name is known, report the current one.
+	return err
+}
+
+// invoke passes options to clients which take them.
+func invoke(ctx context.Context, client Invoker, method string, args, reply interface{}, options []CallOption) error {
+	if c, ok := client.(CallInvoker); ok && len(options) > 0 {
+		return c.Call(ctx, method, args, reply, options...)
+	}
+	return client.Invoke(ctx, method, args, reply)
+}
+
+// paramsMap converts args to their JSON object representation.
+func paramsMap(args interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	var params map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers like 64 bit sizes exact.
+	dec.UseNumber()
+	if err := dec.Decode(&params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
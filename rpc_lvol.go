@@ -10,9 +10,23 @@ package spdkctrl
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 )
 
+// checkLvstoreSelector checks that a logical volume store is selected
+// by either uuid or lvs_name, but not both. Unless required, selecting
+// none is fine too.
+func checkLvstoreSelector(uuid, lvsName string, required bool) error {
+	if lvsName != "" && uuid != "" {
+		return fmt.Errorf("invalid parameters")
+	}
+	if required && lvsName == "" && uuid == "" {
+		return fmt.Errorf("invalid parameters")
+	}
+	return nil
+}
+
 type BdevLvolCreateLvstoreArgs struct {
 	BdevName  string `json:"bdev_name"`
 	LvsName   string `json:"lvs_name"`
@@ -22,9 +36,9 @@ type BdevLvolCreateLvstoreArgs struct {
 }
 
 //BdevLvolCreateLvstoreResponse is "string": UUID of the created logical volume store
-func BdevLvolCreateLvstore(ctx context.Context, client *Client, args BdevLvolCreateLvstoreArgs) (string, error) {
+func BdevLvolCreateLvstore(ctx context.Context, client Invoker, args BdevLvolCreateLvstoreArgs) (string, error) {
 	var response string
-	err := client.Invoke(ctx, "bdev_lvol_create_lvstore", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_create_lvstore", args, &response)
 	if err != nil {
 		return "", err
 	}
@@ -38,17 +52,14 @@ type BdevLvolDeleteLvstoreArgs struct {
 }
 
 //BdevLvolDeleteLvstoreResponse is "bool": indication of delete result
-func BdevLvolDeleteLvstore(ctx context.Context, client *Client, args BdevLvolDeleteLvstoreArgs) (bool, error) {
+func BdevLvolDeleteLvstore(ctx context.Context, client Invoker, args BdevLvolDeleteLvstoreArgs) (bool, error) {
 	var response bool
 
-	if args.LvsName == "" && args.Uuid == "" {
-		return false, fmt.Errorf("invalid parameters")
-	}
-	if args.LvsName != "" && args.Uuid != "" {
-		return false, fmt.Errorf("invalid parameters")
+	if err := checkLvstoreSelector(args.Uuid, args.LvsName, true); err != nil {
+		return false, err
 	}
 
-	err := client.Invoke(ctx, "bdev_lvol_delete_lvstore", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_delete_lvstore", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -75,18 +86,18 @@ type Lvstore struct {
 
 type BdevLvolGetLvstoresResponse []Lvstore
 
-func BdevLvolGetLvstores(ctx context.Context, client *Client, args BdevLvolGetLvstoresArgs) (BdevLvolGetLvstoresResponse, error) {
+func BdevLvolGetLvstores(ctx context.Context, client Invoker, args BdevLvolGetLvstoresArgs) (BdevLvolGetLvstoresResponse, error) {
 	var response BdevLvolGetLvstoresResponse
 
-	if args.LvsName != "" && args.Uuid != "" {
-		return nil, fmt.Errorf("invalid parameters")
+	if err := checkLvstoreSelector(args.Uuid, args.LvsName, false); err != nil {
+		return nil, err
 	}
 
 	var err error
 	if args.LvsName == "" && args.Uuid == "" {
-		err = client.Invoke(ctx, "bdev_lvol_get_lvstores", nil, &response)
+		err = InvokeWithLegacy(ctx, client, "bdev_lvol_get_lvstores", nil, &response)
 	} else {
-		err = client.Invoke(ctx, "bdev_lvol_get_lvstores", args, &response)
+		err = InvokeWithLegacy(ctx, client, "bdev_lvol_get_lvstores", args, &response)
 	}
 
 	if err != nil {
@@ -108,9 +119,9 @@ type BdevLvolCreateArgs struct {
 }
 
 //BdevLvolCreateResponse is "string": UUID of the created logical volume is returned.
-func BdevLvolCreate(ctx context.Context, client *Client, args BdevLvolCreateArgs) (string, error) {
+func BdevLvolCreate(ctx context.Context, client Invoker, args BdevLvolCreateArgs) (string, error) {
 	var response string
-	err := client.Invoke(ctx, "bdev_lvol_create", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_create", args, &response)
 	if err != nil {
 		return "", err
 	}
@@ -123,9 +134,9 @@ type BdevLvolDeleteArgs struct {
 }
 
 //BdevLvolDeleteResponse is "bool": indication of delete result
-func BdevLvolDelete(ctx context.Context, client *Client, args BdevLvolDeleteArgs) (bool, error) {
+func BdevLvolDelete(ctx context.Context, client Invoker, args BdevLvolDeleteArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "bdev_lvol_delete", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_delete", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -139,9 +150,9 @@ type BdevLvolSnapshotArgs struct {
 }
 
 //BdevLvolSnapshotResponse is "string": UUID of the created logical volume snapshot is returned.
-func BdevLvolSnapshot(ctx context.Context, client *Client, args BdevLvolSnapshotArgs) (string, error) {
+func BdevLvolSnapshot(ctx context.Context, client Invoker, args BdevLvolSnapshotArgs) (string, error) {
 	var response string
-	err := client.Invoke(ctx, "bdev_lvol_snapshot", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_snapshot", args, &response)
 	if err != nil {
 		return "", err
 	}
@@ -155,9 +166,9 @@ type BdevLvolCloneArgs struct {
 }
 
 //BdevLvolCloneResponse is "string": UUID of the created logical volume clone is returned.
-func BdevLvolClone(ctx context.Context, client *Client, args BdevLvolCloneArgs) (string, error) {
+func BdevLvolClone(ctx context.Context, client Invoker, args BdevLvolCloneArgs) (string, error) {
 	var response string
-	err := client.Invoke(ctx, "bdev_lvol_clone", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_clone", args, &response)
 	if err != nil {
 		return "", err
 	}
@@ -170,9 +181,9 @@ type BdevLvolSetReadOnlyArgs struct {
 }
 
 //BdevLvolSetReadOnlyResponse is "bool": result
-func BdevLvolSetReadOnly(ctx context.Context, client *Client, args BdevLvolSetReadOnlyArgs) (bool, error) {
+func BdevLvolSetReadOnly(ctx context.Context, client Invoker, args BdevLvolSetReadOnlyArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "bdev_lvol_set_read_only", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_set_read_only", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -185,11 +196,199 @@ type BdevLvolDecoupleParentArgs struct {
 }
 
 //BdevLvolDecoupleParentResponse is "bool": result
-func BdevLvolDecoupleParent(ctx context.Context, client *Client, args BdevLvolDecoupleParentArgs) (bool, error) {
+func BdevLvolDecoupleParent(ctx context.Context, client Invoker, args BdevLvolDecoupleParentArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_decouple_parent", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, err
+}
+
+type BdevLvolResizeArgs struct {
+	//UUID or alias of the logical volume to resize
+	Name string `json:"name"`
+	//Set either Size in bytes or, since SPDK v23.01, SizeInMib.
+	//The size will be rounded up to a multiple of cluster size.
+	//Pointers, as resizing to 0 is allowed.
+	Size      *int64 `json:"size,omitempty"`
+	SizeInMib *int64 `json:"size_in_mib,omitempty"`
+}
+
+// lvolSizeInBytes converts size_in_mib for legacy methods,
+// which only take the size in bytes.
+func lvolSizeInBytes(params map[string]interface{}) (map[string]interface{}, error) {
+	mib, ok := params["size_in_mib"].(json.Number)
+	if !ok {
+		return params, nil
+	}
+	n, err := mib.Int64()
+	if err != nil {
+		return nil, err
+	}
+	delete(params, "size_in_mib")
+	params["size"] = n * 1024 * 1024
+	return params, nil
+}
+
+// BdevLvolResizeResponse is "bool": result
+func BdevLvolResize(ctx context.Context, client Invoker, args BdevLvolResizeArgs) (bool, error) {
+	var response bool
+
+	if (args.Size == nil) == (args.SizeInMib == nil) {
+		return false, fmt.Errorf("invalid parameters")
+	}
+
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_resize", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, err
+}
+
+type BdevLvolRenameArgs struct {
+	//UUID or alias of the logical volume to rename
+	OldName string `json:"old_name"`
+	//New name of the logical volume, without the name of its store
+	NewName string `json:"new_name"`
+}
+
+// BdevLvolRenameResponse is "bool": result
+func BdevLvolRename(ctx context.Context, client Invoker, args BdevLvolRenameArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_rename", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, err
+}
+
+type BdevLvolRenameLvstoreArgs struct {
+	//Name of the logical volume store, which also changes the aliases of its volumes
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name"`
+}
+
+// BdevLvolRenameLvstoreResponse is "bool": result
+func BdevLvolRenameLvstore(ctx context.Context, client Invoker, args BdevLvolRenameLvstoreArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "bdev_lvol_decouple_parent", args, &response)
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_rename_lvstore", args, &response)
 	if err != nil {
 		return false, err
 	}
 	return response, err
 }
+
+type BdevLvolInflateArgs struct {
+	//UUID or alias of the logical volume to inflate. All its clusters
+	//get allocated and it no longer depends on a parent snapshot.
+	Name string `json:"name"`
+}
+
+// BdevLvolInflateResponse is "bool": result
+func BdevLvolInflate(ctx context.Context, client Invoker, args BdevLvolInflateArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_inflate", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, err
+}
+
+type BdevLvolGrowLvstoreArgs struct {
+	//Either uuid or lvs_name must be specified, but not both.
+	Uuid    string `json:"uuid,omitempty"`
+	LvsName string `json:"lvs_name,omitempty"`
+}
+
+// BdevLvolGrowLvstoreResponse is "bool": result.
+// The logical volume store grows to the size of its base bdev.
+func BdevLvolGrowLvstore(ctx context.Context, client Invoker, args BdevLvolGrowLvstoreArgs) (bool, error) {
+	var response bool
+
+	if err := checkLvstoreSelector(args.Uuid, args.LvsName, true); err != nil {
+		return false, err
+	}
+
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_grow_lvstore", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, err
+}
+
+type BdevLvolGetLvolsArgs struct {
+	//Either lvs_uuid or lvs_name may be specified, but not both.
+	//If both are omitted, the logical volumes of all stores are returned
+	LvsUuid string `json:"lvs_uuid,omitempty"`
+	LvsName string `json:"lvs_name,omitempty"`
+}
+
+type LvolLvstore struct {
+	Name string `json:"name"`
+	Uuid string `json:"uuid"`
+}
+
+// Lvol is a logical volume. The snapshot a clone was created from and
+// the clones of a snapshot are in the driver specific information of
+// its bdev, see Bdev.Lvol.
+type Lvol struct {
+	Alias             string      `json:"alias"`
+	Uuid              string      `json:"uuid"`
+	Name              string      `json:"name"`
+	IsThinProvisioned bool        `json:"is_thin_provisioned"`
+	IsSnapshot        bool        `json:"is_snapshot"`
+	IsClone           bool        `json:"is_clone"`
+	IsEsnapClone      bool        `json:"is_esnap_clone"`
+	IsDegraded        bool        `json:"is_degraded"`
+	Lvs               LvolLvstore `json:"lvs"`
+}
+
+type BdevLvolGetLvolsResponse []Lvol
+
+func BdevLvolGetLvols(ctx context.Context, client Invoker, args BdevLvolGetLvolsArgs) (BdevLvolGetLvolsResponse, error) {
+	var response BdevLvolGetLvolsResponse
+
+	if err := checkLvstoreSelector(args.LvsUuid, args.LvsName, false); err != nil {
+		return nil, err
+	}
+
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_get_lvols", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, err
+}
+
+type BdevLvolSetXattrArgs struct {
+	//UUID or alias of the logical volume
+	Name       string `json:"name"`
+	XattrName  string `json:"xattr_name"`
+	XattrValue string `json:"xattr_value"`
+}
+
+// BdevLvolSetXattrResponse is "bool": result
+func BdevLvolSetXattr(ctx context.Context, client Invoker, args BdevLvolSetXattrArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_set_xattr", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, err
+}
+
+type BdevLvolGetXattrArgs struct {
+	//UUID or alias of the logical volume
+	Name      string `json:"name"`
+	XattrName string `json:"xattr_name"`
+}
+
+// BdevLvolGetXattrResponse is "string": value of the extended attribute
+func BdevLvolGetXattr(ctx context.Context, client Invoker, args BdevLvolGetXattrArgs) (string, error) {
+	var response string
+	err := InvokeWithLegacy(ctx, client, "bdev_lvol_get_xattr", args, &response)
+	if err != nil {
+		return "", err
+	}
+	return response, err
+}
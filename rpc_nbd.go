@@ -22,16 +22,16 @@ type nbdStartDiskOptArgs struct {
 }
 
 //NbdStartDiskResponse is string: path of exported Nbd disk.
-func NbdStartDisk(ctx context.Context, client *Client, args NbdStartDiskArgs) (string, error) {
+func NbdStartDisk(ctx context.Context, client Invoker, args NbdStartDiskArgs) (string, error) {
 	var response string
 	var err error
 	if args.NbdDevice == "" {
 		optArgs := nbdStartDiskOptArgs{
 			BdevName: args.BdevName}
 
-		err = client.Invoke(ctx, "nbd_start_disk", optArgs, &response)
+		err = InvokeWithLegacy(ctx, client, "nbd_start_disk", optArgs, &response)
 	} else {
-		err = client.Invoke(ctx, "nbd_start_disk", args, &response)
+		err = InvokeWithLegacy(ctx, client, "nbd_start_disk", args, &response)
 	}
 
 	if err != nil {
@@ -46,9 +46,9 @@ type NbdGetDisksArgs struct {
 
 type NbdGetDisksResponse []NbdStartDiskArgs
 
-func NbdGetDisks(ctx context.Context, client *Client, args NbdGetDisksArgs) (NbdGetDisksResponse, error) {
+func NbdGetDisks(ctx context.Context, client Invoker, args NbdGetDisksArgs) (NbdGetDisksResponse, error) {
 	var response NbdGetDisksResponse
-	err := client.Invoke(ctx, "nbd_get_disks", args, &response)
+	err := InvokeWithLegacy(ctx, client, "nbd_get_disks", args, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -60,9 +60,9 @@ type NbdStopDiskArgs struct {
 }
 
 //NbdStopDiskResponse is "bool": indication of result
-func NbdStopDisk(ctx context.Context, client *Client, args NbdStopDiskArgs) (bool, error) {
+func NbdStopDisk(ctx context.Context, client Invoker, args NbdStopDiskArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "nbd_stop_disk", args, &response)
+	err := InvokeWithLegacy(ctx, client, "nbd_stop_disk", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+)
+
+// Notification types emitted by SPDK.
+const (
+	NotificationBdevRegister   = "bdev_register"
+	NotificationBdevUnregister = "bdev_unregister"
+)
+
+// NotifyGetTypesResponse is []string: the notification types SPDK can emit.
+func NotifyGetTypes(ctx context.Context, client Invoker) ([]string, error) {
+	var response []string
+	err := InvokeWithLegacy(ctx, client, "notify_get_types", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// NotifyGetNotificationsArgs selects notifications starting with ID.
+// Max limits their number, 0 means no limit.
+type NotifyGetNotificationsArgs struct {
+	ID  uint64 `json:"id"`
+	Max uint64 `json:"max,omitempty"`
+}
+
+// Notification is an event like the registration of a bdev. Ctx
+// identifies the object, for bdev notifications the name of the bdev.
+type Notification struct {
+	Type string `json:"type"`
+	Ctx  string `json:"ctx"`
+	ID   uint64 `json:"id"`
+
+	// Gap is only set by Client.WatchNotifications, on an otherwise
+	// empty Notification which reports that notifications were lost.
+	Gap bool `json:"-"`
+}
+
+type NotifyGetNotificationsResponse []Notification
+
+func NotifyGetNotifications(ctx context.Context, client Invoker, args NotifyGetNotificationsArgs) (NotifyGetNotificationsResponse, error) {
+	var response NotifyGetNotificationsResponse
+	err := InvokeWithLegacy(ctx, client, "notify_get_notifications", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
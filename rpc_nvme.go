@@ -0,0 +1,285 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// NVMe transport types.
+const (
+	NvmeTransportPCIe = "PCIe"
+	NvmeTransportTCP  = "TCP"
+	NvmeTransportRDMA = "RDMA"
+)
+
+// Multipath modes of bdev_nvme_attach_controller.
+const (
+	// NvmeMultipathDisable rejects a second path under the same name.
+	NvmeMultipathDisable = "disable"
+	// NvmeMultipathFailover adds an alternate path used only
+	// when the active one fails.
+	NvmeMultipathFailover = "failover"
+	// NvmeMultipathMultipath adds a path used at the same time,
+	// see bdev_nvme_set_multipath_policy.
+	NvmeMultipathMultipath = "multipath"
+)
+
+// Policies of bdev_nvme_set_multipath_policy.
+const (
+	// NvmeMultipathPolicyActivePassive submits I/O to one path at a time.
+	NvmeMultipathPolicyActivePassive = "active_passive"
+	// NvmeMultipathPolicyActiveActive spreads I/O over all optimized
+	// paths, using the selector.
+	NvmeMultipathPolicyActiveActive = "active_active"
+
+	NvmeMultipathSelectorRoundRobin = "round_robin"
+	NvmeMultipathSelectorQueueDepth = "queue_depth"
+)
+
+type BdevNvmeAttachControllerArgs struct {
+	// Name of the controller, bdevs get named <Name>n<nsid>.
+	Name   string `json:"name"`
+	Trtype string `json:"trtype"`
+	// Traddr is the PCI address like 0000:00:04.0 for PCIe,
+	// the IP address otherwise.
+	Traddr  string `json:"traddr"`
+	Adrfam  string `json:"adrfam,omitempty"`
+	Trsvcid string `json:"trsvcid,omitempty"`
+	Subnqn  string `json:"subnqn,omitempty"`
+	// Hostnqn, Hostaddr and Hostsvcid identify the host for NVMe-oF.
+	Hostnqn   string `json:"hostnqn,omitempty"`
+	Hostaddr  string `json:"hostaddr,omitempty"`
+	Hostsvcid string `json:"hostsvcid,omitempty"`
+	// PrchkReftag and PrchkGuard enable end-to-end data protection checks.
+	PrchkReftag bool `json:"prchk_reftag,omitempty"`
+	PrchkGuard  bool `json:"prchk_guard,omitempty"`
+	// Hdgst and Ddgst enable header and data digests for TCP.
+	Hdgst bool `json:"hdgst,omitempty"`
+	Ddgst bool `json:"ddgst,omitempty"`
+	// Multipath is one of the NvmeMultipath modes, the default is disable.
+	Multipath               string `json:"multipath,omitempty"`
+	FabricsConnectTimeoutUs int64  `json:"fabrics_connect_timeout_us,omitempty"`
+	NumIoQueues             int    `json:"num_io_queues,omitempty"`
+	CtrlrLossTimeoutSec     int    `json:"ctrlr_loss_timeout_sec,omitempty"`
+	ReconnectDelaySec       int    `json:"reconnect_delay_sec,omitempty"`
+	FastIoFailTimeoutSec    int    `json:"fast_io_fail_timeout_sec,omitempty"`
+}
+
+// BdevNvmeAttachControllerResponse is []string: names of the bdevs created
+// for the namespaces of the controller.
+func BdevNvmeAttachController(ctx context.Context, client Invoker, args BdevNvmeAttachControllerArgs) ([]string, error) {
+	var response []string
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_attach_controller", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// BdevNvmeDetachControllerArgs detaches all paths of the controller,
+// or only the path matching the transport fields which are set.
+type BdevNvmeDetachControllerArgs struct {
+	Name      string `json:"name"`
+	Trtype    string `json:"trtype,omitempty"`
+	Traddr    string `json:"traddr,omitempty"`
+	Adrfam    string `json:"adrfam,omitempty"`
+	Trsvcid   string `json:"trsvcid,omitempty"`
+	Subnqn    string `json:"subnqn,omitempty"`
+	Hostaddr  string `json:"hostaddr,omitempty"`
+	Hostsvcid string `json:"hostsvcid,omitempty"`
+}
+
+// BdevNvmeDetachControllerResponse is "bool": indication of result
+func BdevNvmeDetachController(ctx context.Context, client Invoker, args BdevNvmeDetachControllerArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_detach_controller", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type BdevNvmeGetControllersArgs struct {
+	Name string `json:"name,omitempty"`
+}
+
+type NvmeControllerHost struct {
+	Nqn   string `json:"nqn"`
+	Addr  string `json:"addr,omitempty"`
+	Svcid string `json:"svcid,omitempty"`
+}
+
+// NvmeControllerPath is one path of a controller.
+type NvmeControllerPath struct {
+	// State is e.g. "enabled", "resetting" or "failed".
+	State  string             `json:"state"`
+	Trid   NvmeTransportID    `json:"trid"`
+	Cntlid int                `json:"cntlid"`
+	Host   NvmeControllerHost `json:"host"`
+}
+
+type NvmeController struct {
+	Name   string               `json:"name"`
+	Ctrlrs []NvmeControllerPath `json:"ctrlrs"`
+}
+
+// UnmarshalJSON also accepts the format of SPDK before v21.07,
+// which reports the only path as trid of the controller.
+func (c *NvmeController) UnmarshalJSON(data []byte) error {
+	type nvmeController NvmeController
+	var controller struct {
+		nvmeController
+		Trid *NvmeTransportID `json:"trid"`
+	}
+	if err := json.Unmarshal(data, &controller); err != nil {
+		return err
+	}
+	*c = NvmeController(controller.nvmeController)
+	if len(c.Ctrlrs) == 0 && controller.Trid != nil {
+		c.Ctrlrs = []NvmeControllerPath{{Trid: *controller.Trid}}
+	}
+	return nil
+}
+
+type BdevNvmeGetControllersResponse []NvmeController
+
+func BdevNvmeGetControllers(ctx context.Context, client Invoker, args BdevNvmeGetControllersArgs) (BdevNvmeGetControllersResponse, error) {
+	var response BdevNvmeGetControllersResponse
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_get_controllers", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type BdevNvmeResetControllerArgs struct {
+	Name string `json:"name"`
+}
+
+// BdevNvmeResetControllerResponse is "bool": indication of result
+func BdevNvmeResetController(ctx context.Context, client Invoker, args BdevNvmeResetControllerArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_reset_controller", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// BdevNvmeSetOptionsArgs are global options of the NVMe bdev module.
+// SPDK only accepts them before the first controller is attached.
+// Unset fields keep their current value.
+type BdevNvmeSetOptionsArgs struct {
+	// ActionOnTimeout is one of none, reset or abort.
+	ActionOnTimeout        string `json:"action_on_timeout,omitempty"`
+	TimeoutUs              int64  `json:"timeout_us,omitempty"`
+	TimeoutAdminUs         int64  `json:"timeout_admin_us,omitempty"`
+	KeepAliveTimeoutMs     int64  `json:"keep_alive_timeout_ms,omitempty"`
+	TransportRetryCount    *int   `json:"transport_retry_count,omitempty"`
+	ArbitrationBurst       int    `json:"arbitration_burst,omitempty"`
+	LowPriorityWeight      int    `json:"low_priority_weight,omitempty"`
+	MediumPriorityWeight   int    `json:"medium_priority_weight,omitempty"`
+	HighPriorityWeight     int    `json:"high_priority_weight,omitempty"`
+	NvmeAdminqPollPeriodUs int64  `json:"nvme_adminq_poll_period_us,omitempty"`
+	NvmeIoqPollPeriodUs    int64  `json:"nvme_ioq_poll_period_us,omitempty"`
+	IoQueueRequests        int    `json:"io_queue_requests,omitempty"`
+	DelayCmdSubmit         *bool  `json:"delay_cmd_submit,omitempty"`
+	BdevRetryCount         *int   `json:"bdev_retry_count,omitempty"`
+	TransportAckTimeout    int    `json:"transport_ack_timeout,omitempty"`
+	CtrlrLossTimeoutSec    int    `json:"ctrlr_loss_timeout_sec,omitempty"`
+	ReconnectDelaySec      int    `json:"reconnect_delay_sec,omitempty"`
+	FastIoFailTimeoutSec   int    `json:"fast_io_fail_timeout_sec,omitempty"`
+	GenerateUUIDs          bool   `json:"generate_uuids,omitempty"`
+}
+
+// BdevNvmeSetOptionsResponse is "bool": indication of result
+func BdevNvmeSetOptions(ctx context.Context, client Invoker, args BdevNvmeSetOptionsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_set_options", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type BdevNvmeSetHotplugArgs struct {
+	Enable bool `json:"enable"`
+	// PeriodUs is the interval of hotplug polling, SPDK
+	// defaults to 100000.
+	PeriodUs int64 `json:"period_us,omitempty"`
+}
+
+// BdevNvmeSetHotplugResponse is "bool": indication of result
+func BdevNvmeSetHotplug(ctx context.Context, client Invoker, args BdevNvmeSetHotplugArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_set_hotplug", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type BdevNvmeGetIoPathsArgs struct {
+	// Name of a NVMe bdev, all are reported if empty.
+	Name string `json:"name,omitempty"`
+}
+
+// NvmeIoPath is a path of a NVMe bdev through one controller.
+type NvmeIoPath struct {
+	BdevName string `json:"bdev_name"`
+	Cntlid   int    `json:"cntlid"`
+	// Current tells whether I/O is submitted to the path.
+	Current   bool `json:"current"`
+	Connected bool `json:"connected"`
+	// Accessible is false while the ANA state of the namespace
+	// is inaccessible, persistent loss or change.
+	Accessible bool            `json:"accessible"`
+	Transport  NvmeTransportID `json:"transport"`
+}
+
+type NvmePollGroupIoPaths struct {
+	Thread  string       `json:"thread"`
+	IoPaths []NvmeIoPath `json:"io_paths"`
+}
+
+type BdevNvmeGetIoPathsResponse struct {
+	PollGroups []NvmePollGroupIoPaths `json:"poll_groups"`
+}
+
+func BdevNvmeGetIoPaths(ctx context.Context, client Invoker, args BdevNvmeGetIoPathsArgs) (BdevNvmeGetIoPathsResponse, error) {
+	var response BdevNvmeGetIoPathsResponse
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_get_io_paths", args, &response)
+	if err != nil {
+		return BdevNvmeGetIoPathsResponse{}, err
+	}
+	return response, nil
+}
+
+type BdevNvmeSetMultipathPolicyArgs struct {
+	// Name of the NVMe bdev.
+	Name string `json:"name"`
+	// Policy is one of the NvmeMultipathPolicy constants.
+	Policy string `json:"policy"`
+	// Selector is one of the NvmeMultipathSelector constants,
+	// only for NvmeMultipathPolicyActiveActive.
+	Selector string `json:"selector,omitempty"`
+	// RrMinIo is the number of I/Os submitted to a path before
+	// round robin switches to the next one.
+	RrMinIo int `json:"rr_min_io,omitempty"`
+}
+
+// BdevNvmeSetMultipathPolicyResponse is "bool": indication of result
+func BdevNvmeSetMultipathPolicy(ctx context.Context, client Invoker, args BdevNvmeSetMultipathPolicyArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_nvme_set_multipath_policy", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
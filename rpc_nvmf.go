@@ -0,0 +1,417 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+)
+
+// Subtypes of NVMe-oF subsystems.
+const (
+	NvmfSubtypeDiscovery = "Discovery"
+	NvmfSubtypeNVMe      = "NVMe"
+)
+
+// NvmfDiscoveryNqn is the NQN of the discovery subsystem,
+// which SPDK always creates.
+const NvmfDiscoveryNqn = "nqn.2014-08.org.nvmexpress.discovery"
+
+type NvmfCreateTransportArgs struct {
+	// Trtype is NvmeTransportTCP or NvmeTransportRDMA.
+	Trtype              string `json:"trtype"`
+	TgtName             string `json:"tgt_name,omitempty"`
+	MaxQueueDepth       int    `json:"max_queue_depth,omitempty"`
+	MaxIoQpairsPerCtrlr int    `json:"max_io_qpairs_per_ctrlr,omitempty"`
+	InCapsuleDataSize   int    `json:"in_capsule_data_size,omitempty"`
+	MaxIoSize           int    `json:"max_io_size,omitempty"`
+	IoUnitSize          int    `json:"io_unit_size,omitempty"`
+	MaxAqDepth          int    `json:"max_aq_depth,omitempty"`
+	NumSharedBuffers    int    `json:"num_shared_buffers,omitempty"`
+	BufCacheSize        int    `json:"buf_cache_size,omitempty"`
+	DifInsertOrStrip    bool   `json:"dif_insert_or_strip,omitempty"`
+	// C2hSuccess is TCP only, SPDK enables it by default.
+	C2hSuccess      *bool `json:"c2h_success,omitempty"`
+	SockPriority    int   `json:"sock_priority,omitempty"`
+	AbortTimeoutSec int   `json:"abort_timeout_sec,omitempty"`
+	Zcopy           bool  `json:"zcopy,omitempty"`
+}
+
+// NvmfCreateTransportResponse is "bool": indication of result
+func NvmfCreateTransport(ctx context.Context, client Invoker, args NvmfCreateTransportArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_create_transport", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfGetTransportsArgs struct {
+	Trtype  string `json:"trtype,omitempty"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+type NvmfTransport struct {
+	Trtype              string `json:"trtype"`
+	MaxQueueDepth       int    `json:"max_queue_depth"`
+	MaxIoQpairsPerCtrlr int    `json:"max_io_qpairs_per_ctrlr"`
+	InCapsuleDataSize   int    `json:"in_capsule_data_size"`
+	MaxIoSize           int    `json:"max_io_size"`
+	IoUnitSize          int    `json:"io_unit_size"`
+	MaxAqDepth          int    `json:"max_aq_depth"`
+	NumSharedBuffers    int    `json:"num_shared_buffers"`
+	BufCacheSize        int    `json:"buf_cache_size"`
+	DifInsertOrStrip    bool   `json:"dif_insert_or_strip"`
+	C2hSuccess          bool   `json:"c2h_success,omitempty"`
+	SockPriority        int    `json:"sock_priority,omitempty"`
+	AbortTimeoutSec     int    `json:"abort_timeout_sec"`
+	Zcopy               bool   `json:"zcopy,omitempty"`
+}
+
+type NvmfGetTransportsResponse []NvmfTransport
+
+func NvmfGetTransports(ctx context.Context, client Invoker, args NvmfGetTransportsArgs) (NvmfGetTransportsResponse, error) {
+	var response NvmfGetTransportsResponse
+	err := InvokeWithLegacy(ctx, client, "nvmf_get_transports", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type NvmfCreateSubsystemArgs struct {
+	Nqn          string `json:"nqn"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	ModelNumber  string `json:"model_number,omitempty"`
+	TgtName      string `json:"tgt_name,omitempty"`
+	// AllowAnyHost lets hosts connect without nvmf_subsystem_add_host.
+	AllowAnyHost  bool `json:"allow_any_host,omitempty"`
+	MaxNamespaces int  `json:"max_namespaces,omitempty"`
+	// AnaReporting is needed for nvmf_subsystem_listener_set_ana_state.
+	AnaReporting bool `json:"ana_reporting,omitempty"`
+	MinCntlid    int  `json:"min_cntlid,omitempty"`
+	MaxCntlid    int  `json:"max_cntlid,omitempty"`
+}
+
+// NvmfCreateSubsystemResponse is "bool": indication of result
+func NvmfCreateSubsystem(ctx context.Context, client Invoker, args NvmfCreateSubsystemArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_create_subsystem", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfDeleteSubsystemArgs struct {
+	Nqn     string `json:"nqn"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+// NvmfDeleteSubsystemResponse is "bool": indication of result
+func NvmfDeleteSubsystem(ctx context.Context, client Invoker, args NvmfDeleteSubsystemArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_delete_subsystem", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfListenAddress struct {
+	Trtype string `json:"trtype"`
+	// Adrfam is IPv4, IPv6, IB or FC, SPDK defaults to IPv4.
+	Adrfam  string `json:"adrfam,omitempty"`
+	Traddr  string `json:"traddr"`
+	Trsvcid string `json:"trsvcid,omitempty"`
+}
+
+type NvmfSubsystemListenerArgs struct {
+	Nqn           string            `json:"nqn"`
+	ListenAddress NvmfListenAddress `json:"listen_address"`
+	TgtName       string            `json:"tgt_name,omitempty"`
+}
+
+// NvmfSubsystemAddListenerResponse is "bool": indication of result
+func NvmfSubsystemAddListener(ctx context.Context, client Invoker, args NvmfSubsystemListenerArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_add_listener", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// NvmfSubsystemRemoveListenerResponse is "bool": indication of result
+func NvmfSubsystemRemoveListener(ctx context.Context, client Invoker, args NvmfSubsystemListenerArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_remove_listener", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfNamespaceParams struct {
+	BdevName string `json:"bdev_name"`
+	// Nsid 0 selects the lowest free namespace id.
+	Nsid  int    `json:"nsid,omitempty"`
+	Nguid string `json:"nguid,omitempty"`
+	Eui64 string `json:"eui64,omitempty"`
+	// UUID defaults to the UUID of the bdev.
+	UUID string `json:"uuid,omitempty"`
+	// Anagrpid is the ANA group of the namespace, SPDK defaults to Nsid.
+	Anagrpid int `json:"anagrpid,omitempty"`
+}
+
+type NvmfSubsystemAddNsArgs struct {
+	Nqn       string              `json:"nqn"`
+	Namespace NvmfNamespaceParams `json:"namespace"`
+	TgtName   string              `json:"tgt_name,omitempty"`
+}
+
+// NvmfSubsystemAddNsResponse is "int": id of the added namespace
+func NvmfSubsystemAddNs(ctx context.Context, client Invoker, args NvmfSubsystemAddNsArgs) (int, error) {
+	var response int
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_add_ns", args, &response)
+	if err != nil {
+		return 0, err
+	}
+	return response, nil
+}
+
+type NvmfSubsystemRemoveNsArgs struct {
+	Nqn     string `json:"nqn"`
+	Nsid    int    `json:"nsid"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+// NvmfSubsystemRemoveNsResponse is "bool": indication of result
+func NvmfSubsystemRemoveNs(ctx context.Context, client Invoker, args NvmfSubsystemRemoveNsArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_remove_ns", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfSubsystemHostArgs struct {
+	Nqn string `json:"nqn"`
+	// Host is the NQN of the host.
+	Host    string `json:"host"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+// NvmfSubsystemAddHostResponse is "bool": indication of result
+func NvmfSubsystemAddHost(ctx context.Context, client Invoker, args NvmfSubsystemHostArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_add_host", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// NvmfSubsystemRemoveHostResponse is "bool": indication of result
+func NvmfSubsystemRemoveHost(ctx context.Context, client Invoker, args NvmfSubsystemHostArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_remove_host", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfSubsystemAllowAnyHostArgs struct {
+	Nqn          string `json:"nqn"`
+	AllowAnyHost bool   `json:"allow_any_host"`
+	TgtName      string `json:"tgt_name,omitempty"`
+}
+
+// NvmfSubsystemAllowAnyHostResponse is "bool": indication of result
+func NvmfSubsystemAllowAnyHost(ctx context.Context, client Invoker, args NvmfSubsystemAllowAnyHostArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_allow_any_host", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfGetSubsystemsArgs struct {
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+type NvmfHost struct {
+	Nqn string `json:"nqn"`
+}
+
+type NvmfNamespace struct {
+	Nsid     int    `json:"nsid"`
+	BdevName string `json:"bdev_name"`
+	Name     string `json:"name"`
+	Nguid    string `json:"nguid,omitempty"`
+	Eui64    string `json:"eui64,omitempty"`
+	UUID     string `json:"uuid,omitempty"`
+	Anagrpid int    `json:"anagrpid,omitempty"`
+}
+
+type NvmfSubsystem struct {
+	Nqn string `json:"nqn"`
+	// Subtype is NvmfSubtypeDiscovery or NvmfSubtypeNVMe. Only NVMe
+	// subsystems have serial and model number and namespaces.
+	Subtype         string              `json:"subtype"`
+	ListenAddresses []NvmfListenAddress `json:"listen_addresses"`
+	AllowAnyHost    bool                `json:"allow_any_host"`
+	Hosts           []NvmfHost          `json:"hosts"`
+	SerialNumber    string              `json:"serial_number,omitempty"`
+	ModelNumber     string              `json:"model_number,omitempty"`
+	MaxNamespaces   int                 `json:"max_namespaces,omitempty"`
+	MinCntlid       int                 `json:"min_cntlid,omitempty"`
+	MaxCntlid       int                 `json:"max_cntlid,omitempty"`
+	Namespaces      []NvmfNamespace     `json:"namespaces,omitempty"`
+}
+
+type NvmfGetSubsystemsResponse []NvmfSubsystem
+
+func NvmfGetSubsystems(ctx context.Context, client Invoker, args NvmfGetSubsystemsArgs) (NvmfGetSubsystemsResponse, error) {
+	var response NvmfGetSubsystemsResponse
+	err := InvokeWithLegacy(ctx, client, "nvmf_get_subsystems", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// NvmfAnaState is the Asymmetric Namespace Access state which a listener
+// reports for an ANA group.
+type NvmfAnaState string
+
+const (
+	NvmfAnaOptimized    NvmfAnaState = "optimized"
+	NvmfAnaNonOptimized NvmfAnaState = "non_optimized"
+	NvmfAnaInaccessible NvmfAnaState = "inaccessible"
+	// NvmfAnaPersistentLoss and NvmfAnaChange are only reported,
+	// they cannot be set.
+	NvmfAnaPersistentLoss NvmfAnaState = "persistent_loss"
+	NvmfAnaChange         NvmfAnaState = "change"
+)
+
+type NvmfSubsystemListenerSetAnaStateArgs struct {
+	Nqn           string            `json:"nqn"`
+	ListenAddress NvmfListenAddress `json:"listen_address"`
+	AnaState      NvmfAnaState      `json:"ana_state"`
+	// Anagrpid 0 sets the state of all ANA groups.
+	Anagrpid int    `json:"anagrpid,omitempty"`
+	TgtName  string `json:"tgt_name,omitempty"`
+}
+
+// NvmfSubsystemListenerSetAnaStateResponse is "bool": indication of result
+func NvmfSubsystemListenerSetAnaState(ctx context.Context, client Invoker, args NvmfSubsystemListenerSetAnaStateArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_listener_set_ana_state", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type NvmfSubsystemGetListenersArgs struct {
+	Nqn     string `json:"nqn"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+type NvmfListenerAnaGroupState struct {
+	AnaGroup int          `json:"ana_group"`
+	AnaState NvmfAnaState `json:"ana_state"`
+}
+
+type NvmfListener struct {
+	Address NvmfListenAddress `json:"address"`
+	// AnaState is the state of all ANA groups before SPDK v22.01,
+	// AnaStates has one entry per group since then. Both are only
+	// set for subsystems with ANA reporting.
+	AnaState  NvmfAnaState                `json:"ana_state,omitempty"`
+	AnaStates []NvmfListenerAnaGroupState `json:"ana_states,omitempty"`
+}
+
+// State returns the ANA state of the group anagrpid at the listener,
+// "" if it is not reported.
+func (l NvmfListener) State(anagrpid int) NvmfAnaState {
+	if l.AnaState != "" {
+		return l.AnaState
+	}
+	for _, state := range l.AnaStates {
+		if state.AnaGroup == anagrpid {
+			return state.AnaState
+		}
+	}
+	return ""
+}
+
+type NvmfSubsystemGetListenersResponse []NvmfListener
+
+func NvmfSubsystemGetListeners(ctx context.Context, client Invoker, args NvmfSubsystemGetListenersArgs) (NvmfSubsystemGetListenersResponse, error) {
+	var response NvmfSubsystemGetListenersResponse
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_get_listeners", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type NvmfSubsystemGetControllersArgs struct {
+	Nqn     string `json:"nqn"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+// NvmfController is a controller of a connected host.
+type NvmfController struct {
+	Cntlid      int    `json:"cntlid"`
+	Hostnqn     string `json:"hostnqn"`
+	Hostid      string `json:"hostid"`
+	NumIoQpairs int    `json:"num_io_qpairs"`
+}
+
+type NvmfSubsystemGetControllersResponse []NvmfController
+
+func NvmfSubsystemGetControllers(ctx context.Context, client Invoker, args NvmfSubsystemGetControllersArgs) (NvmfSubsystemGetControllersResponse, error) {
+	var response NvmfSubsystemGetControllersResponse
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_get_controllers", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type NvmfSubsystemGetQpairsArgs struct {
+	Nqn     string `json:"nqn"`
+	TgtName string `json:"tgt_name,omitempty"`
+}
+
+// NvmfQpair is a queue pair of a controller, Qid 0 is the admin queue.
+type NvmfQpair struct {
+	Cntlid int `json:"cntlid"`
+	Qid    int `json:"qid"`
+	// State is e.g. "active" or "deleting".
+	State         string            `json:"state"`
+	Thread        string            `json:"thread,omitempty"`
+	Hostnqn       string            `json:"hostnqn,omitempty"`
+	ListenAddress NvmfListenAddress `json:"listen_address"`
+}
+
+type NvmfSubsystemGetQpairsResponse []NvmfQpair
+
+func NvmfSubsystemGetQpairs(ctx context.Context, client Invoker, args NvmfSubsystemGetQpairsArgs) (NvmfSubsystemGetQpairsResponse, error) {
+	var response NvmfSubsystemGetQpairsResponse
+	err := InvokeWithLegacy(ctx, client, "nvmf_subsystem_get_qpairs", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
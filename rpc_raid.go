@@ -0,0 +1,203 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Levels of bdev_raid_create.
+const (
+	RaidLevel0 = "raid0"
+	// RaidLevel1 mirrors the base bdevs, it tolerates the loss
+	// of all but one.
+	RaidLevel1 = "raid1"
+	// RaidLevel5f needs at least three base bdevs and tolerates
+	// the loss of one.
+	RaidLevel5f     = "raid5f"
+	RaidLevelConcat = "concat"
+)
+
+// States of RAID bdevs, which are also the categories of
+// bdev_raid_get_bdevs.
+const (
+	// RaidStateOnline RAID bdevs are registered as bdev, possibly
+	// degraded.
+	RaidStateOnline = "online"
+	// RaidStateConfiguring RAID bdevs wait for base bdevs to appear.
+	RaidStateConfiguring = "configuring"
+	// RaidStateOffline RAID bdevs lost too many base bdevs.
+	RaidStateOffline = "offline"
+
+	RaidCategoryAll = "all"
+)
+
+type BdevRaidCreateArgs struct {
+	Name string `json:"name"`
+	// StripSizeKB must be a power of two, except for RaidLevel1
+	// which has no strips.
+	StripSizeKB int64 `json:"strip_size_kb,omitempty"`
+	// RaidLevel is one of the RaidLevel values.
+	RaidLevel string `json:"raid_level"`
+	// BaseBdevs may name bdevs which do not exist yet, the RAID bdev
+	// is configuring until they appear.
+	BaseBdevs []string `json:"base_bdevs"`
+	UUID      string   `json:"uuid,omitempty"`
+	// Superblock stores the RAID configuration on the base bdevs.
+	Superblock bool `json:"superblock,omitempty"`
+}
+
+// BdevRaidCreateResponse is "bool": indication of result
+func BdevRaidCreate(ctx context.Context, client Invoker, args BdevRaidCreateArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_raid_create", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type BdevRaidDeleteArgs struct {
+	Name string `json:"name"`
+}
+
+// BdevRaidDeleteResponse is "bool": indication of result
+func BdevRaidDelete(ctx context.Context, client Invoker, args BdevRaidDeleteArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_raid_delete", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type BdevRaidGetBdevsArgs struct {
+	// Category is RaidCategoryAll or one of the RaidState values,
+	// empty lists all RAID bdevs.
+	Category string `json:"category"`
+}
+
+// RaidProcess is a background process of a RAID bdev.
+type RaidProcess struct {
+	// Type is e.g. "rebuild".
+	Type string `json:"type"`
+	// Target is the name of the base bdev being written.
+	Target   string `json:"target"`
+	Progress struct {
+		Blocks  int64 `json:"blocks"`
+		Percent int   `json:"percent"`
+	} `json:"progress"`
+}
+
+// RaidBaseBdevState describes an entry of RaidDriverSpecific.BaseBdevsList.
+type RaidBaseBdevState string
+
+const (
+	RaidBaseBdevOnline RaidBaseBdevState = "online"
+	// RaidBaseBdevMissing slots have no base bdev, it was removed
+	// or did not appear yet.
+	RaidBaseBdevMissing RaidBaseBdevState = "missing"
+	// RaidBaseBdevRebuilding base bdevs are the target of a rebuild.
+	RaidBaseBdevRebuilding RaidBaseBdevState = "rebuilding"
+)
+
+// BaseBdevStates returns the state of each entry of BaseBdevsList.
+func (r RaidDriverSpecific) BaseBdevStates() []RaidBaseBdevState {
+	states := make([]RaidBaseBdevState, len(r.BaseBdevsList))
+	for i, base := range r.BaseBdevsList {
+		switch {
+		case !base.IsConfigured:
+			states[i] = RaidBaseBdevMissing
+		case r.Process != nil && r.Process.Type == "rebuild" && r.Process.Target == base.Name:
+			states[i] = RaidBaseBdevRebuilding
+		default:
+			states[i] = RaidBaseBdevOnline
+		}
+	}
+	return states
+}
+
+// Degraded tells whether an online RAID bdev misses base bdevs
+// or rebuilds one.
+func (r RaidDriverSpecific) Degraded() bool {
+	if r.State != RaidStateOnline {
+		return false
+	}
+	for _, state := range r.BaseBdevStates() {
+		if state != RaidBaseBdevOnline {
+			return true
+		}
+	}
+	return false
+}
+
+// RaidBdev is a RAID bdev reported by bdev_raid_get_bdevs.
+type RaidBdev struct {
+	Name string `json:"name"`
+	RaidDriverSpecific
+}
+
+// UnmarshalJSON also accepts the name of the RAID bdev, which is
+// all that SPDK before v23.09 reports.
+func (r *RaidBdev) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*r = RaidBdev{Name: name}
+		return nil
+	}
+	type raidBdev RaidBdev
+	return json.Unmarshal(data, (*raidBdev)(r))
+}
+
+type BdevRaidGetBdevsResponse []RaidBdev
+
+func BdevRaidGetBdevs(ctx context.Context, client Invoker, args BdevRaidGetBdevsArgs) (BdevRaidGetBdevsResponse, error) {
+	if args.Category == "" {
+		args.Category = RaidCategoryAll
+	}
+	var response BdevRaidGetBdevsResponse
+	err := InvokeWithLegacy(ctx, client, "bdev_raid_get_bdevs", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// BdevRaidAddBaseBdevArgs adds a base bdev to a RAID bdev which misses
+// one. SPDK rebuilds the RAID bdev onto it.
+type BdevRaidAddBaseBdevArgs struct {
+	RaidBdev string `json:"raid_bdev"`
+	BaseBdev string `json:"base_bdev"`
+}
+
+// BdevRaidAddBaseBdevResponse is "bool": indication of result
+func BdevRaidAddBaseBdev(ctx context.Context, client Invoker, args BdevRaidAddBaseBdevArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_raid_add_base_bdev", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// BdevRaidRemoveBaseBdevArgs removes a base bdev from its RAID bdev,
+// which is degraded or goes offline, depending on its level.
+type BdevRaidRemoveBaseBdevArgs struct {
+	// Name of the base bdev.
+	Name string `json:"name"`
+}
+
+// BdevRaidRemoveBaseBdevResponse is "bool": indication of result
+func BdevRaidRemoveBaseBdev(ctx context.Context, client Invoker, args BdevRaidRemoveBaseBdevArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_raid_remove_base_bdev", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaidBdevState(t *testing.T) {
+	var raids spdk.BdevRaidGetBdevsResponse
+	err := json.Unmarshal([]byte(`[{
+		"name": "Raid1",
+		"uuid": "3d0b5a4c-26e4-4f10-9d05-4f0a2fa4d2f5",
+		"strip_size_kb": 0,
+		"state": "online",
+		"raid_level": "raid1",
+		"superblock": false,
+		"num_base_bdevs": 3,
+		"num_base_bdevs_discovered": 2,
+		"num_base_bdevs_operational": 2,
+		"process": {"type": "rebuild", "target": "Malloc2", "progress": {"blocks": 512, "percent": 50}},
+		"base_bdevs_list": [
+			{"name": "Malloc0", "is_configured": true, "data_offset": 0, "data_size": 1024},
+			{"name": null, "is_configured": false, "data_offset": 0, "data_size": 1024},
+			{"name": "Malloc2", "is_configured": true, "data_offset": 0, "data_size": 1024}
+		]}, "Raid0"]`), &raids)
+	if err != nil {
+		t.Fatalf("Failed to decode raid bdevs: %s", err)
+	}
+	if !assert.Len(t, raids, 2) {
+		return
+	}
+
+	raid := raids[0]
+	assert.Equal(t, "Raid1", raid.Name)
+	assert.Equal(t, spdk.RaidLevel1, raid.RaidLevel)
+	assert.True(t, raid.Degraded())
+	assert.Equal(t, []spdk.RaidBaseBdevState{
+		spdk.RaidBaseBdevOnline,
+		spdk.RaidBaseBdevMissing,
+		spdk.RaidBaseBdevRebuilding,
+	}, raid.BaseBdevStates())
+	if assert.NotNil(t, raid.Process) {
+		assert.Equal(t, 50, raid.Process.Progress.Percent)
+	}
+
+	// SPDK before v23.09 reports names only.
+	assert.Equal(t, spdk.RaidBdev{Name: "Raid0"}, raids[1])
+	assert.False(t, raids[1].Degraded())
+}
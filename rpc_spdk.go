@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+	"fmt"
+)
+
+type RpcGetMethodsArgs struct {
+	// Current only lists the methods allowed in the current state,
+	// i.e. before or after framework_start_init.
+	Current bool `json:"current,omitempty"`
+	// IncludeAliases also lists deprecated method names.
+	IncludeAliases bool `json:"include_aliases,omitempty"`
+}
+
+// RpcGetMethodsResponse is []string: names of the supported methods.
+func RpcGetMethods(ctx context.Context, client Invoker, args RpcGetMethodsArgs) ([]string, error) {
+	var response []string
+	err := InvokeWithLegacy(ctx, client, "rpc_get_methods", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type SpdkVersionFields struct {
+	Major  int    `json:"major"`
+	Minor  int    `json:"minor"`
+	Patch  int    `json:"patch"`
+	Suffix string `json:"suffix"`
+	Commit string `json:"commit,omitempty"`
+}
+
+type SpdkGetVersionResponse struct {
+	// Version is e.g. "SPDK v20.01-pre git sha1 2d1f1e0".
+	Version string            `json:"version"`
+	Fields  SpdkVersionFields `json:"fields"`
+}
+
+func SpdkGetVersion(ctx context.Context, client Invoker) (SpdkGetVersionResponse, error) {
+	var response SpdkGetVersionResponse
+	err := InvokeWithLegacy(ctx, client, "spdk_get_version", nil, &response)
+	if err != nil {
+		return SpdkGetVersionResponse{}, err
+	}
+	return response, nil
+}
+
+// String formats the version like SPDK, e.g. "v20.01.1-pre".
+func (v SpdkVersionFields) String() string {
+	s := fmt.Sprintf("v%d.%02d", v.Major, v.Minor)
+	if v.Patch != 0 {
+		s += fmt.Sprintf(".%d", v.Patch)
+	}
+	return s + v.Suffix
+}
@@ -10,6 +10,9 @@ package spdkctrl
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
 )
 
 type VhostCreateBlkControllerArgs struct {
@@ -17,26 +20,97 @@ type VhostCreateBlkControllerArgs struct {
 	DevName  string `json:"dev_name"`
 	Readonly bool   `json:"readonly,omitempty"`
 	Cpumask  string `json:"cpumask,omitempty"`
+	// PackedRing enables packed virtqueues.
+	PackedRing bool `json:"packed_ring,omitempty"`
+	// Transport defaults to vhost_user_blk.
+	Transport string `json:"transport,omitempty"`
 }
 
 //VhostCreateBlkControllerResponse is bool: indication of result
-func VhostCreateBlkController(ctx context.Context, client *Client, args VhostCreateBlkControllerArgs) (bool, error) {
+func VhostCreateBlkController(ctx context.Context, client Invoker, args VhostCreateBlkControllerArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "vhost_create_blk_controller", args, &response)
+	err := InvokeWithLegacy(ctx, client, "vhost_create_blk_controller", args, &response)
 	if err != nil {
 		return false, err
 	}
 	return response, err
 }
 
+type VhostCreateScsiControllerArgs struct {
+	Ctrlr   string `json:"ctrlr"`
+	Cpumask string `json:"cpumask,omitempty"`
+}
+
+// VhostCreateScsiControllerResponse is bool: indication of result
+func VhostCreateScsiController(ctx context.Context, client Invoker, args VhostCreateScsiControllerArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "vhost_create_scsi_controller", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+type VhostScsiControllerAddTargetArgs struct {
+	Ctrlr string `json:"ctrlr"`
+	// ScsiTargetNum -1 selects the first free target, there are 8.
+	ScsiTargetNum int    `json:"scsi_target_num"`
+	BdevName      string `json:"bdev_name"`
+}
+
+// VhostScsiControllerAddTargetResponse is int: number of the added target,
+// which has the bdev as LUN 0
+func VhostScsiControllerAddTarget(ctx context.Context, client Invoker, args VhostScsiControllerAddTargetArgs) (int, error) {
+	var response int
+	err := InvokeWithLegacy(ctx, client, "vhost_scsi_controller_add_target", args, &response)
+	if err != nil {
+		return 0, err
+	}
+	return response, nil
+}
+
+type VhostScsiControllerRemoveTargetArgs struct {
+	Ctrlr         string `json:"ctrlr"`
+	ScsiTargetNum int    `json:"scsi_target_num"`
+}
+
+// VhostScsiControllerRemoveTargetResponse is bool: indication of result
+func VhostScsiControllerRemoveTarget(ctx context.Context, client Invoker, args VhostScsiControllerRemoveTargetArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "vhost_scsi_controller_remove_target", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// VhostControllerSetCoalescingArgs configures interrupt coalescing, which
+// delays interrupts by up to DelayBaseUs once the controller exceeds
+// IopsThreshold. DelayBaseUs 0 disables coalescing.
+type VhostControllerSetCoalescingArgs struct {
+	Ctrlr         string `json:"ctrlr"`
+	DelayBaseUs   int    `json:"delay_base_us"`
+	IopsThreshold int    `json:"iops_threshold"`
+}
+
+// VhostControllerSetCoalescingResponse is bool: indication of result
+func VhostControllerSetCoalescing(ctx context.Context, client Invoker, args VhostControllerSetCoalescingArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "vhost_controller_set_coalescing", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
 type VhostDeleteControllerArgs struct {
 	Ctrlr string `json:"ctrlr"`
 }
 
 //VhostDeleteControllerResponse is bool: indication of result
-func VhostDeleteController(ctx context.Context, client *Client, args VhostDeleteControllerArgs) (bool, error) {
+func VhostDeleteController(ctx context.Context, client Invoker, args VhostDeleteControllerArgs) (bool, error) {
 	var response bool
-	err := client.Invoke(ctx, "vhost_delete_controller", args, &response)
+	err := InvokeWithLegacy(ctx, client, "vhost_delete_controller", args, &response)
 	if err != nil {
 		return false, err
 	}
@@ -50,31 +124,64 @@ type Controller struct {
 	Cpumask       string `json:"cpumask"`
 	DelayBaseUs   int    `json:"delay_base_us"`
 	IposThreshold int    `json:"iops_threshold"`
-	// BackendSpecific holds the parsed JSON response for known
-	// backends (like SCSIControllerSpecific), otherwise
-	// the JSON data converted to basic types (map, list, etc.)
-	BackendSpecific BackendSpecificType `json:"backend_specific"`
+	// Socket is the path of the vhost-user socket.
+	Socket string `json:"socket,omitempty"`
+	// Backend is decoded from the backend_specific member, nil if
+	// SPDK reported none.
+	Backend VhostBackend `json:"-"`
 }
 
-type BackendSpecificType map[string]interface{}
+// VhostBackend is VhostBlkBackendSpecific, VhostScsiBackendSpecific,
+// VhostNvmeBackendSpecific or VhostUnknownBackend.
+type VhostBackend interface {
+	// BackendName is the key in backend_specific, like "block".
+	BackendName() string
+}
 
-type VhostScsiBackendSpecific []VhostScsiBackend
-type VhostNvmeBackendSpecific []VhostNvmeBackend
 type VhostBlkBackendSpecific struct {
+	// Bdev is empty after the bdev was hot-removed.
 	Bdev     string `json:"bdev"`
-	Readonly bool   `json: readonly`
+	Readonly bool   `json:"readonly"`
+	// Transport is e.g. "vhost_user_blk".
+	Transport string `json:"transport,omitempty"`
+	// PackedRing tells whether packed virtqueues are used, it is only
+	// reported by SPDK versions which support them.
+	PackedRing bool `json:"packed_ring,omitempty"`
+}
+
+func (VhostBlkBackendSpecific) BackendName() string { return "block" }
+
+type VhostScsiBackendSpecific []VhostScsiBackend
+
+func (VhostScsiBackendSpecific) BackendName() string { return "scsi" }
+
+// VhostNvmeBackendSpecific describes a vhost-nvme controller,
+// which SPDK removed in v21.01.
+type VhostNvmeBackendSpecific []VhostNvmeBackend
+
+func (VhostNvmeBackendSpecific) BackendName() string { return "namespaces" }
+
+// VhostUnknownBackend holds the backend_specific member of backends
+// unknown to this package.
+type VhostUnknownBackend struct {
+	Name string
+	Raw  json.RawMessage
 }
 
+func (b VhostUnknownBackend) BackendName() string { return b.Name }
+
 type VhostNvmeBackend struct {
 	Nsid int32  `json:"nsid"`
 	Bdev string `json:"bdev"`
 }
 
+// VhostScsiBackend is a target of a vhost-scsi controller,
+// see vhost_scsi_dump_info_json() in SPDK.
 type VhostScsiBackend struct {
-	TargetName string
-	ID         int32
-	ScsiDevNum uint32
-	Luns       []VhostScsiLun
+	TargetName string         `json:"target_name"`
+	ID         int32          `json:"id"`
+	ScsiDevNum uint32         `json:"scsi_dev_num"`
+	Luns       []VhostScsiLun `json:"luns"`
 }
 
 type VhostScsiLun struct {
@@ -82,141 +189,85 @@ type VhostScsiLun struct {
 	BdevName string `json:"bdev_name"`
 }
 
-func getBlkBackendSpecific(in interface{}) VhostBlkBackendSpecific {
-	target := VhostBlkBackendSpecific{}
-	if hash, ok := in.(map[string]interface{}); ok {
-		for key, value := range hash {
-			switch key {
-			case "bdev":
-				if name, ok := value.(string); ok {
-					target.Bdev = name
-				}
-			case "readonly":
-				if readonly, ok := value.(bool); ok {
-					target.Readonly = readonly
-				}
-			}
-		}
-	}
-
-	return target
-}
+// vhostController has the members of Controller without its methods.
+type vhostController Controller
 
-func getNvmeBackendSpecific(in interface{}) VhostNvmeBackendSpecific {
-	result := VhostNvmeBackendSpecific{}
-	list, ok := in.([]interface{})
-	if !ok {
-		return result
+func (c *Controller) UnmarshalJSON(data []byte) error {
+	var controller struct {
+		vhostController
+		BackendSpecific map[string]json.RawMessage `json:"backend_specific"`
 	}
-	for _, entry := range list {
-		if hash, ok := entry.(map[string]interface{}); ok {
-			target := VhostNvmeBackend{}
-			for key, value := range hash {
-				switch key {
-				case "bdev":
-					if name, ok := value.(string); ok {
-						target.Bdev = name
-					}
-				case "nsid":
-					if nsid, ok := value.(float64); ok {
-						target.Nsid = int32(nsid)
-					}
-				}
-			}
-			result = append(result, target)
-		}
+	if err := json.Unmarshal(data, &controller); err != nil {
+		return err
 	}
+	*c = Controller(controller.vhostController)
 
-	return result
-}
-
-func getScsiBackendLuns(ins []interface{}) []VhostScsiLun {
-	luns := []VhostScsiLun{}
-
-	for _, lun := range ins {
-		var l VhostScsiLun
-		if hash, ok := lun.(map[string]interface{}); ok {
-			for key, value := range hash {
-				switch key {
-				case "id":
-					if id, ok := value.(float64); ok {
-						l.ID = int32(id)
-					}
-				case "bdev_name":
-					if name, ok := value.(string); ok {
-						l.BdevName = name
-					}
-				}
-			}
+	// SPDK reports one backend, prefer known ones nevertheless.
+	names := []string{}
+	for name := range controller.BackendSpecific {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range append([]string{"block", "scsi", "namespaces"}, names...) {
+		raw, ok := controller.BackendSpecific[name]
+		if !ok {
+			continue
 		}
-		luns = append(luns, l)
+		backend, err := decodeVhostBackend(name, raw)
+		if err != nil {
+			return fmt.Errorf("backend_specific %s of vhost controller %s: %w", name, c.Ctrlr, err)
+		}
+		c.Backend = backend
+		break
 	}
+	return nil
+}
 
-	return luns
+func decodeVhostBackend(name string, raw json.RawMessage) (VhostBackend, error) {
+	switch name {
+	case "block":
+		var backend VhostBlkBackendSpecific
+		err := json.Unmarshal(raw, &backend)
+		return backend, err
+	case "scsi":
+		var backend VhostScsiBackendSpecific
+		err := json.Unmarshal(raw, &backend)
+		return backend, err
+	case "namespaces":
+		var backend VhostNvmeBackendSpecific
+		err := json.Unmarshal(raw, &backend)
+		return backend, err
+	}
+	return VhostUnknownBackend{Name: name, Raw: raw}, nil
 }
 
-// getSCSIBackendSpecific interprets the Controller.BackendSpecific value for
-// map entries with key "scsi". See https://github.com/spdk/spdk/issues/329#issuecomment-396266197
-// and spdk_vhost_scsi_dump_info_json().
-func getScsiBackendSpecific(in interface{}) VhostScsiBackendSpecific {
-	result := VhostScsiBackendSpecific{}
-	list, ok := in.([]interface{})
-	if !ok {
-		return result
+func (c Controller) MarshalJSON() ([]byte, error) {
+	controller := struct {
+		vhostController
+		BackendSpecific map[string]interface{} `json:"backend_specific"`
+	}{
+		vhostController: vhostController(c),
+		BackendSpecific: map[string]interface{}{},
 	}
-	for _, entry := range list {
-		if hash, ok := entry.(map[string]interface{}); ok {
-			target := VhostScsiBackend{
-				Luns: []VhostScsiLun{},
-			}
-			for key, value := range hash {
-				switch key {
-				case "target_name":
-					if name, ok := value.(string); ok {
-						target.TargetName = name
-					}
-				case "id":
-					if id, ok := value.(float64); ok {
-						target.ID = int32(id)
-					}
-				case "scsi_dev_num":
-					if devNum, ok := value.(float64); ok {
-						target.ScsiDevNum = uint32(devNum)
-					}
-				case "luns":
-					if luns, ok := value.([]interface{}); ok {
-						target.Luns = getScsiBackendLuns(luns)
-					}
-				}
-			}
-			result = append(result, target)
-		}
+	switch backend := c.Backend.(type) {
+	case nil:
+	case VhostUnknownBackend:
+		controller.BackendSpecific[backend.Name] = backend.Raw
+	default:
+		controller.BackendSpecific[backend.BackendName()] = backend
 	}
-	return result
+	return json.Marshal(controller)
 }
 
 type VhostGetControllersArgs struct {
 	Name string `json:"name,omitempty"`
 }
 
-func VhostGetControllers(ctx context.Context, client *Client, args VhostGetControllersArgs) (VhostGetControllersResponse, error) {
+func VhostGetControllers(ctx context.Context, client Invoker, args VhostGetControllersArgs) (VhostGetControllersResponse, error) {
 	var response VhostGetControllersResponse
-	err := client.Invoke(ctx, "vhost_get_controllers", args, &response)
-	if err == nil {
-		for _, controller := range response {
-			for backend, specific := range controller.BackendSpecific {
-				switch backend {
-				case "block":
-					controller.BackendSpecific[backend] = getBlkBackendSpecific(specific)
-
-				case "scsi":
-					controller.BackendSpecific[backend] = getScsiBackendSpecific(specific)
-
-				case "namespaces":
-					controller.BackendSpecific[backend] = getNvmeBackendSpecific(specific)
-				}
-			}
-		}
+	err := InvokeWithLegacy(ctx, client, "vhost_get_controllers", args, &response)
+	if err != nil {
+		return nil, err
 	}
-	return response, err
+	return response, nil
 }
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeVhostController(t *testing.T, data string) spdk.Controller {
+	var controller spdk.Controller
+	if err := json.Unmarshal([]byte(data), &controller); err != nil {
+		t.Fatalf("Failed to decode vhost controller: %s", err)
+	}
+	return controller
+}
+
+func TestVhostControllerBackend(t *testing.T) {
+	blk := decodeVhostController(t, `{
+		"ctrlr": "vhostblk0",
+		"cpumask": "0x1",
+		"delay_base_us": 0,
+		"iops_threshold": 60000,
+		"socket": "/var/tmp/vhostblk0",
+		"backend_specific": {"block": {
+			"readonly": true,
+			"bdev": "Malloc0",
+			"transport": "vhost_user_blk",
+			"packed_ring": true
+		}}}`)
+	assert.Equal(t, spdk.Controller{
+		Ctrlr:         "vhostblk0",
+		Cpumask:       "0x1",
+		IposThreshold: 60000,
+		Socket:        "/var/tmp/vhostblk0",
+		Backend: spdk.VhostBlkBackendSpecific{
+			Bdev:       "Malloc0",
+			Readonly:   true,
+			Transport:  "vhost_user_blk",
+			PackedRing: true,
+		},
+	}, blk)
+
+	// SPDK reports a null bdev after hot-removal.
+	blk = decodeVhostController(t, `{"ctrlr": "vhostblk1", "backend_specific": {"block": {"readonly": false, "bdev": null}}}`)
+	assert.Equal(t, spdk.VhostBlkBackendSpecific{}, blk.Backend)
+
+	scsi := decodeVhostController(t, `{"ctrlr": "vhostscsi0", "backend_specific": {"scsi": [
+		{"target_name": "Target 1", "id": 1, "scsi_dev_num": 1, "luns": [{"id": 0, "bdev_name": "Malloc1"}]}
+		]}}`)
+	assert.Equal(t, spdk.VhostScsiBackendSpecific{
+		{TargetName: "Target 1", ID: 1, ScsiDevNum: 1, Luns: []spdk.VhostScsiLun{{ID: 0, BdevName: "Malloc1"}}},
+	}, scsi.Backend)
+
+	nvme := decodeVhostController(t, `{"ctrlr": "vhostnvme0", "backend_specific": {"namespaces": [{"nsid": 1, "bdev": "Malloc2"}]}}`)
+	assert.Equal(t, spdk.VhostNvmeBackendSpecific{{Nsid: 1, Bdev: "Malloc2"}}, nvme.Backend)
+
+	unknown := decodeVhostController(t, `{"ctrlr": "vfu0", "backend_specific": {"vfu": {"endpoint":"/var/run/vfu0"}}}`)
+	assert.Equal(t, spdk.VhostUnknownBackend{Name: "vfu", Raw: json.RawMessage(`{"endpoint":"/var/run/vfu0"}`)}, unknown.Backend)
+
+	none := decodeVhostController(t, `{"ctrlr": "vhostblk2"}`)
+	assert.Nil(t, none.Backend)
+
+	var controller spdk.Controller
+	err := json.Unmarshal([]byte(`{"ctrlr": "vhostscsi1", "backend_specific": {"scsi": {"id": 0}}}`), &controller)
+	assert.ErrorContains(t, err, "backend_specific scsi of vhost controller vhostscsi1")
+
+	for _, c := range []spdk.Controller{blk, scsi, nvme, unknown, none} {
+		data, err := json.Marshal(c)
+		if err != nil {
+			t.Fatalf("Failed to encode vhost controller %s: %s", c.Ctrlr, err)
+		}
+		assert.Equal(t, c, decodeVhostController(t, string(data)), string(data))
+	}
+}
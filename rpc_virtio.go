@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdkctrl
+
+import (
+	"context"
+)
+
+// Transports and device types of bdev_virtio_attach_controller.
+const (
+	// VirtioTransportUser connects to a vhost-user socket, like the
+	// one of a controller created by VhostCreateBlkController.
+	VirtioTransportUser = "user"
+	VirtioTransportPCI  = "pci"
+
+	VirtioDevTypeBlk  = "blk"
+	VirtioDevTypeScsi = "scsi"
+)
+
+type BdevVirtioAttachControllerArgs struct {
+	// Name of the controller. A blk controller creates one bdev of
+	// that name, a scsi controller one bdev per target named <Name>t<target>.
+	Name string `json:"name"`
+	// Trtype is VirtioTransportUser or VirtioTransportPCI.
+	Trtype string `json:"trtype"`
+	// Traddr is the path of the vhost-user socket for the user
+	// transport, the PCI address like 0000:00:04.0 otherwise.
+	Traddr string `json:"traddr"`
+	// DevType is VirtioDevTypeBlk or VirtioDevTypeScsi.
+	DevType string `json:"dev_type"`
+	// VqCount and VqSize only apply to the user transport,
+	// SPDK defaults to 1 queue of 512 entries.
+	VqCount int `json:"vq_count,omitempty"`
+	VqSize  int `json:"vq_size,omitempty"`
+}
+
+// BdevVirtioAttachControllerResponse is []string: names of the bdevs
+// created for the controller.
+func BdevVirtioAttachController(ctx context.Context, client Invoker, args BdevVirtioAttachControllerArgs) ([]string, error) {
+	var response []string
+	err := InvokeWithLegacy(ctx, client, "bdev_virtio_attach_controller", args, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+type BdevVirtioDetachControllerArgs struct {
+	Name string `json:"name"`
+}
+
+// BdevVirtioDetachControllerResponse is "bool": indication of result
+func BdevVirtioDetachController(ctx context.Context, client Invoker, args BdevVirtioDetachControllerArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_virtio_detach_controller", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
+
+// VirtioDevice describes the device of a virtio controller,
+// see virtio_dev_dump_json_info() in SPDK.
+type VirtioDevice struct {
+	VqCount int `json:"vq_count"`
+	VqSize  int `json:"vq_size"`
+	// Type is VirtioTransportUser or VirtioTransportPCI.
+	Type string `json:"type"`
+	// Socket is set for the user transport.
+	Socket string `json:"socket,omitempty"`
+	// PciAddress is set for the pci transport.
+	PciAddress string `json:"pci_address,omitempty"`
+}
+
+type VirtioScsiDevice struct {
+	Name   string       `json:"name"`
+	Virtio VirtioDevice `json:"virtio"`
+}
+
+type BdevVirtioScsiGetDevicesResponse []VirtioScsiDevice
+
+// BdevVirtioScsiGetDevices lists the virtio-scsi controllers, SPDK has
+// no such call for virtio-blk ones.
+func BdevVirtioScsiGetDevices(ctx context.Context, client Invoker) (BdevVirtioScsiGetDevicesResponse, error) {
+	var response BdevVirtioScsiGetDevicesResponse
+	err := InvokeWithLegacy(ctx, client, "bdev_virtio_scsi_get_devices", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// BdevVirtioBlkSetHotplugArgs controls the polling for virtio-blk PCI
+// devices which get plugged or removed.
+type BdevVirtioBlkSetHotplugArgs struct {
+	Enable bool `json:"enable"`
+	// PeriodUs is the interval of hotplug polling, SPDK
+	// defaults to 1000000.
+	PeriodUs int64 `json:"period_us,omitempty"`
+}
+
+// BdevVirtioBlkSetHotplugResponse is "bool": indication of result
+func BdevVirtioBlkSetHotplug(ctx context.Context, client Invoker, args BdevVirtioBlkSetHotplugArgs) (bool, error) {
+	var response bool
+	err := InvokeWithLegacy(ctx, client, "bdev_virtio_blk_set_hotplug", args, &response)
+	if err != nil {
+		return false, err
+	}
+	return response, nil
+}
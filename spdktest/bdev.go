@@ -0,0 +1,301 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+type bdev struct {
+	name        string
+	aliases     []string
+	productName string
+	uuid        string
+	blockSize   int64
+	numBlocks   int64
+
+	// claimedBy is set when a module like lvol took exclusive
+	// ownership of the bdev.
+	claimedBy string
+	// users are the vhost controllers and nbd disks which
+	// have the bdev open.
+	users map[string]struct{}
+
+	// driverSpecific returns the driver_specific member of
+	// bdev_get_bdevs, nil if there is none.
+	driverSpecific func() map[string]interface{}
+}
+
+func (b *bdev) inUse() error {
+	if b.claimedBy != "" {
+		return errnoError(spdk.ErrBusy, "bdev %s claimed by %s", b.name, b.claimedBy)
+	}
+	if len(b.users) > 0 {
+		users := []string{}
+		for user := range b.users {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		return errnoError(spdk.ErrBusy, "bdev %s in use by %v", b.name, users)
+	}
+	return nil
+}
+
+func (b *bdev) open(user string) {
+	if b.users == nil {
+		b.users = make(map[string]struct{})
+	}
+	b.users[user] = struct{}{}
+}
+
+func (b *bdev) close(user string) {
+	delete(b.users, user)
+}
+
+func (b *bdev) info() map[string]interface{} {
+	info := map[string]interface{}{
+		"name":         b.name,
+		"aliases":      append([]string{}, b.aliases...),
+		"product_name": b.productName,
+		"block_size":   b.blockSize,
+		"num_blocks":   b.numBlocks,
+		"uuid":         b.uuid,
+		"claimed":      b.claimedBy != "",
+		"zoned":        false,
+		"supported_io_types": map[string]bool{
+			"read":         true,
+			"write":        true,
+			"unmap":        true,
+			"write_zeroes": true,
+			"flush":        true,
+			"reset":        true,
+			"nvme_admin":   false,
+			"nvme_io":      false,
+		},
+		"driver_specific": map[string]interface{}{},
+	}
+	if b.driverSpecific != nil {
+		info["driver_specific"] = b.driverSpecific()
+	}
+	return info
+}
+
+// findBdev looks up a bdev by name, alias or UUID.
+func (s *Server) findBdev(name string) *bdev {
+	for _, b := range s.bdevs {
+		if b.name == name || b.uuid == name {
+			return b
+		}
+		for _, alias := range b.aliases {
+			if alias == name {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupBdev(name string) (*bdev, error) {
+	b := s.findBdev(name)
+	if b == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "bdev %s not found", name)
+	}
+	return b, nil
+}
+
+func (s *Server) addBdev(b *bdev) error {
+	if b.uuid == "" {
+		b.uuid = newUUID()
+	}
+	names := append([]string{b.name, b.uuid}, b.aliases...)
+	for _, name := range names {
+		if s.findBdev(name) != nil {
+			return errnoError(spdk.ErrExist, "bdev %s already exists", name)
+		}
+	}
+	s.bdevs = append(s.bdevs, b)
+	s.notify(spdk.NotificationBdevRegister, b.name)
+	s.examineRaid(b)
+	return nil
+}
+
+// deleteBdev removes a bdev that is not in use.
+func (s *Server) deleteBdev(b *bdev) error {
+	if err := b.inUse(); err != nil {
+		return err
+	}
+	s.removeBdev(b)
+	return nil
+}
+
+// removeBdev removes a bdev without any checks.
+func (s *Server) removeBdev(b *bdev) {
+	for i := range s.bdevs {
+		if s.bdevs[i] == b {
+			s.bdevs = append(s.bdevs[:i], s.bdevs[i+1:]...)
+			s.notify(spdk.NotificationBdevUnregister, b.name)
+			return
+		}
+	}
+}
+
+// deleteBdevOf deletes a bdev by name if it was created by module.
+func (s *Server) deleteBdevOf(name, productName string) error {
+	b := s.findBdev(name)
+	if b == nil || b.productName != productName {
+		return errnoError(spdk.ErrNoDevice, "%s bdev %s not found", productName, name)
+	}
+	return s.deleteBdev(b)
+}
+
+func (s *Server) registerBdevMethods() {
+	s.methods["bdev_get_bdevs"] = s.bdevGetBdevs
+	s.methods["bdev_malloc_create"] = s.bdevMallocCreate
+	s.methods["bdev_malloc_delete"] = s.bdevMallocDelete
+	s.methods["bdev_aio_create"] = s.bdevAioCreate
+	s.methods["bdev_aio_delete"] = s.bdevAioDelete
+}
+
+func (s *Server) bdevGetBdevs(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name    string `json:"name"`
+		Timeout int    `json:"timeout"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	result := []interface{}{}
+	if args.Name != "" {
+		b, err := s.lookupBdev(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, b.info()), nil
+	}
+	for _, b := range s.bdevs {
+		result = append(result, b.info())
+	}
+	return result, nil
+}
+
+const mallocProductName = "Malloc disk"
+
+func (s *Server) bdevMallocCreate(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name      string `json:"name"`
+		BlockSize int64  `json:"block_size"`
+		NumBlocks int64  `json:"num_blocks"`
+		UUID      string `json:"uuid"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.BlockSize <= 0 || args.BlockSize%512 != 0 || args.NumBlocks <= 0 {
+		return nil, invalidParams("block_size must be a multiple of 512, num_blocks must be positive")
+	}
+
+	if args.Name == "" {
+		for s.findBdev(fmt.Sprintf("Malloc%d", s.nextMalloc)) != nil {
+			s.nextMalloc++
+		}
+		args.Name = fmt.Sprintf("Malloc%d", s.nextMalloc)
+		s.nextMalloc++
+	}
+	b := &bdev{
+		name:        args.Name,
+		productName: mallocProductName,
+		uuid:        args.UUID,
+		blockSize:   args.BlockSize,
+		numBlocks:   args.NumBlocks,
+	}
+	if err := s.addBdev(b); err != nil {
+		return nil, err
+	}
+	return b.name, nil
+}
+
+func (s *Server) bdevMallocDelete(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if err := s.deleteBdevOf(args.Name, mallocProductName); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+const aioProductName = "AIO disk"
+
+func (s *Server) bdevAioCreate(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name      string `json:"name"`
+		Filename  string `json:"filename"`
+		BlockSize int64  `json:"block_size"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" || args.Filename == "" {
+		return nil, invalidParams("name and filename are required")
+	}
+
+	fi, err := os.Stat(args.Filename)
+	if err != nil {
+		return nil, errnoError(spdk.ErrNoEntry, "aio file %s", args.Filename)
+	}
+	blockSize := args.BlockSize
+	if blockSize == 0 {
+		blockSize = 512
+	}
+	if blockSize%512 != 0 {
+		return nil, invalidParams("block_size must be a multiple of 512")
+	}
+
+	filename := args.Filename
+	blockSizeOverride := args.BlockSize != 0
+	b := &bdev{
+		name:        args.Name,
+		productName: aioProductName,
+		blockSize:   blockSize,
+		numBlocks:   fi.Size() / blockSize,
+		driverSpecific: func() map[string]interface{} {
+			return map[string]interface{}{
+				"aio": map[string]interface{}{
+					"filename":            filename,
+					"block_size_override": blockSizeOverride,
+					"readonly":            false,
+				},
+			}
+		},
+	}
+	if err := s.addBdev(b); err != nil {
+		return nil, err
+	}
+	return b.name, nil
+}
+
+func (s *Server) bdevAioDelete(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if err := s.deleteBdevOf(args.Name, aioProductName); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMallocBdev(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	assert.Empty(t, bdevs, "Unexpected non-empty bdev list")
+
+	name, err := spdk.BdevMallocCreate(ctx, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+	assert.NoError(t, err, "Failed to create malloc bdev: %s", err)
+	assert.Equal(t, "Malloc0", name)
+
+	bdevs, err = spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: name})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, int64(1024), bdevs[0].NumBlocks)
+		assert.Equal(t, int64(4096), bdevs[0].BlockSize)
+		assert.NotEmpty(t, bdevs[0].UUID)
+		assert.True(t, bdevs[0].SupportedIOTypes.Write)
+	}
+
+	_, err = spdk.BdevMallocCreate(ctx, client, spdk.BdevMallocCreateArgs{Name: name, NumBlocks: 1024, BlockSize: 4096})
+	assert.ErrorIs(t, err, spdk.ErrExist)
+
+	deleted, err := spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: name})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+	assert.True(t, deleted)
+
+	_, err = spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: name})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+}
+
+func TestAioBdev(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	filename := filepath.Join(t.TempDir(), "aiodisk")
+	if err := os.WriteFile(filename, make([]byte, 1024*1024), 0600); err != nil {
+		t.Fatalf("Failed to create aio file: %s", err)
+	}
+
+	name, err := spdk.BdevAioCreate(ctx, client, spdk.BdevAioCreateArgs{Name: "Aio0", Filename: filename, BlockSize: 4096})
+	assert.NoError(t, err, "Failed to create aio bdev: %s", err)
+	assert.Equal(t, "Aio0", name)
+
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: name})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, int64(256), bdevs[0].NumBlocks)
+	}
+
+	_, err = spdk.BdevAioCreate(ctx, client, spdk.BdevAioCreateArgs{Name: "Aio1", Filename: filename + ".missing"})
+	assert.ErrorIs(t, err, spdk.ErrNoEntry)
+
+	deleted, err := spdk.BdevAioDelete(ctx, client, spdk.BdevAioDeleteArgs{Name: name})
+	assert.NoError(t, err, "Failed to delete aio bdev: %s", err)
+	assert.True(t, deleted)
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// fabric connects the NVMe-oF targets and hosts of all Servers in the
+// process like a loopback network: a Server can attach subsystems
+// exported by itself or by another Server. It has its own lock, which
+// is taken while holding the lock of a Server, never the other way round.
+var fabric = struct {
+	mutex sync.Mutex
+	ports map[fabricAddress]*fabricPort
+	// nextCntlid counts controllers per subsystem NQN.
+	nextCntlid map[string]int
+}{
+	ports:      make(map[fabricAddress]*fabricPort),
+	nextCntlid: make(map[string]int),
+}
+
+// fabricAddress is a normalized listen address.
+type fabricAddress struct {
+	trtype  string
+	adrfam  string
+	traddr  string
+	trsvcid string
+}
+
+func newFabricAddress(trtype, adrfam, traddr, trsvcid string) fabricAddress {
+	if adrfam == "" {
+		adrfam = "ipv4"
+	}
+	return fabricAddress{
+		trtype:  strings.ToUpper(trtype),
+		adrfam:  strings.ToLower(adrfam),
+		traddr:  traddr,
+		trsvcid: trsvcid,
+	}
+}
+
+type fabricPort struct {
+	server      *Server
+	subsystems  map[string]*fabricSubsystem
+	connections []fabricConnection
+}
+
+// dropConnections removes the connections to subsystem nqn.
+func (port *fabricPort) dropConnections(nqn string) {
+	connections := []fabricConnection{}
+	for _, conn := range port.connections {
+		if conn.nqn != nqn {
+			connections = append(connections, conn)
+		}
+	}
+	port.connections = connections
+}
+
+// fabricConnection is a controller of a host connected to a port.
+type fabricConnection struct {
+	addr        fabricAddress
+	nqn         string
+	host        *Server
+	hostnqn     string
+	hostid      string
+	cntlid      int
+	numIoQpairs int
+}
+
+// fabricSubsystem is what a target exports. It is never modified,
+// the target publishes a new one when the subsystem changes.
+type fabricSubsystem struct {
+	nqn          string
+	serialNumber string
+	modelNumber  string
+	allowAnyHost bool
+	hosts        map[string]bool
+	namespaces   []fabricNamespace
+	anaReporting bool
+	// anaStates maps listen addresses to the states of their ANA groups.
+	anaStates map[fabricAddress]map[int]spdk.NvmfAnaState
+}
+
+type fabricNamespace struct {
+	nsid      int
+	anagrpid  int
+	uuid      string
+	blockSize int64
+	numBlocks int64
+}
+
+// anaState returns the ANA state of group anagrpid at addr.
+func (sub *fabricSubsystem) anaState(addr fabricAddress, anagrpid int) spdk.NvmfAnaState {
+	if !sub.anaReporting {
+		return spdk.NvmfAnaOptimized
+	}
+	if state := sub.anaStates[addr][anagrpid]; state != "" {
+		return state
+	}
+	return spdk.NvmfAnaOptimized
+}
+
+// fabricListen exports sub at addr on behalf of s.
+func fabricListen(s *Server, addr fabricAddress, sub *fabricSubsystem) error {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	port := fabric.ports[addr]
+	if port == nil {
+		port = &fabricPort{server: s, subsystems: make(map[string]*fabricSubsystem)}
+		fabric.ports[addr] = port
+	} else if port.server != s {
+		return errnoError(spdk.ErrInvalid, "address %s:%s already in use", addr.traddr, addr.trsvcid)
+	}
+	port.subsystems[sub.nqn] = sub
+	return nil
+}
+
+// fabricUnlisten stops exporting a subsystem at addr.
+func fabricUnlisten(s *Server, addr fabricAddress, nqn string) {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	port := fabric.ports[addr]
+	if port == nil || port.server != s {
+		return
+	}
+	delete(port.subsystems, nqn)
+	port.dropConnections(nqn)
+	if len(port.subsystems) == 0 {
+		delete(fabric.ports, addr)
+	}
+}
+
+// fabricPublish replaces the exported state of a subsystem. A nil
+// sub removes the subsystem from all ports of s.
+func fabricPublish(s *Server, nqn string, sub *fabricSubsystem) {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	for addr, port := range fabric.ports {
+		if port.server != s || port.subsystems[nqn] == nil {
+			continue
+		}
+		if sub != nil {
+			port.subsystems[nqn] = sub
+			continue
+		}
+		delete(port.subsystems, nqn)
+		port.dropConnections(nqn)
+		if len(port.subsystems) == 0 {
+			delete(fabric.ports, addr)
+		}
+	}
+}
+
+// fabricClose removes all ports of s and disconnects s as host.
+func fabricClose(s *Server) {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	for addr, port := range fabric.ports {
+		if port.server == s {
+			delete(fabric.ports, addr)
+			continue
+		}
+		connections := []fabricConnection{}
+		for _, conn := range port.connections {
+			if conn.host != s {
+				connections = append(connections, conn)
+			}
+		}
+		port.connections = connections
+	}
+}
+
+// fabricLookup returns the subsystem exported at addr,
+// nil if it is not reachable.
+func fabricLookup(addr fabricAddress, nqn string) *fabricSubsystem {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	port := fabric.ports[addr]
+	if port == nil {
+		return nil
+	}
+	return port.subsystems[nqn]
+}
+
+// fabricConnect connects a host to the subsystem conn.nqn at conn.addr
+// and returns the subsystem together with the id of the new controller.
+func fabricConnect(conn fabricConnection) (*fabricSubsystem, int, error) {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	port := fabric.ports[conn.addr]
+	if port == nil || port.subsystems[conn.nqn] == nil {
+		return nil, 0, errnoError(spdk.ErrIO, "connect to %s at %s:%s", conn.nqn, conn.addr.traddr, conn.addr.trsvcid)
+	}
+	sub := port.subsystems[conn.nqn]
+	if !sub.allowAnyHost && !sub.hosts[conn.hostnqn] {
+		return nil, 0, errnoError(spdk.ErrIO, "host %s not allowed to connect to %s", conn.hostnqn, conn.nqn)
+	}
+	fabric.nextCntlid[conn.nqn]++
+	conn.cntlid = fabric.nextCntlid[conn.nqn]
+	port.connections = append(port.connections, conn)
+	return sub, conn.cntlid, nil
+}
+
+// fabricDisconnect removes the controller cntlid of subsystem nqn at addr.
+func fabricDisconnect(addr fabricAddress, nqn string, cntlid int) {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	port := fabric.ports[addr]
+	if port == nil {
+		return
+	}
+	for i, conn := range port.connections {
+		if conn.nqn == nqn && conn.cntlid == cntlid {
+			port.connections = append(port.connections[:i], port.connections[i+1:]...)
+			return
+		}
+	}
+}
+
+// fabricConnections returns the controllers connected to the subsystem
+// nqn exported by s, ordered by cntlid.
+func fabricConnections(s *Server, nqn string) []fabricConnection {
+	fabric.mutex.Lock()
+	defer fabric.mutex.Unlock()
+
+	connections := []fabricConnection{}
+	for _, port := range fabric.ports {
+		if port.server != s {
+			continue
+		}
+		for _, conn := range port.connections {
+			if conn.nqn == nqn {
+				connections = append(connections, conn)
+			}
+		}
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].cntlid < connections[j].cntlid
+	})
+	return connections
+}
@@ -0,0 +1,706 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// iscsiMaxLuns is the number of LUNs of a SCSI device in SPDK.
+const iscsiMaxLuns = 64
+
+type iscsiTargetNode struct {
+	spdk.IscsiTargetNode
+	// bdevs are opened by the target node.
+	bdevs []*bdev
+}
+
+func (t *iscsiTargetNode) user() string {
+	return "iscsi target node " + t.Name
+}
+
+func defaultIscsiOptions() spdk.IscsiOptions {
+	return spdk.IscsiOptions{
+		NodeBase:                    "iqn.2016-06.io.spdk",
+		MaxSessions:                 128,
+		MaxConnectionsPerSession:    2,
+		MaxQueueDepth:               64,
+		DefaultTime2wait:            2,
+		DefaultTime2retain:          20,
+		FirstBurstLength:            8192,
+		ImmediateData:               true,
+		NopTimeout:                  60,
+		NopInInterval:               30,
+		MaxLargeDatainPerConnection: 64,
+		MaxR2tPerConnection:         4,
+		PduPoolSize:                 36864,
+		ImmediateDataPoolSize:       16384,
+		DataOutPoolSize:             2048,
+	}
+}
+
+// checkChap validates CHAP settings like SPDK.
+func checkChap(chap spdk.IscsiChap) error {
+	if (chap.DisableChap && chap.RequireChap) || (chap.MutualChap && !chap.RequireChap) || chap.ChapGroup < 0 {
+		return invalidParams("Invalid combination of CHAP params")
+	}
+	return nil
+}
+
+func (s *Server) findPortalGroup(tag int) *spdk.IscsiPortalGroup {
+	for _, pg := range s.portalGroups {
+		if pg.Tag == tag {
+			return pg
+		}
+	}
+	return nil
+}
+
+func (s *Server) findInitiatorGroup(tag int) *spdk.IscsiInitiatorGroup {
+	for _, ig := range s.initiatorGroups {
+		if ig.Tag == tag {
+			return ig
+		}
+	}
+	return nil
+}
+
+func (s *Server) findAuthGroup(tag int) *spdk.IscsiAuthGroup {
+	for _, ag := range s.authGroups {
+		if ag.Tag == tag {
+			return ag
+		}
+	}
+	return nil
+}
+
+func (s *Server) findTargetNode(name string) *iscsiTargetNode {
+	for _, t := range s.targetNodes {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupTargetNode(name string) (*iscsiTargetNode, error) {
+	t := s.findTargetNode(name)
+	if t == nil {
+		return nil, invalidParams("target node " + name + " not found")
+	}
+	return t, nil
+}
+
+// checkPgIgMaps checks that the groups of maps exist.
+func (s *Server) checkPgIgMaps(maps []spdk.IscsiPgIgMap) error {
+	for _, m := range maps {
+		if s.findPortalGroup(m.PgTag) == nil || s.findInitiatorGroup(m.IgTag) == nil {
+			return invalidParams(fmt.Sprintf("portal group %d or initiator group %d not found", m.PgTag, m.IgTag))
+		}
+	}
+	return nil
+}
+
+// iscsiStarted tells whether iSCSI objects were created, SPDK
+// then no longer accepts iscsi_set_options.
+func (s *Server) iscsiStarted() bool {
+	return len(s.portalGroups) > 0 || len(s.initiatorGroups) > 0 ||
+		len(s.targetNodes) > 0 || len(s.authGroups) > 0
+}
+
+func (s *Server) registerIscsiMethods() {
+	s.iscsiOptions = defaultIscsiOptions()
+	s.methods["iscsi_create_portal_group"] = s.iscsiCreatePortalGroup
+	s.methods["iscsi_delete_portal_group"] = s.iscsiDeletePortalGroup
+	s.methods["iscsi_get_portal_groups"] = s.iscsiGetPortalGroups
+	s.methods["iscsi_portal_group_set_auth"] = s.iscsiPortalGroupSetAuth
+	s.methods["iscsi_create_initiator_group"] = s.iscsiCreateInitiatorGroup
+	s.methods["iscsi_delete_initiator_group"] = s.iscsiDeleteInitiatorGroup
+	s.methods["iscsi_get_initiator_groups"] = s.iscsiGetInitiatorGroups
+	s.methods["iscsi_initiator_group_add_initiators"] = s.iscsiInitiatorGroupAddInitiators
+	s.methods["iscsi_initiator_group_remove_initiators"] = s.iscsiInitiatorGroupRemoveInitiators
+	s.methods["iscsi_create_target_node"] = s.iscsiCreateTargetNode
+	s.methods["iscsi_delete_target_node"] = s.iscsiDeleteTargetNode
+	s.methods["iscsi_get_target_nodes"] = s.iscsiGetTargetNodes
+	s.methods["iscsi_target_node_add_lun"] = s.iscsiTargetNodeAddLun
+	s.methods["iscsi_target_node_add_pg_ig_maps"] = s.iscsiTargetNodeAddPgIgMaps
+	s.methods["iscsi_target_node_remove_pg_ig_maps"] = s.iscsiTargetNodeRemovePgIgMaps
+	s.methods["iscsi_target_node_set_auth"] = s.iscsiTargetNodeSetAuth
+	s.methods["iscsi_create_auth_group"] = s.iscsiCreateAuthGroup
+	s.methods["iscsi_delete_auth_group"] = s.iscsiDeleteAuthGroup
+	s.methods["iscsi_get_auth_groups"] = s.iscsiGetAuthGroups
+	s.methods["iscsi_auth_group_add_secret"] = s.iscsiAuthGroupAddSecret
+	s.methods["iscsi_auth_group_remove_secret"] = s.iscsiAuthGroupRemoveSecret
+	s.methods["iscsi_set_discovery_auth"] = s.iscsiSetDiscoveryAuth
+	s.methods["iscsi_get_connections"] = s.iscsiGetConnections
+	s.methods["iscsi_get_options"] = s.iscsiGetOptions
+	s.methods["iscsi_set_options"] = s.iscsiSetOptions
+}
+
+func (s *Server) iscsiCreatePortalGroup(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiCreatePortalGroupArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Tag <= 0 || len(args.Portals) == 0 {
+		return nil, invalidParams("tag and portals are required")
+	}
+	if s.findPortalGroup(args.Tag) != nil {
+		return nil, invalidParams(fmt.Sprintf("portal group %d already exists", args.Tag))
+	}
+	for _, portal := range args.Portals {
+		if portal.Host == "" || portal.Port == "" {
+			return nil, invalidParams("host and port are required")
+		}
+		for _, pg := range s.portalGroups {
+			for _, other := range pg.Portals {
+				if other == portal {
+					return nil, &spdk.JSONRPCError{Code: spdk.ERROR_INTERNAL_ERROR, Message: "Internal error"}
+				}
+			}
+		}
+	}
+	s.portalGroups = append(s.portalGroups, &spdk.IscsiPortalGroup{
+		Tag:     args.Tag,
+		Private: args.Private,
+		Portals: append([]spdk.IscsiPortal{}, args.Portals...),
+	})
+	return true, nil
+}
+
+func (s *Server) iscsiDeletePortalGroup(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiDeletePortalGroupArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	for i, pg := range s.portalGroups {
+		if pg.Tag != args.Tag {
+			continue
+		}
+		// Like SPDK, the maps of target nodes to the group get removed.
+		for _, t := range s.targetNodes {
+			maps := []spdk.IscsiPgIgMap{}
+			for _, m := range t.PgIgMaps {
+				if m.PgTag != args.Tag {
+					maps = append(maps, m)
+				}
+			}
+			t.PgIgMaps = maps
+		}
+		s.portalGroups = append(s.portalGroups[:i], s.portalGroups[i+1:]...)
+		return true, nil
+	}
+	return nil, invalidParams(fmt.Sprintf("portal group %d not found", args.Tag))
+}
+
+func (s *Server) iscsiGetPortalGroups(params json.RawMessage) (interface{}, error) {
+	result := []spdk.IscsiPortalGroup{}
+	for _, pg := range s.portalGroups {
+		result = append(result, *pg)
+	}
+	return result, nil
+}
+
+func (s *Server) iscsiPortalGroupSetAuth(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiPortalGroupSetAuthArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if s.findPortalGroup(args.Tag) == nil {
+		return nil, invalidParams(fmt.Sprintf("portal group %d not found", args.Tag))
+	}
+	if err := checkChap(args.IscsiChap); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) iscsiCreateInitiatorGroup(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiCreateInitiatorGroupArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Tag <= 0 || len(args.Initiators) == 0 || len(args.Netmasks) == 0 {
+		return nil, invalidParams("tag, initiators and netmasks are required")
+	}
+	if s.findInitiatorGroup(args.Tag) != nil {
+		return nil, invalidParams(fmt.Sprintf("initiator group %d already exists", args.Tag))
+	}
+	s.initiatorGroups = append(s.initiatorGroups, &spdk.IscsiInitiatorGroup{
+		Tag:        args.Tag,
+		Initiators: append([]string{}, args.Initiators...),
+		Netmasks:   append([]string{}, args.Netmasks...),
+	})
+	return true, nil
+}
+
+func (s *Server) iscsiDeleteInitiatorGroup(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiDeleteInitiatorGroupArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	for i, ig := range s.initiatorGroups {
+		if ig.Tag != args.Tag {
+			continue
+		}
+		for _, t := range s.targetNodes {
+			maps := []spdk.IscsiPgIgMap{}
+			for _, m := range t.PgIgMaps {
+				if m.IgTag != args.Tag {
+					maps = append(maps, m)
+				}
+			}
+			t.PgIgMaps = maps
+		}
+		s.initiatorGroups = append(s.initiatorGroups[:i], s.initiatorGroups[i+1:]...)
+		return true, nil
+	}
+	return nil, invalidParams(fmt.Sprintf("initiator group %d not found", args.Tag))
+}
+
+func (s *Server) iscsiGetInitiatorGroups(params json.RawMessage) (interface{}, error) {
+	result := []spdk.IscsiInitiatorGroup{}
+	for _, ig := range s.initiatorGroups {
+		result = append(result, *ig)
+	}
+	return result, nil
+}
+
+func (s *Server) iscsiInitiatorGroupAddInitiators(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiInitiatorGroupInitiatorsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	ig := s.findInitiatorGroup(args.Tag)
+	if ig == nil {
+		return nil, invalidParams(fmt.Sprintf("initiator group %d not found", args.Tag))
+	}
+	for _, initiator := range args.Initiators {
+		if contains(ig.Initiators, initiator) {
+			return nil, invalidParams("initiator " + initiator + " already exists")
+		}
+	}
+	for _, netmask := range args.Netmasks {
+		if contains(ig.Netmasks, netmask) {
+			return nil, invalidParams("netmask " + netmask + " already exists")
+		}
+	}
+	ig.Initiators = append(ig.Initiators, args.Initiators...)
+	ig.Netmasks = append(ig.Netmasks, args.Netmasks...)
+	return true, nil
+}
+
+func (s *Server) iscsiInitiatorGroupRemoveInitiators(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiInitiatorGroupInitiatorsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	ig := s.findInitiatorGroup(args.Tag)
+	if ig == nil {
+		return nil, invalidParams(fmt.Sprintf("initiator group %d not found", args.Tag))
+	}
+	for _, initiator := range args.Initiators {
+		if !contains(ig.Initiators, initiator) {
+			return nil, invalidParams("initiator " + initiator + " not found")
+		}
+	}
+	for _, netmask := range args.Netmasks {
+		if !contains(ig.Netmasks, netmask) {
+			return nil, invalidParams("netmask " + netmask + " not found")
+		}
+	}
+	ig.Initiators = remove(ig.Initiators, args.Initiators)
+	ig.Netmasks = remove(ig.Netmasks, args.Netmasks)
+	return true, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// remove returns list without values.
+func remove(list []string, values []string) []string {
+	result := []string{}
+	for _, v := range list {
+		if !contains(values, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (s *Server) iscsiCreateTargetNode(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiCreateTargetNodeArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	name := args.Name
+	if !strings.Contains(name, ":") {
+		name = s.iscsiOptions.NodeBase + ":" + name
+	}
+	if args.Name == "" || s.findTargetNode(name) != nil {
+		return nil, invalidParams("Unable to create target node " + name)
+	}
+	if args.QueueDepth <= 0 || args.QueueDepth > s.iscsiOptions.MaxQueueDepth {
+		return nil, invalidParams(fmt.Sprintf("queue_depth must be 1-%d", s.iscsiOptions.MaxQueueDepth))
+	}
+	if len(args.Luns) == 0 || len(args.Luns) > iscsiMaxLuns {
+		return nil, invalidParams("luns are required")
+	}
+	if err := s.checkPgIgMaps(args.PgIgMaps); err != nil {
+		return nil, err
+	}
+	if err := checkChap(args.IscsiChap); err != nil {
+		return nil, err
+	}
+
+	t := &iscsiTargetNode{IscsiTargetNode: spdk.IscsiTargetNode{
+		Name:         name,
+		AliasName:    args.AliasName,
+		PgIgMaps:     append([]spdk.IscsiPgIgMap{}, args.PgIgMaps...),
+		Luns:         []spdk.IscsiLun{},
+		QueueDepth:   args.QueueDepth,
+		IscsiChap:    args.IscsiChap,
+		HeaderDigest: args.HeaderDigest,
+		DataDigest:   args.DataDigest,
+	}}
+	for _, lun := range args.Luns {
+		if err := s.addIscsiLun(t, lun.BdevName, lun.LunID); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range t.bdevs {
+		b.open(t.user())
+	}
+	s.targetNodes = append(s.targetNodes, t)
+	return true, nil
+}
+
+// addIscsiLun adds a LUN to t without opening the bdev.
+func (s *Server) addIscsiLun(t *iscsiTargetNode, bdevName string, lunID int) error {
+	b := s.findBdev(bdevName)
+	if b == nil {
+		return invalidParams("bdev " + bdevName + " not found")
+	}
+	if lunID < 0 || lunID >= iscsiMaxLuns {
+		return invalidParams(fmt.Sprintf("invalid LUN id %d", lunID))
+	}
+	for _, lun := range t.Luns {
+		if lun.LunID == lunID {
+			return invalidParams(fmt.Sprintf("LUN %d already exists", lunID))
+		}
+	}
+	t.Luns = append(t.Luns, spdk.IscsiLun{BdevName: b.name, LunID: lunID})
+	t.bdevs = append(t.bdevs, b)
+	return nil
+}
+
+func (s *Server) iscsiDeleteTargetNode(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiDeleteTargetNodeArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	for i, t := range s.targetNodes {
+		if t.Name != args.Name {
+			continue
+		}
+		for _, b := range t.bdevs {
+			b.close(t.user())
+		}
+		s.targetNodes = append(s.targetNodes[:i], s.targetNodes[i+1:]...)
+		return true, nil
+	}
+	return nil, invalidParams("target node " + args.Name + " not found")
+}
+
+func (s *Server) iscsiGetTargetNodes(params json.RawMessage) (interface{}, error) {
+	result := []spdk.IscsiTargetNode{}
+	for _, t := range s.targetNodes {
+		result = append(result, t.IscsiTargetNode)
+	}
+	return result, nil
+}
+
+func (s *Server) iscsiTargetNodeAddLun(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiTargetNodeAddLunArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	t, err := s.lookupTargetNode(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	lunID := 0
+	if args.LunID != nil {
+		lunID = *args.LunID
+	} else {
+		for t.hasLun(lunID) {
+			lunID++
+		}
+	}
+	if err := s.addIscsiLun(t, args.BdevName, lunID); err != nil {
+		return nil, err
+	}
+	t.bdevs[len(t.bdevs)-1].open(t.user())
+	return true, nil
+}
+
+func (t *iscsiTargetNode) hasLun(lunID int) bool {
+	for _, lun := range t.Luns {
+		if lun.LunID == lunID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) iscsiTargetNodeAddPgIgMaps(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiTargetNodePgIgMapsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	t, err := s.lookupTargetNode(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPgIgMaps(args.PgIgMaps); err != nil {
+		return nil, err
+	}
+	for _, m := range args.PgIgMaps {
+		for _, existing := range t.PgIgMaps {
+			if existing == m {
+				return nil, invalidParams(fmt.Sprintf("map of portal group %d to initiator group %d already exists", m.PgTag, m.IgTag))
+			}
+		}
+	}
+	t.PgIgMaps = append(t.PgIgMaps, args.PgIgMaps...)
+	return true, nil
+}
+
+func (s *Server) iscsiTargetNodeRemovePgIgMaps(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiTargetNodePgIgMapsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	t, err := s.lookupTargetNode(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	maps := []spdk.IscsiPgIgMap{}
+	for _, existing := range t.PgIgMaps {
+		removed := false
+		for _, m := range args.PgIgMaps {
+			removed = removed || existing == m
+		}
+		if !removed {
+			maps = append(maps, existing)
+		}
+	}
+	if len(maps)+len(args.PgIgMaps) != len(t.PgIgMaps) {
+		return nil, invalidParams("map not found")
+	}
+	t.PgIgMaps = maps
+	return true, nil
+}
+
+func (s *Server) iscsiTargetNodeSetAuth(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiTargetNodeSetAuthArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	t, err := s.lookupTargetNode(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkChap(args.IscsiChap); err != nil {
+		return nil, err
+	}
+	t.IscsiChap = args.IscsiChap
+	return true, nil
+}
+
+func (s *Server) iscsiCreateAuthGroup(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiCreateAuthGroupArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Tag <= 0 || s.findAuthGroup(args.Tag) != nil {
+		return nil, invalidParams(fmt.Sprintf("Could not add auth group (%d)", args.Tag))
+	}
+	ag := &spdk.IscsiAuthGroup{Tag: args.Tag, Secrets: []spdk.IscsiChapSecret{}}
+	for _, secret := range args.Secrets {
+		if err := addSecret(ag, secret); err != nil {
+			return nil, err
+		}
+	}
+	s.authGroups = append(s.authGroups, ag)
+	return true, nil
+}
+
+func addSecret(ag *spdk.IscsiAuthGroup, secret spdk.IscsiChapSecret) error {
+	if secret.User == "" || secret.Secret == "" || (secret.Muser == "") != (secret.Msecret == "") {
+		return invalidParams("user and secret, or muser and msecret are missing")
+	}
+	for _, existing := range ag.Secrets {
+		if existing.User == secret.User {
+			return invalidParams("user " + secret.User + " already exists")
+		}
+	}
+	ag.Secrets = append(ag.Secrets, secret)
+	return nil
+}
+
+func (s *Server) iscsiDeleteAuthGroup(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiDeleteAuthGroupArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	for i, ag := range s.authGroups {
+		if ag.Tag == args.Tag {
+			s.authGroups = append(s.authGroups[:i], s.authGroups[i+1:]...)
+			return true, nil
+		}
+	}
+	return nil, invalidParams(fmt.Sprintf("Could not find auth group (%d)", args.Tag))
+}
+
+func (s *Server) iscsiGetAuthGroups(params json.RawMessage) (interface{}, error) {
+	result := []spdk.IscsiAuthGroup{}
+	for _, ag := range s.authGroups {
+		result = append(result, *ag)
+	}
+	return result, nil
+}
+
+func (s *Server) iscsiAuthGroupAddSecret(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiAuthGroupAddSecretArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	ag := s.findAuthGroup(args.Tag)
+	if ag == nil {
+		return nil, invalidParams(fmt.Sprintf("Could not find auth group (%d)", args.Tag))
+	}
+	err := addSecret(ag, spdk.IscsiChapSecret{
+		User:    args.User,
+		Secret:  args.Secret,
+		Muser:   args.Muser,
+		Msecret: args.Msecret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) iscsiAuthGroupRemoveSecret(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiAuthGroupRemoveSecretArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	ag := s.findAuthGroup(args.Tag)
+	if ag == nil {
+		return nil, invalidParams(fmt.Sprintf("Could not find auth group (%d)", args.Tag))
+	}
+	for i, secret := range ag.Secrets {
+		if secret.User == args.User {
+			ag.Secrets = append(ag.Secrets[:i], ag.Secrets[i+1:]...)
+			return true, nil
+		}
+	}
+	return nil, invalidParams("user " + args.User + " not found")
+}
+
+func (s *Server) iscsiSetDiscoveryAuth(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiSetDiscoveryAuthArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if err := checkChap(args.IscsiChap); err != nil {
+		return nil, err
+	}
+	s.iscsiOptions.DisableChap = args.DisableChap
+	s.iscsiOptions.RequireChap = args.RequireChap
+	s.iscsiOptions.MutualChap = args.MutualChap
+	s.iscsiOptions.ChapGroup = args.ChapGroup
+	return true, nil
+}
+
+// iscsiGetConnections reports no connections, there are
+// no iSCSI initiators for the fake target.
+func (s *Server) iscsiGetConnections(params json.RawMessage) (interface{}, error) {
+	return []spdk.IscsiConnection{}, nil
+}
+
+func (s *Server) iscsiGetOptions(params json.RawMessage) (interface{}, error) {
+	return s.iscsiOptions, nil
+}
+
+func (s *Server) iscsiSetOptions(params json.RawMessage) (interface{}, error) {
+	var args spdk.IscsiSetOptionsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	// The fake behaves like SPDK started with --wait-for-rpc until
+	// the first iSCSI object gets created.
+	if s.iscsiStarted() {
+		return nil, &spdk.JSONRPCError{
+			Code:    spdk.ErrInvalidState.Code,
+			Message: "Method may only be called during startup",
+		}
+	}
+	if err := checkChap(args.IscsiChap); err != nil {
+		return nil, err
+	}
+
+	options := defaultIscsiOptions()
+	setString := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	setInt := func(field *int, value int) {
+		if value != 0 {
+			*field = value
+		}
+	}
+	setString(&options.NodeBase, args.NodeBase)
+	setString(&options.AuthFile, args.AuthFile)
+	setInt(&options.MaxSessions, args.MaxSessions)
+	setInt(&options.MaxConnectionsPerSession, args.MaxConnectionsPerSession)
+	setInt(&options.MaxQueueDepth, args.MaxQueueDepth)
+	setInt(&options.DefaultTime2wait, args.DefaultTime2wait)
+	setInt(&options.DefaultTime2retain, args.DefaultTime2retain)
+	setInt(&options.FirstBurstLength, args.FirstBurstLength)
+	if args.ImmediateData != nil {
+		options.ImmediateData = *args.ImmediateData
+	}
+	options.AllowDuplicatedIsid = args.AllowDuplicatedIsid
+	setInt(&options.ErrorRecoveryLevel, args.ErrorRecoveryLevel)
+	setInt(&options.NopTimeout, args.NopTimeout)
+	setInt(&options.NopInInterval, args.NopInInterval)
+	options.DisableChap = args.DisableChap
+	options.RequireChap = args.RequireChap
+	options.MutualChap = args.MutualChap
+	options.ChapGroup = args.ChapGroup
+	setInt(&options.MaxLargeDatainPerConnection, args.MaxLargeDatainPerConnection)
+	setInt(&options.MaxR2tPerConnection, args.MaxR2tPerConnection)
+	setInt(&options.PduPoolSize, args.PduPoolSize)
+	setInt(&options.ImmediateDataPoolSize, args.ImmediateDataPoolSize)
+	setInt(&options.DataOutPoolSize, args.DataOutPoolSize)
+	s.iscsiOptions = options
+	return true, nil
+}
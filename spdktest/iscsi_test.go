@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIscsi(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	immediateData := false
+	_, err := spdk.IscsiSetOptions(ctx, client, spdk.IscsiSetOptionsArgs{NodeBase: "iqn.2018-11.io.example", ImmediateData: &immediateData})
+	assert.NoError(t, err, "Failed to set iSCSI options: %s", err)
+	options, err := spdk.IscsiGetOptions(ctx, client)
+	assert.NoError(t, err, "Failed to get iSCSI options: %s", err)
+	assert.Equal(t, "iqn.2018-11.io.example", options.NodeBase)
+	assert.False(t, options.ImmediateData)
+	assert.Equal(t, 64, options.MaxQueueDepth)
+
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 512})
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 512})
+
+	_, err = spdk.IscsiCreatePortalGroup(ctx, client, spdk.IscsiCreatePortalGroupArgs{
+		Tag:     1,
+		Portals: []spdk.IscsiPortal{{Host: "127.0.0.1", Port: "3260"}},
+	})
+	assert.NoError(t, err, "Failed to create portal group: %s", err)
+	_, err = spdk.IscsiCreateInitiatorGroup(ctx, client, spdk.IscsiCreateInitiatorGroupArgs{
+		Tag:        2,
+		Initiators: []string{"ANY"},
+		Netmasks:   []string{"127.0.0.1/32"},
+	})
+	assert.NoError(t, err, "Failed to create initiator group: %s", err)
+	_, err = spdk.IscsiInitiatorGroupAddInitiators(ctx, client, spdk.IscsiInitiatorGroupInitiatorsArgs{
+		Tag:        2,
+		Initiators: []string{"iqn.2018-11.io.example:host1"},
+	})
+	assert.NoError(t, err, "Failed to add initiator: %s", err)
+	_, err = spdk.IscsiInitiatorGroupRemoveInitiators(ctx, client, spdk.IscsiInitiatorGroupInitiatorsArgs{
+		Tag:        2,
+		Initiators: []string{"ANY"},
+	})
+	assert.NoError(t, err, "Failed to remove initiator: %s", err)
+	groups, err := spdk.IscsiGetInitiatorGroups(ctx, client)
+	assert.NoError(t, err, "Failed to get initiator groups: %s", err)
+	assert.Equal(t, spdk.IscsiGetInitiatorGroupsResponse{{
+		Tag:        2,
+		Initiators: []string{"iqn.2018-11.io.example:host1"},
+		Netmasks:   []string{"127.0.0.1/32"},
+	}}, groups)
+
+	_, err = spdk.IscsiCreateAuthGroup(ctx, client, spdk.IscsiCreateAuthGroupArgs{
+		Tag:     1,
+		Secrets: []spdk.IscsiChapSecret{{User: "user1", Secret: "secret1"}},
+	})
+	assert.NoError(t, err, "Failed to create auth group: %s", err)
+	_, err = spdk.IscsiAuthGroupAddSecret(ctx, client, spdk.IscsiAuthGroupAddSecretArgs{
+		Tag: 1, User: "user2", Secret: "secret2", Muser: "muser2", Msecret: "msecret2"})
+	assert.NoError(t, err, "Failed to add secret: %s", err)
+	_, err = spdk.IscsiAuthGroupRemoveSecret(ctx, client, spdk.IscsiAuthGroupRemoveSecretArgs{Tag: 1, User: "user1"})
+	assert.NoError(t, err, "Failed to remove secret: %s", err)
+	authGroups, err := spdk.IscsiGetAuthGroups(ctx, client)
+	assert.NoError(t, err, "Failed to get auth groups: %s", err)
+	if assert.Len(t, authGroups, 1) && assert.Len(t, authGroups[0].Secrets, 1) {
+		assert.Equal(t, "muser2", authGroups[0].Secrets[0].Muser)
+	}
+	_, err = spdk.IscsiSetDiscoveryAuth(ctx, client, spdk.IscsiSetDiscoveryAuthArgs{
+		IscsiChap: spdk.IscsiChap{RequireChap: true, ChapGroup: 1}})
+	assert.NoError(t, err, "Failed to set discovery auth: %s", err)
+	_, err = spdk.IscsiPortalGroupSetAuth(ctx, client, spdk.IscsiPortalGroupSetAuthArgs{
+		Tag: 1, IscsiChap: spdk.IscsiChap{DisableChap: true, RequireChap: true}})
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	_, err = spdk.IscsiCreateTargetNode(ctx, client, spdk.IscsiCreateTargetNodeArgs{
+		Name:       "disk1",
+		AliasName:  "Data Disk1",
+		PgIgMaps:   []spdk.IscsiPgIgMap{{PgTag: 1, IgTag: 2}},
+		Luns:       []spdk.IscsiLun{{BdevName: "Malloc0", LunID: 0}},
+		QueueDepth: 64,
+		IscsiChap:  spdk.IscsiChap{DisableChap: true},
+	})
+	assert.NoError(t, err, "Failed to create target node: %s", err)
+	const name = "iqn.2018-11.io.example:disk1"
+	_, err = spdk.IscsiTargetNodeAddLun(ctx, client, spdk.IscsiTargetNodeAddLunArgs{Name: name, BdevName: "Malloc1"})
+	assert.NoError(t, err, "Failed to add LUN: %s", err)
+	_, err = spdk.IscsiTargetNodeSetAuth(ctx, client, spdk.IscsiTargetNodeSetAuthArgs{
+		Name: name, IscsiChap: spdk.IscsiChap{RequireChap: true, MutualChap: true, ChapGroup: 1}})
+	assert.NoError(t, err, "Failed to set target node auth: %s", err)
+	_, err = spdk.IscsiTargetNodeRemovePgIgMaps(ctx, client, spdk.IscsiTargetNodePgIgMapsArgs{
+		Name: name, PgIgMaps: []spdk.IscsiPgIgMap{{PgTag: 1, IgTag: 2}}})
+	assert.NoError(t, err, "Failed to remove PG-IG map: %s", err)
+	_, err = spdk.IscsiTargetNodeAddPgIgMaps(ctx, client, spdk.IscsiTargetNodePgIgMapsArgs{
+		Name: name, PgIgMaps: []spdk.IscsiPgIgMap{{PgTag: 1, IgTag: 2}}})
+	assert.NoError(t, err, "Failed to add PG-IG map: %s", err)
+
+	nodes, err := spdk.IscsiGetTargetNodes(ctx, client)
+	assert.NoError(t, err, "Failed to get target nodes: %s", err)
+	assert.Equal(t, spdk.IscsiGetTargetNodesResponse{{
+		Name:       name,
+		AliasName:  "Data Disk1",
+		PgIgMaps:   []spdk.IscsiPgIgMap{{PgTag: 1, IgTag: 2}},
+		Luns:       []spdk.IscsiLun{{BdevName: "Malloc0", LunID: 0}, {BdevName: "Malloc1", LunID: 1}},
+		QueueDepth: 64,
+		IscsiChap:  spdk.IscsiChap{RequireChap: true, MutualChap: true, ChapGroup: 1},
+	}}, nodes)
+
+	connections, err := spdk.IscsiGetConnections(ctx, client)
+	assert.NoError(t, err, "Failed to get connections: %s", err)
+	assert.Empty(t, connections)
+
+	// Options are only accepted during startup.
+	_, err = spdk.IscsiSetOptions(ctx, client, spdk.IscsiSetOptionsArgs{MaxSessions: 16})
+	assert.ErrorIs(t, err, spdk.ErrInvalidState)
+
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc1"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	_, err = spdk.IscsiDeleteTargetNode(ctx, client, spdk.IscsiDeleteTargetNodeArgs{Name: name})
+	assert.NoError(t, err, "Failed to delete target node: %s", err)
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc1"})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+
+	_, err = spdk.IscsiDeletePortalGroup(ctx, client, spdk.IscsiDeletePortalGroupArgs{Tag: 1})
+	assert.NoError(t, err, "Failed to delete portal group: %s", err)
+	portalGroups, err := spdk.IscsiGetPortalGroups(ctx, client)
+	assert.NoError(t, err, "Failed to get portal groups: %s", err)
+	assert.Empty(t, portalGroups)
+	_, err = spdk.IscsiDeleteInitiatorGroup(ctx, client, spdk.IscsiDeleteInitiatorGroupArgs{Tag: 2})
+	assert.NoError(t, err, "Failed to delete initiator group: %s", err)
+	_, err = spdk.IscsiDeleteAuthGroup(ctx, client, spdk.IscsiDeleteAuthGroupArgs{Tag: 1})
+	assert.NoError(t, err, "Failed to delete auth group: %s", err)
+}
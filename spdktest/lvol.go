@@ -0,0 +1,727 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+const (
+	lvolProductName        = "Logical Volume"
+	defaultLvolClusterSize = 4 * 1024 * 1024
+)
+
+type lvstore struct {
+	uuid          string
+	name          string
+	base          *bdev
+	clusterSize   int64
+	totalClusters int64
+	lvols         []*lvol
+}
+
+func (lvs *lvstore) freeClusters() int64 {
+	free := lvs.totalClusters
+	for _, l := range lvs.lvols {
+		free -= l.allocated
+	}
+	return free
+}
+
+func (lvs *lvstore) findLvol(name string) *lvol {
+	for _, l := range lvs.lvols {
+		if l.name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+func (lvs *lvstore) info() map[string]interface{} {
+	return map[string]interface{}{
+		"uuid":                lvs.uuid,
+		"name":                lvs.name,
+		"base_bdev":           lvs.base.name,
+		"free_clusters":       lvs.freeClusters(),
+		"cluster_size":        lvs.clusterSize,
+		"total_data_clusters": lvs.totalClusters,
+		"block_size":          lvs.base.blockSize,
+	}
+}
+
+// lvol is a logical volume. Snapshots are lvols too: they are read-only
+// and the parent of their clones. Only the number of allocated clusters
+// is tracked, not which ones, so cluster accounting for snapshot
+// deletion and decoupling is an upper bound.
+type lvol struct {
+	lvs         *lvstore
+	name        string
+	bdev        *bdev
+	numClusters int64
+	allocated   int64
+	thin        bool
+	readOnly    bool
+	snapshot    bool
+	parent      *lvol
+	clones      []*lvol
+	xattrs      map[string]string
+}
+
+func (l *lvol) alias() string {
+	return l.lvs.name + "/" + l.name
+}
+
+// updateAlias updates the bdev alias after a rename.
+func (l *lvol) updateAlias() {
+	l.bdev.aliases = []string{l.alias()}
+}
+
+// errReadOnly is reported for changes of read-only lvols, with the code
+// of SPDK, which reports blobstore errors as internal errors.
+func (l *lvol) errReadOnly() error {
+	return &spdk.JSONRPCError{
+		Code:    spdk.ERROR_INTERNAL_ERROR,
+		Message: "lvol " + l.alias() + " is read-only: Operation not permitted",
+	}
+}
+
+func (l *lvol) info() map[string]interface{} {
+	return map[string]interface{}{
+		"alias":               l.alias(),
+		"uuid":                l.bdev.uuid,
+		"name":                l.name,
+		"is_thin_provisioned": l.thin,
+		"is_snapshot":         l.snapshot,
+		"is_clone":            l.parent != nil,
+		"is_esnap_clone":      false,
+		"is_degraded":         false,
+		"lvs": map[string]interface{}{
+			"name": l.lvs.name,
+			"uuid": l.lvs.uuid,
+		},
+	}
+}
+
+func (l *lvol) driverSpecific() map[string]interface{} {
+	info := map[string]interface{}{
+		"lvol_store_uuid":        l.lvs.uuid,
+		"base_bdev":              l.lvs.base.name,
+		"thin_provision":         l.thin,
+		"num_allocated_clusters": l.allocated,
+		"snapshot":               l.snapshot,
+		"clone":                  l.parent != nil,
+	}
+	if l.parent != nil {
+		info["base_snapshot"] = l.parent.name
+	}
+	if l.snapshot {
+		clones := []string{}
+		for _, c := range l.clones {
+			clones = append(clones, c.name)
+		}
+		info["clones"] = clones
+	}
+	return map[string]interface{}{"lvol": info}
+}
+
+func removeLvol(lvols []*lvol, l *lvol) []*lvol {
+	for i := range lvols {
+		if lvols[i] == l {
+			return append(lvols[:i], lvols[i+1:]...)
+		}
+	}
+	return lvols
+}
+
+func replaceLvol(lvols []*lvol, old, new *lvol) {
+	for i := range lvols {
+		if lvols[i] == old {
+			lvols[i] = new
+		}
+	}
+}
+
+func (s *Server) registerLvolMethods() {
+	s.methods["bdev_lvol_create_lvstore"] = s.bdevLvolCreateLvstore
+	s.methods["bdev_lvol_delete_lvstore"] = s.bdevLvolDeleteLvstore
+	s.methods["bdev_lvol_get_lvstores"] = s.bdevLvolGetLvstores
+	s.methods["bdev_lvol_create"] = s.bdevLvolCreate
+	s.methods["bdev_lvol_delete"] = s.bdevLvolDelete
+	s.methods["bdev_lvol_snapshot"] = s.bdevLvolSnapshot
+	s.methods["bdev_lvol_clone"] = s.bdevLvolClone
+	s.methods["bdev_lvol_set_read_only"] = s.bdevLvolSetReadOnly
+	s.methods["bdev_lvol_decouple_parent"] = s.bdevLvolDecoupleParent
+	s.methods["bdev_lvol_resize"] = s.bdevLvolResize
+	s.methods["bdev_lvol_rename"] = s.bdevLvolRename
+	s.methods["bdev_lvol_rename_lvstore"] = s.bdevLvolRenameLvstore
+	s.methods["bdev_lvol_inflate"] = s.bdevLvolInflate
+	s.methods["bdev_lvol_grow_lvstore"] = s.bdevLvolGrowLvstore
+	s.methods["bdev_lvol_get_lvols"] = s.bdevLvolGetLvols
+	s.methods["bdev_lvol_set_xattr"] = s.bdevLvolSetXattr
+	s.methods["bdev_lvol_get_xattr"] = s.bdevLvolGetXattr
+}
+
+// lvstoreArgs selects a lvstore, either by uuid or by name.
+type lvstoreArgs struct {
+	UUID    string `json:"uuid"`
+	LvsName string `json:"lvs_name"`
+}
+
+func (s *Server) lookupLvstore(args lvstoreArgs) (*lvstore, error) {
+	if (args.UUID == "") == (args.LvsName == "") {
+		return nil, invalidParams("either uuid or lvs_name must be specified, but not both")
+	}
+	for _, lvs := range s.lvstores {
+		if lvs.uuid == args.UUID || lvs.name == args.LvsName {
+			return lvs, nil
+		}
+	}
+	return nil, errnoError(spdk.ErrNoDevice, "lvstore %s%s not found", args.UUID, args.LvsName)
+}
+
+// lookupLvol finds a lvol by bdev name, alias or UUID.
+func (s *Server) lookupLvol(name string) (*lvol, error) {
+	b := s.findBdev(name)
+	if b != nil {
+		for _, lvs := range s.lvstores {
+			for _, l := range lvs.lvols {
+				if l.bdev == b {
+					return l, nil
+				}
+			}
+		}
+	}
+	return nil, errnoError(spdk.ErrNoDevice, "lvol %s not found", name)
+}
+
+func (s *Server) bdevLvolCreateLvstore(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		BdevName    string `json:"bdev_name"`
+		LvsName     string `json:"lvs_name"`
+		ClusterSz   int64  `json:"cluster_sz"`
+		ClearMethod string `json:"clear_method"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.BdevName == "" || args.LvsName == "" {
+		return nil, invalidParams("bdev_name and lvs_name are required")
+	}
+	switch args.ClearMethod {
+	case "", "none", "unmap", "write_zeroes":
+	default:
+		return nil, invalidParams("unknown clear_method " + args.ClearMethod)
+	}
+
+	base, err := s.lookupBdev(args.BdevName)
+	if err != nil {
+		return nil, err
+	}
+	if err := base.inUse(); err != nil {
+		return nil, err
+	}
+	for _, lvs := range s.lvstores {
+		if lvs.name == args.LvsName {
+			return nil, errnoError(spdk.ErrExist, "lvstore %s already exists", args.LvsName)
+		}
+	}
+
+	clusterSize := args.ClusterSz
+	if clusterSize == 0 {
+		clusterSize = defaultLvolClusterSize
+	}
+	if clusterSize < base.blockSize || clusterSize%base.blockSize != 0 {
+		return nil, invalidParams("cluster_sz must be a multiple of the block size")
+	}
+	// One cluster is reserved for metadata.
+	totalClusters := base.blockSize*base.numBlocks/clusterSize - 1
+	if totalClusters <= 0 {
+		return nil, errnoError(spdk.ErrNoSpace, "bdev %s too small for lvstore", base.name)
+	}
+
+	lvs := &lvstore{
+		uuid:          newUUID(),
+		name:          args.LvsName,
+		base:          base,
+		clusterSize:   clusterSize,
+		totalClusters: totalClusters,
+	}
+	base.claimedBy = "lvol"
+	s.lvstores = append(s.lvstores, lvs)
+	return lvs.uuid, nil
+}
+
+func (s *Server) bdevLvolDeleteLvstore(params json.RawMessage) (interface{}, error) {
+	var args lvstoreArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	lvs, err := s.lookupLvstore(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// All lvols get deleted together with the lvstore.
+	for _, l := range lvs.lvols {
+		if err := l.bdev.inUse(); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range lvs.lvols {
+		s.removeBdev(l.bdev)
+	}
+	lvs.lvols = nil
+	lvs.base.claimedBy = ""
+	for i := range s.lvstores {
+		if s.lvstores[i] == lvs {
+			s.lvstores = append(s.lvstores[:i], s.lvstores[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) bdevLvolGetLvstores(params json.RawMessage) (interface{}, error) {
+	var args lvstoreArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	result := []interface{}{}
+	if args.UUID == "" && args.LvsName == "" {
+		for _, lvs := range s.lvstores {
+			result = append(result, lvs.info())
+		}
+		return result, nil
+	}
+	lvs, err := s.lookupLvstore(args)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, lvs.info()), nil
+}
+
+// addLvol registers the bdev of a new lvol.
+func (s *Server) addLvol(l *lvol) error {
+	if l.lvs.findLvol(l.name) != nil {
+		return errnoError(spdk.ErrExist, "lvol %s already exists", l.alias())
+	}
+	l.bdev = &bdev{
+		name:           newUUID(),
+		aliases:        []string{l.alias()},
+		productName:    lvolProductName,
+		blockSize:      l.lvs.base.blockSize,
+		numBlocks:      l.numClusters * l.lvs.clusterSize / l.lvs.base.blockSize,
+		driverSpecific: l.driverSpecific,
+	}
+	l.bdev.uuid = l.bdev.name
+	if err := s.addBdev(l.bdev); err != nil {
+		return err
+	}
+	l.lvs.lvols = append(l.lvs.lvols, l)
+	return nil
+}
+
+func (s *Server) bdevLvolCreate(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		LvolName      string `json:"lvol_name"`
+		Size          int64  `json:"size"`
+		ThinProvision bool   `json:"thin_provision"`
+		UUID          string `json:"uuid"`
+		LvsName       string `json:"lvs_name"`
+		ClearMethod   string `json:"clear_method"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.LvolName == "" || args.Size <= 0 {
+		return nil, invalidParams("lvol_name and a positive size are required")
+	}
+	lvs, err := s.lookupLvstore(lvstoreArgs{UUID: args.UUID, LvsName: args.LvsName})
+	if err != nil {
+		return nil, err
+	}
+
+	numClusters := (args.Size + lvs.clusterSize - 1) / lvs.clusterSize
+	l := &lvol{
+		lvs:         lvs,
+		name:        args.LvolName,
+		numClusters: numClusters,
+		thin:        args.ThinProvision,
+	}
+	if !l.thin {
+		if numClusters > lvs.freeClusters() {
+			return nil, errnoError(spdk.ErrNoSpace, "lvstore %s", lvs.name)
+		}
+		l.allocated = numClusters
+	}
+	if err := s.addLvol(l); err != nil {
+		return nil, err
+	}
+	return l.bdev.uuid, nil
+}
+
+func (s *Server) bdevLvolDelete(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.bdev.inUse(); err != nil {
+		return nil, err
+	}
+	if len(l.clones) > 1 {
+		return nil, errnoError(spdk.ErrBusy, "snapshot %s has more than one clone", l.alias())
+	}
+
+	if len(l.clones) == 1 {
+		// The only clone takes over the clusters of the
+		// snapshot and gets the parent of the snapshot.
+		clone := l.clones[0]
+		clone.allocated += l.allocated
+		if clone.allocated > clone.numClusters {
+			clone.allocated = clone.numClusters
+		}
+		clone.parent = l.parent
+		if l.parent != nil {
+			replaceLvol(l.parent.clones, l, clone)
+		}
+	} else if l.parent != nil {
+		l.parent.clones = removeLvol(l.parent.clones, l)
+	}
+
+	l.lvs.lvols = removeLvol(l.lvs.lvols, l)
+	s.removeBdev(l.bdev)
+	return true, nil
+}
+
+func (s *Server) bdevLvolSnapshot(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		LvolName     string `json:"lvol_name"`
+		SnapshotName string `json:"snapshot_name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.LvolName == "" || args.SnapshotName == "" {
+		return nil, invalidParams("lvol_name and snapshot_name are required")
+	}
+	origin, err := s.lookupLvol(args.LvolName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The snapshot takes over the clusters of the origin and
+	// is inserted between the origin and its parent.
+	snapshot := &lvol{
+		lvs:         origin.lvs,
+		name:        args.SnapshotName,
+		numClusters: origin.numClusters,
+		allocated:   origin.allocated,
+		readOnly:    true,
+		snapshot:    true,
+		parent:      origin.parent,
+		clones:      []*lvol{origin},
+	}
+	if err := s.addLvol(snapshot); err != nil {
+		return nil, err
+	}
+	if origin.parent != nil {
+		replaceLvol(origin.parent.clones, origin, snapshot)
+	}
+	origin.parent = snapshot
+	origin.allocated = 0
+	origin.thin = true
+	return snapshot.bdev.uuid, nil
+}
+
+func (s *Server) bdevLvolClone(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		SnapshotName string `json:"snapshot_name"`
+		CloneName    string `json:"clone_name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.SnapshotName == "" || args.CloneName == "" {
+		return nil, invalidParams("snapshot_name and clone_name are required")
+	}
+	parent, err := s.lookupLvol(args.SnapshotName)
+	if err != nil {
+		return nil, err
+	}
+	if !parent.readOnly {
+		return nil, errnoError(spdk.ErrInvalid, "lvol %s is not read-only", parent.alias())
+	}
+
+	clone := &lvol{
+		lvs:         parent.lvs,
+		name:        args.CloneName,
+		numClusters: parent.numClusters,
+		thin:        true,
+		parent:      parent,
+	}
+	if err := s.addLvol(clone); err != nil {
+		return nil, err
+	}
+	parent.clones = append(parent.clones, clone)
+	return clone.bdev.uuid, nil
+}
+
+func (s *Server) bdevLvolSetReadOnly(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	l.readOnly = true
+	return true, nil
+}
+
+func (s *Server) bdevLvolDecoupleParent(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	parent := l.parent
+	if parent == nil {
+		return nil, errnoError(spdk.ErrInvalid, "lvol %s has no parent", l.alias())
+	}
+
+	// The clusters allocated in the parent get copied.
+	allocated := l.allocated + parent.allocated
+	if allocated > l.numClusters {
+		allocated = l.numClusters
+	}
+	if allocated-l.allocated > l.lvs.freeClusters() {
+		return nil, errnoError(spdk.ErrNoSpace, "lvstore %s", l.lvs.name)
+	}
+	l.allocated = allocated
+
+	parent.clones = removeLvol(parent.clones, l)
+	l.parent = parent.parent
+	if l.parent != nil {
+		l.parent.clones = append(l.parent.clones, l)
+	}
+	return true, nil
+}
+
+func (s *Server) bdevLvolResize(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolResizeArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" || (args.Size == nil) == (args.SizeInMib == nil) {
+		return nil, invalidParams("name and either size or size_in_mib are required")
+	}
+	var size int64
+	if args.Size != nil {
+		size = *args.Size
+	} else {
+		size = *args.SizeInMib * 1024 * 1024
+	}
+	if size < 0 {
+		return nil, invalidParams("size must not be negative")
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	if l.readOnly {
+		return nil, l.errReadOnly()
+	}
+
+	numClusters := (size + l.lvs.clusterSize - 1) / l.lvs.clusterSize
+	allocated := l.allocated
+	if !l.thin {
+		allocated = numClusters
+	} else if allocated > numClusters {
+		allocated = numClusters
+	}
+	if allocated-l.allocated > l.lvs.freeClusters() {
+		return nil, errnoError(spdk.ErrNoSpace, "lvstore %s", l.lvs.name)
+	}
+	l.numClusters = numClusters
+	l.allocated = allocated
+	l.bdev.numBlocks = numClusters * l.lvs.clusterSize / l.lvs.base.blockSize
+	return true, nil
+}
+
+func (s *Server) bdevLvolRename(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolRenameArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.OldName == "" || args.NewName == "" {
+		return nil, invalidParams("old_name and new_name are required")
+	}
+	l, err := s.lookupLvol(args.OldName)
+	if err != nil {
+		return nil, err
+	}
+	if l.name == args.NewName {
+		return true, nil
+	}
+	if l.lvs.findLvol(args.NewName) != nil {
+		return nil, errnoError(spdk.ErrExist, "lvol %s/%s already exists", l.lvs.name, args.NewName)
+	}
+	l.name = args.NewName
+	l.updateAlias()
+	return true, nil
+}
+
+func (s *Server) bdevLvolRenameLvstore(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolRenameLvstoreArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.OldName == "" || args.NewName == "" {
+		return nil, invalidParams("old_name and new_name are required")
+	}
+	lvs, err := s.lookupLvstore(lvstoreArgs{LvsName: args.OldName})
+	if err != nil {
+		return nil, err
+	}
+	if lvs.name == args.NewName {
+		return true, nil
+	}
+	for _, other := range s.lvstores {
+		if other.name == args.NewName {
+			return nil, errnoError(spdk.ErrExist, "lvstore %s already exists", args.NewName)
+		}
+	}
+	lvs.name = args.NewName
+	for _, l := range lvs.lvols {
+		l.updateAlias()
+	}
+	return true, nil
+}
+
+func (s *Server) bdevLvolInflate(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolInflateArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	// SPDK fails with EPERM, blob_request_submit_op does not
+	// write to a snapshot when allocating its clusters.
+	if l.readOnly {
+		return nil, l.errReadOnly()
+	}
+
+	// Unlike decoupling, inflating allocates all clusters.
+	if l.numClusters-l.allocated > l.lvs.freeClusters() {
+		return nil, errnoError(spdk.ErrNoSpace, "lvstore %s", l.lvs.name)
+	}
+	l.allocated = l.numClusters
+	l.thin = false
+	if l.parent != nil {
+		l.parent.clones = removeLvol(l.parent.clones, l)
+		l.parent = nil
+	}
+	return true, nil
+}
+
+func (s *Server) bdevLvolGrowLvstore(params json.RawMessage) (interface{}, error) {
+	var args lvstoreArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	lvs, err := s.lookupLvstore(args)
+	if err != nil {
+		return nil, err
+	}
+	// Only ever grow, the clusters of the lvstore metadata stay
+	// reserved like on creation.
+	totalClusters := lvs.base.blockSize*lvs.base.numBlocks/lvs.clusterSize - 1
+	if totalClusters > lvs.totalClusters {
+		lvs.totalClusters = totalClusters
+	}
+	return true, nil
+}
+
+func (s *Server) bdevLvolGetLvols(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolGetLvolsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	lvstores := s.lvstores
+	if args.LvsUuid != "" || args.LvsName != "" {
+		lvs, err := s.lookupLvstore(lvstoreArgs{UUID: args.LvsUuid, LvsName: args.LvsName})
+		if err != nil {
+			return nil, err
+		}
+		lvstores = []*lvstore{lvs}
+	}
+	result := []interface{}{}
+	for _, lvs := range lvstores {
+		for _, l := range lvs.lvols {
+			result = append(result, l.info())
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) bdevLvolSetXattr(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolSetXattrArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.XattrName == "" {
+		return nil, invalidParams("xattr_name is required")
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	if l.readOnly {
+		return nil, l.errReadOnly()
+	}
+	if l.xattrs == nil {
+		l.xattrs = make(map[string]string)
+	}
+	l.xattrs[args.XattrName] = args.XattrValue
+	return true, nil
+}
+
+func (s *Server) bdevLvolGetXattr(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevLvolGetXattrArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	l, err := s.lookupLvol(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := l.xattrs[args.XattrName]
+	if !ok {
+		return nil, errnoError(spdk.ErrNoEntry, "xattr %s of lvol %s", args.XattrName, l.alias())
+	}
+	return value, nil
+}
@@ -0,0 +1,419 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func lvolDriverSpecific(t *testing.T, client spdk.Invoker, name string) map[string]interface{} {
+	bdevs, err := spdk.BdevGetBdevs(context.Background(), client, spdk.BdevGetBdevsArgs{Name: name})
+	if !assert.NoError(t, err, "Failed to get bdev %s: %s", name, err) || !assert.Len(t, bdevs, 1) {
+		return nil
+	}
+	var driverSpecific struct {
+		Lvol map[string]interface{} `json:"lvol"`
+	}
+	data, _ := json.Marshal(bdevs[0].DriverSpecific)
+	json.Unmarshal(data, &driverSpecific)
+	return driverSpecific.Lvol
+}
+
+// planMethods returns the methods called by the steps of plan.
+func planMethods(plan spdk.LvolDeletePlan) []string {
+	result := []string{}
+	for _, step := range plan {
+		result = append(result, step.Method)
+	}
+	return result
+}
+
+// lvolNames returns the names of nodes.
+func lvolNames(nodes []*spdk.LvolNode) []string {
+	result := []string{}
+	for _, n := range nodes {
+		result = append(result, n.Name)
+	}
+	return result
+}
+
+func TestLvol(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	lvsUUID := createLvstore(t, client, 102400)
+
+	lvstores, err := spdk.BdevLvolGetLvstores(ctx, client, spdk.BdevLvolGetLvstoresArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to list lvstore: %s", err)
+	if assert.Len(t, lvstores, 1) {
+		assert.Equal(t, lvsUUID, lvstores[0].Uuid)
+		assert.Equal(t, "Malloc0", lvstores[0].BaseBdev)
+		assert.Equal(t, 99, lvstores[0].TotalDataClusters)
+	}
+
+	// The base bdev is claimed by the lvstore.
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+
+	_, err = spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{
+		LvolName:      "Lvol0",
+		Size:          4096 * 4096 * 10,
+		ThinProvision: true,
+		LvsName:       "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvol bdev: %s", err)
+
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{
+		LvolName:     "Lvs0/Lvol0",
+		SnapshotName: "lvol0-snapshot"})
+	assert.NoError(t, err, "Failed to create lvol snapshot: %s", err)
+
+	_, err = spdk.BdevLvolClone(ctx, client, spdk.BdevLvolCloneArgs{
+		SnapshotName: "Lvs0/lvol0-snapshot",
+		CloneName:    "lvol0-clone"})
+	assert.NoError(t, err, "Failed to create lvol clone: %s", err)
+
+	snapshot := lvolDriverSpecific(t, client, "Lvs0/lvol0-snapshot")
+	assert.Equal(t, true, snapshot["snapshot"])
+	assert.ElementsMatch(t, []interface{}{"Lvol0", "lvol0-clone"}, snapshot["clones"])
+	clone := lvolDriverSpecific(t, client, "Lvs0/lvol0-clone")
+	assert.Equal(t, true, clone["clone"])
+	assert.Equal(t, "lvol0-snapshot", clone["base_snapshot"])
+
+	// Cloning requires a read-only lvol.
+	_, err = spdk.BdevLvolClone(ctx, client, spdk.BdevLvolCloneArgs{
+		SnapshotName: "Lvs0/Lvol0",
+		CloneName:    "lvol0-clone2"})
+	assert.ErrorIs(t, err, spdk.ErrInvalid)
+
+	_, err = spdk.BdevLvolSetReadOnly(ctx, client, spdk.BdevLvolSetReadOnlyArgs{Name: "Lvs0/Lvol0"})
+	assert.NoError(t, err, "Failed to set lvol read-only: %s", err)
+
+	// A snapshot with more than one clone cannot be deleted.
+	_, err = spdk.BdevLvolDelete(ctx, client, spdk.BdevLvolDeleteArgs{Name: "Lvs0/lvol0-snapshot"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+
+	_, err = spdk.BdevLvolDecoupleParent(ctx, client, spdk.BdevLvolDecoupleParentArgs{Name: "Lvs0/lvol0-clone"})
+	assert.NoError(t, err, "Failed to decouple lvol: %s", err)
+	clone = lvolDriverSpecific(t, client, "Lvs0/lvol0-clone")
+	assert.Equal(t, false, clone["clone"])
+	assert.NotContains(t, clone, "base_snapshot")
+
+	// With only one clone left, the snapshot can be deleted.
+	_, err = spdk.BdevLvolDelete(ctx, client, spdk.BdevLvolDeleteArgs{Name: "Lvs0/lvol0-snapshot"})
+	assert.NoError(t, err, "Failed to delete snapshot: %s", err)
+	lvol := lvolDriverSpecific(t, client, "Lvs0/Lvol0")
+	assert.Equal(t, false, lvol["clone"])
+
+	_, err = spdk.BdevLvolDelete(ctx, client, spdk.BdevLvolDeleteArgs{Name: "Lvs0/Lvol0"})
+	assert.NoError(t, err, "Failed to delete lvol bdev: %s", err)
+
+	lvstores, err = spdk.BdevLvolGetLvstores(ctx, client, spdk.BdevLvolGetLvstoresArgs{})
+	assert.NoError(t, err, "Failed to list lvstores: %s", err)
+	assert.Len(t, lvstores, 1)
+
+	_, err = spdk.BdevLvolDeleteLvstore(ctx, client, spdk.BdevLvolDeleteLvstoreArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to delete lvstore: %s", err)
+
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, "Malloc0", bdevs[0].Name)
+		assert.False(t, bdevs[0].Claimed)
+	}
+}
+
+func TestThickLvolSpace(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	createLvstore(t, client, 4096)
+
+	// 16 MiB with 4 MiB clusters leaves 3 data clusters.
+	_, err := spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "big", Size: 16 * 1024 * 1024, LvsName: "Lvs0"})
+	assert.ErrorIs(t, err, spdk.ErrNoSpace)
+	_, err = spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "small", Size: 1, LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+
+	lvstores, err := spdk.BdevLvolGetLvstores(ctx, client, spdk.BdevLvolGetLvstoresArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to list lvstore: %s", err)
+	if assert.Len(t, lvstores, 1) {
+		assert.Equal(t, 2, lvstores[0].FreeClusters)
+	}
+}
+
+func TestLvolLifecycle(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+	size := func(n int64) *int64 { return &n }
+
+	lvsUUID := createLvstore(t, client, 4096)
+	lvolUUID, err := spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "Lvol0", Size: 1, LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+
+	// Selecting the lvstore by both uuid and name is rejected
+	// before calling SPDK.
+	_, err = spdk.BdevLvolGrowLvstore(ctx, client, spdk.BdevLvolGrowLvstoreArgs{Uuid: lvsUUID, LvsName: "Lvs0"})
+	assert.Error(t, err)
+	_, err = spdk.BdevLvolGetLvols(ctx, client, spdk.BdevLvolGetLvolsArgs{LvsUuid: lvsUUID, LvsName: "Lvs0"})
+	assert.Error(t, err)
+	_, err = spdk.BdevLvolGrowLvstore(ctx, client, spdk.BdevLvolGrowLvstoreArgs{Uuid: lvsUUID})
+	assert.NoError(t, err, "Failed to grow lvstore: %s", err)
+
+	// The thick lvol has 1 of 3 data clusters, growing it to 3
+	// clusters needs all of them, 4 clusters do not fit.
+	_, err = spdk.BdevLvolResize(ctx, client, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol0", SizeInMib: size(16)})
+	assert.ErrorIs(t, err, spdk.ErrNoSpace)
+	_, err = spdk.BdevLvolResize(ctx, client, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol0", Size: size(1), SizeInMib: size(12)})
+	assert.Error(t, err)
+	_, err = spdk.BdevLvolResize(ctx, client, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol0", SizeInMib: size(12)})
+	assert.NoError(t, err, "Failed to resize lvol: %s", err)
+	lvstores, err := spdk.BdevLvolGetLvstores(ctx, client, spdk.BdevLvolGetLvstoresArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to list lvstore: %s", err)
+	if assert.Len(t, lvstores, 1) {
+		assert.Equal(t, 0, lvstores[0].FreeClusters)
+	}
+
+	_, err = spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "Lvol1", Size: 1, ThinProvision: true, LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+	_, err = spdk.BdevLvolResize(ctx, client, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol1", Size: size(0)})
+	assert.NoError(t, err, "Failed to resize lvol to 0: %s", err)
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: "Lvs0/Lvol1"})
+	assert.NoError(t, err, "Failed to get resized lvol: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, int64(0), bdevs[0].NumBlocks)
+	}
+	_, err = spdk.BdevLvolResize(ctx, client, spdk.BdevLvolResizeArgs{Name: "Lvs0/Lvol1", Size: size(1)})
+	assert.NoError(t, err, "Failed to resize lvol: %s", err)
+	_, err = spdk.BdevLvolRename(ctx, client, spdk.BdevLvolRenameArgs{OldName: "Lvs0/Lvol1", NewName: "Lvol0"})
+	assert.ErrorIs(t, err, spdk.ErrExist)
+	_, err = spdk.BdevLvolRename(ctx, client, spdk.BdevLvolRenameArgs{OldName: lvolUUID, NewName: "data"})
+	assert.NoError(t, err, "Failed to rename lvol: %s", err)
+	_, err = spdk.BdevLvolRenameLvstore(ctx, client, spdk.BdevLvolRenameLvstoreArgs{OldName: "Lvs0", NewName: "pool"})
+	assert.NoError(t, err, "Failed to rename lvstore: %s", err)
+
+	bdevs, err = spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: "pool/data"})
+	assert.NoError(t, err, "Failed to get renamed lvol: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, lvolUUID, bdevs[0].Name)
+		assert.Equal(t, int64(3*1024), bdevs[0].NumBlocks)
+	}
+
+	lvols, err := spdk.BdevLvolGetLvols(ctx, client, spdk.BdevLvolGetLvolsArgs{LvsName: "pool"})
+	assert.NoError(t, err, "Failed to list lvols: %s", err)
+	if assert.Len(t, lvols, 2) {
+		assert.Equal(t, spdk.Lvol{
+			Alias: "pool/data",
+			Uuid:  lvolUUID,
+			Name:  "data",
+			Lvs:   spdk.LvolLvstore{Name: "pool", Uuid: lvsUUID},
+		}, lvols[0])
+		assert.True(t, lvols[1].IsThinProvisioned)
+	}
+
+	_, err = spdk.BdevLvolGetXattr(ctx, client, spdk.BdevLvolGetXattrArgs{Name: "pool/data", XattrName: "owner"})
+	assert.ErrorIs(t, err, spdk.ErrNoEntry)
+	_, err = spdk.BdevLvolSetXattr(ctx, client, spdk.BdevLvolSetXattrArgs{Name: "pool/data", XattrName: "owner", XattrValue: "pod-1"})
+	assert.NoError(t, err, "Failed to set xattr: %s", err)
+	value, err := spdk.BdevLvolGetXattr(ctx, client, spdk.BdevLvolGetXattrArgs{Name: "pool/data", XattrName: "owner"})
+	assert.NoError(t, err, "Failed to get xattr: %s", err)
+	assert.Equal(t, "pod-1", value)
+
+	// Inflating a clone allocates the clusters it shares with
+	// the snapshot, of which there are none left.
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "pool/Lvol1", SnapshotName: "snap"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	_, err = spdk.BdevLvolSetXattr(ctx, client, spdk.BdevLvolSetXattrArgs{Name: "pool/snap", XattrName: "owner", XattrValue: "pod-1"})
+	assert.Error(t, err)
+	_, err = spdk.BdevLvolInflate(ctx, client, spdk.BdevLvolInflateArgs{Name: "pool/snap"})
+	assert.Error(t, err)
+	_, err = spdk.BdevLvolInflate(ctx, client, spdk.BdevLvolInflateArgs{Name: "pool/Lvol1"})
+	assert.ErrorIs(t, err, spdk.ErrNoSpace)
+	_, err = spdk.BdevLvolResize(ctx, client, spdk.BdevLvolResizeArgs{Name: "pool/data", SizeInMib: size(4)})
+	assert.NoError(t, err, "Failed to shrink lvol: %s", err)
+	_, err = spdk.BdevLvolInflate(ctx, client, spdk.BdevLvolInflateArgs{Name: "pool/Lvol1"})
+	assert.NoError(t, err, "Failed to inflate lvol: %s", err)
+
+	lvols, err = spdk.BdevLvolGetLvols(ctx, client, spdk.BdevLvolGetLvolsArgs{})
+	assert.NoError(t, err, "Failed to list lvols: %s", err)
+	if assert.Len(t, lvols, 3) {
+		assert.False(t, lvols[1].IsThinProvisioned)
+		assert.False(t, lvols[1].IsClone)
+		assert.True(t, lvols[2].IsSnapshot)
+	}
+}
+
+func TestLvolTree(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	createLvstore(t, client, 4096)
+	_, err := spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "vol", Size: 1, LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "Lvs0/vol", SnapshotName: "snap"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	_, err = spdk.BdevLvolClone(ctx, client, spdk.BdevLvolCloneArgs{SnapshotName: "Lvs0/snap", CloneName: "clone"})
+	assert.NoError(t, err, "Failed to create clone: %s", err)
+
+	tree, err := spdk.GetLvolTree(ctx, client, spdk.GetLvolTreeArgs{LvsName: "Lvs0"})
+	if err != nil {
+		t.Fatalf("Failed to get lvol tree: %s", err)
+	}
+	order := []string{}
+	for _, n := range tree.DeleteOrder() {
+		order = append(order, n.Alias)
+	}
+	assert.Equal(t, []string{"Lvs0/clone", "Lvs0/vol", "Lvs0/snap"}, order)
+	snap := tree.Find("Lvs0/snap")
+	if assert.NotNil(t, snap) {
+		assert.True(t, snap.Snapshot)
+		assert.False(t, snap.CanDelete())
+		assert.Equal(t, int64(4<<20), snap.TotalAllocatedSize())
+	}
+}
+
+func TestDeleteLvolRecursive(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+	const nqn = "nqn.2016-06.io.spdk:lvol"
+
+	createLvstore(t, client, 102400)
+	_, err := spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "vol", Size: 1, ThinProvision: true, LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "Lvs0/vol", SnapshotName: "snap"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	for _, name := range []string{"c1", "c2"} {
+		_, err := spdk.BdevLvolClone(ctx, client, spdk.BdevLvolCloneArgs{SnapshotName: "Lvs0/snap", CloneName: name})
+		assert.NoError(t, err, "Failed to create clone: %s", err)
+	}
+
+	_, err = spdk.NbdStartDisk(ctx, client, spdk.NbdStartDiskArgs{BdevName: "Lvs0/c1", NbdDevice: "/dev/nbd1"})
+	assert.NoError(t, err, "Failed to start nbd: %s", err)
+	_, err = spdk.VhostCreateBlkController(ctx, client, spdk.VhostCreateBlkControllerArgs{DevName: "Lvs0/c2", Ctrlr: "vhostblk0"})
+	assert.NoError(t, err, "Failed to create vhost-blk: %s", err)
+	_, err = spdk.VhostCreateScsiController(ctx, client, spdk.VhostCreateScsiControllerArgs{Ctrlr: "vhostscsi0"})
+	assert.NoError(t, err, "Failed to create vhost-scsi: %s", err)
+	_, err = spdk.VhostScsiControllerAddTarget(ctx, client,
+		spdk.VhostScsiControllerAddTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: 1, BdevName: "Lvs0/vol"})
+	assert.NoError(t, err, "Failed to add target: %s", err)
+	_, err = spdk.NvmfCreateSubsystem(ctx, client, spdk.NvmfCreateSubsystemArgs{Nqn: nqn, AllowAnyHost: true})
+	assert.NoError(t, err, "Failed to create subsystem: %s", err)
+	_, err = spdk.NvmfSubsystemAddNs(ctx, client, spdk.NvmfSubsystemAddNsArgs{Nqn: nqn, Namespace: spdk.NvmfNamespaceParams{BdevName: "Lvs0/vol"}})
+	assert.NoError(t, err, "Failed to add namespace: %s", err)
+
+	_, err = spdk.DeleteLvolRecursive(ctx, client, spdk.DeleteLvolRecursiveArgs{Name: "Lvs0/snap", PreserveClones: "copy"})
+	assert.Error(t, err)
+
+	// Dry runs change nothing.
+	plan, err := spdk.DeleteLvolRecursive(ctx, client, spdk.DeleteLvolRecursiveArgs{Name: "Lvs0/snap", DryRun: true})
+	assert.NoError(t, err, "Failed to plan deletion: %s", err)
+	assert.Equal(t, []string{
+		"nbd_stop_disk",
+		"vhost_delete_controller",
+		"vhost_scsi_controller_remove_target",
+		"nvmf_subsystem_remove_ns",
+		"bdev_lvol_delete",
+		"bdev_lvol_delete",
+		"bdev_lvol_delete",
+		"bdev_lvol_delete",
+	}, planMethods(plan))
+	assert.Contains(t, plan.String(), `nbd_stop_disk {"nbd_device":"/dev/nbd1"}`)
+	plan, err = spdk.DeleteLvolRecursive(ctx, client,
+		spdk.DeleteLvolRecursiveArgs{Name: "Lvs0/snap", PreserveClones: spdk.LvolPreserveDecouple, DryRun: true})
+	assert.NoError(t, err, "Failed to plan deletion: %s", err)
+	assert.Equal(t, []string{
+		"bdev_lvol_decouple_parent",
+		"bdev_lvol_decouple_parent",
+		"bdev_lvol_decouple_parent",
+		"bdev_lvol_delete",
+	}, planMethods(plan))
+	tree, err := spdk.GetLvolTree(ctx, client, spdk.GetLvolTreeArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to get lvol tree: %s", err)
+	assert.Len(t, tree.Lvols(), 4)
+
+	plan, err = spdk.DeleteLvolRecursive(ctx, client, spdk.DeleteLvolRecursiveArgs{Name: "Lvs0/c1"})
+	assert.NoError(t, err, "Failed to delete clone: %s", err)
+	assert.Equal(t, []string{"nbd_stop_disk", "bdev_lvol_delete"}, planMethods(plan))
+
+	// The remaining clones get inflated, keeping their users.
+	plan, err = spdk.DeleteLvolRecursive(ctx, client,
+		spdk.DeleteLvolRecursiveArgs{Name: "Lvs0/snap", PreserveClones: spdk.LvolPreserveInflate})
+	assert.NoError(t, err, "Failed to delete snapshot: %s", err)
+	assert.Equal(t, []string{"bdev_lvol_inflate", "bdev_lvol_inflate", "bdev_lvol_delete"}, planMethods(plan))
+	tree, err = spdk.GetLvolTree(ctx, client, spdk.GetLvolTreeArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to get lvol tree: %s", err)
+	if assert.Len(t, tree.Roots, 2) {
+		assert.Equal(t, "c2", tree.Roots[0].Name)
+		assert.False(t, tree.Roots[0].ThinProvision)
+		assert.Equal(t, "vol", tree.Roots[1].Name)
+	}
+
+	plan, err = spdk.DeleteLvstoreAndContents(ctx, client, spdk.DeleteLvstoreAndContentsArgs{LvsName: "Lvs0"})
+	assert.NoError(t, err, "Failed to delete lvstore: %s", err)
+	assert.Len(t, plan, 6)
+	lvstores, err := spdk.BdevLvolGetLvstores(ctx, client, spdk.BdevLvolGetLvstoresArgs{})
+	assert.NoError(t, err, "Failed to list lvstores: %s", err)
+	assert.Empty(t, lvstores)
+	controllers, err := spdk.VhostGetControllers(ctx, client, spdk.VhostGetControllersArgs{})
+	assert.NoError(t, err, "Failed to list vhost: %s", err)
+	if assert.Len(t, controllers, 1) {
+		assert.Equal(t, "vhostscsi0", controllers[0].Ctrlr)
+		assert.Equal(t, spdk.VhostScsiBackendSpecific{}, controllers[0].Backend)
+	}
+
+	// Users other than exports are left alone, the plan
+	// ends with the step which failed.
+	_, err = spdk.BdevLvolCreateLvstore(ctx, client, spdk.BdevLvolCreateLvstoreArgs{BdevName: "Malloc0", LvsName: "Lvs1"})
+	assert.NoError(t, err, "Failed to create lvstore: %s", err)
+	_, err = spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "vol", Size: 1, LvsName: "Lvs1"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+	_, err = spdk.BdevRaidCreate(ctx, client, spdk.BdevRaidCreateArgs{
+		Name: "Raid0", RaidLevel: spdk.RaidLevelConcat, StripSizeKB: 64, BaseBdevs: []string{"Lvs1/vol"}})
+	assert.NoError(t, err, "Failed to create raid: %s", err)
+	plan, err = spdk.DeleteLvolRecursive(ctx, client, spdk.DeleteLvolRecursiveArgs{Name: "Lvs1/vol"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	assert.Equal(t, []string{"bdev_lvol_delete"}, planMethods(plan))
+
+	// A clone which is a snapshot is not inflated, the deleted
+	// snapshot is merged into it. That works for one of them only.
+	_, err = spdk.BdevLvolCreate(ctx, client, spdk.BdevLvolCreateArgs{LvolName: "base", Size: 1, ThinProvision: true, LvsName: "Lvs1"})
+	assert.NoError(t, err, "Failed to create lvol: %s", err)
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "Lvs1/base", SnapshotName: "s1"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	_, err = spdk.BdevLvolClone(ctx, client, spdk.BdevLvolCloneArgs{SnapshotName: "Lvs1/s1", CloneName: "c1"})
+	assert.NoError(t, err, "Failed to create clone: %s", err)
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "Lvs1/base", SnapshotName: "s2"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	plan, err = spdk.DeleteLvolRecursive(ctx, client,
+		spdk.DeleteLvolRecursiveArgs{Name: "Lvs1/s1", PreserveClones: spdk.LvolPreserveInflate})
+	assert.NoError(t, err, "Failed to delete snapshot: %s", err)
+	assert.Equal(t, []string{"bdev_lvol_inflate", "bdev_lvol_delete"}, planMethods(plan))
+	tree, err = spdk.GetLvolTree(ctx, client, spdk.GetLvolTreeArgs{LvsName: "Lvs1"})
+	assert.NoError(t, err, "Failed to get lvol tree: %s", err)
+	if s2 := tree.Find("Lvs1/s2"); assert.NotNil(t, s2) {
+		assert.Nil(t, s2.Parent)
+		assert.Equal(t, []string{"base"}, lvolNames(s2.Clones))
+	}
+	if c1 := tree.Find("Lvs1/c1"); assert.NotNil(t, c1) {
+		assert.Nil(t, c1.Parent)
+		assert.False(t, c1.ThinProvision)
+	}
+
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "Lvs1/base", SnapshotName: "s3"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	_, err = spdk.BdevLvolClone(ctx, client, spdk.BdevLvolCloneArgs{SnapshotName: "Lvs1/s2", CloneName: "c2"})
+	assert.NoError(t, err, "Failed to create clone: %s", err)
+	_, err = spdk.BdevLvolSnapshot(ctx, client, spdk.BdevLvolSnapshotArgs{LvolName: "Lvs1/c2", SnapshotName: "s4"})
+	assert.NoError(t, err, "Failed to create snapshot: %s", err)
+	_, err = spdk.DeleteLvolRecursive(ctx, client,
+		spdk.DeleteLvolRecursiveArgs{Name: "Lvs1/s2", PreserveClones: spdk.LvolPreserveInflate})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+}
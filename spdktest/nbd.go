@@ -0,0 +1,127 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+type nbdDisk struct {
+	device string
+	bdev   *bdev
+}
+
+func (d *nbdDisk) user() string {
+	return "nbd disk " + d.device
+}
+
+func (d *nbdDisk) info() map[string]interface{} {
+	return map[string]interface{}{
+		"nbd_device": d.device,
+		"bdev_name":  d.bdev.name,
+	}
+}
+
+func (s *Server) findNbdDisk(device string) *nbdDisk {
+	for _, d := range s.nbdDisks {
+		if d.device == device {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) registerNbdMethods() {
+	s.methods["nbd_start_disk"] = s.nbdStartDisk
+	s.methods["nbd_get_disks"] = s.nbdGetDisks
+	s.methods["nbd_stop_disk"] = s.nbdStopDisk
+}
+
+func (s *Server) nbdStartDisk(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		BdevName  string `json:"bdev_name"`
+		NbdDevice string `json:"nbd_device"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.BdevName == "" {
+		return nil, invalidParams("bdev_name is required")
+	}
+	b, err := s.lookupBdev(args.BdevName)
+	if err != nil {
+		return nil, err
+	}
+	if b.claimedBy != "" {
+		return nil, b.inUse()
+	}
+
+	device := args.NbdDevice
+	if device == "" {
+		// Like SPDK, pick the first unused device.
+		for i := 0; ; i++ {
+			device = fmt.Sprintf("/dev/nbd%d", i)
+			if s.findNbdDisk(device) == nil {
+				break
+			}
+		}
+	} else if s.findNbdDisk(device) != nil {
+		return nil, errnoError(spdk.ErrBusy, "nbd device %s", device)
+	}
+
+	d := &nbdDisk{device: device, bdev: b}
+	b.open(d.user())
+	s.nbdDisks = append(s.nbdDisks, d)
+	return device, nil
+}
+
+func (s *Server) nbdGetDisks(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		NbdDevice string `json:"nbd_device"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	result := []interface{}{}
+	if args.NbdDevice != "" {
+		d := s.findNbdDisk(args.NbdDevice)
+		if d == nil {
+			return nil, errnoError(spdk.ErrNoDevice, "nbd device %s not found", args.NbdDevice)
+		}
+		return append(result, d.info()), nil
+	}
+	for _, d := range s.nbdDisks {
+		result = append(result, d.info())
+	}
+	return result, nil
+}
+
+func (s *Server) nbdStopDisk(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		NbdDevice string `json:"nbd_device"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	d := s.findNbdDisk(args.NbdDevice)
+	if d == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "nbd device %s not found", args.NbdDevice)
+	}
+
+	d.bdev.close(d.user())
+	for i := range s.nbdDisks {
+		if s.nbdDisks[i] == d {
+			s.nbdDisks = append(s.nbdDisks[:i], s.nbdDisks[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNbd(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+
+	device, err := spdk.NbdStartDisk(ctx, client, spdk.NbdStartDiskArgs{BdevName: "Malloc0", NbdDevice: "/dev/nbd4"})
+	assert.NoError(t, err, "Failed to start nbd: %s", err)
+	assert.Equal(t, "/dev/nbd4", device)
+
+	device, err = spdk.NbdStartDisk(ctx, client, spdk.NbdStartDiskArgs{BdevName: "Malloc0"})
+	assert.NoError(t, err, "Failed to start nbd: %s", err)
+	assert.Equal(t, "/dev/nbd0", device)
+
+	disks, err := spdk.NbdGetDisks(ctx, client, spdk.NbdGetDisksArgs{NbdDevice: "/dev/nbd4"})
+	assert.NoError(t, err, "Failed to list nbd: %s", err)
+	assert.Equal(t, spdk.NbdGetDisksResponse{{BdevName: "Malloc0", NbdDevice: "/dev/nbd4"}}, disks)
+
+	disks, err = spdk.NbdGetDisks(ctx, client, spdk.NbdGetDisksArgs{})
+	assert.NoError(t, err, "Failed to list nbd: %s", err)
+	assert.Len(t, disks, 2)
+
+	for _, device := range []string{"/dev/nbd4", "/dev/nbd0"} {
+		_, err = spdk.NbdStopDisk(ctx, client, spdk.NbdStopDiskArgs{NbdDevice: device})
+		assert.NoError(t, err, "Failed to stop nbd %s: %s", device, err)
+	}
+
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// maxNotifications is the number of notifications kept, older
+// ones get dropped like from the ring buffer of SPDK.
+const maxNotifications = 1024
+
+func (s *Server) notify(notificationType, ctx string) {
+	s.notifications = append(s.notifications, spdk.Notification{
+		Type: notificationType,
+		Ctx:  ctx,
+		ID:   s.nextNotification,
+	})
+	s.nextNotification++
+	if len(s.notifications) > maxNotifications {
+		s.notifications = s.notifications[len(s.notifications)-maxNotifications:]
+	}
+}
+
+func (s *Server) registerNotifyMethods() {
+	s.methods["notify_get_types"] = s.notifyGetTypes
+	s.methods["notify_get_notifications"] = s.notifyGetNotifications
+}
+
+func (s *Server) notifyGetTypes(params json.RawMessage) (interface{}, error) {
+	if params != nil {
+		return nil, invalidParams("notify_get_types requires no parameters")
+	}
+	return []string{spdk.NotificationBdevRegister, spdk.NotificationBdevUnregister}, nil
+}
+
+func (s *Server) notifyGetNotifications(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		ID  uint64 `json:"id"`
+		Max uint64 `json:"max"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	result := []spdk.Notification{}
+	for _, n := range s.notifications {
+		if args.Max > 0 && uint64(len(result)) >= args.Max {
+			break
+		}
+		if n.ID >= args.ID {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
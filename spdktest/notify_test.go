@@ -0,0 +1,44 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifications(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	types, err := spdk.NotifyGetTypes(ctx, client)
+	assert.NoError(t, err, "Failed to get notification types: %s", err)
+	assert.ElementsMatch(t, []string{spdk.NotificationBdevRegister, spdk.NotificationBdevUnregister}, types)
+
+	for _, name := range []string{"Malloc0", "Malloc1"} {
+		createMalloc(t, client, spdk.BdevMallocCreateArgs{Name: name, NumBlocks: 1024, BlockSize: 512})
+	}
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to delete Malloc0: %s", err)
+
+	notifications, err := spdk.NotifyGetNotifications(ctx, client, spdk.NotifyGetNotificationsArgs{})
+	assert.NoError(t, err, "Failed to get notifications: %s", err)
+	assert.Equal(t, spdk.NotifyGetNotificationsResponse{
+		{Type: spdk.NotificationBdevRegister, Ctx: "Malloc0", ID: 0},
+		{Type: spdk.NotificationBdevRegister, Ctx: "Malloc1", ID: 1},
+		{Type: spdk.NotificationBdevUnregister, Ctx: "Malloc0", ID: 2},
+	}, notifications)
+
+	notifications, err = spdk.NotifyGetNotifications(ctx, client, spdk.NotifyGetNotificationsArgs{ID: 1, Max: 1})
+	assert.NoError(t, err, "Failed to get notifications: %s", err)
+	assert.Equal(t, spdk.NotifyGetNotificationsResponse{
+		{Type: spdk.NotificationBdevRegister, Ctx: "Malloc1", ID: 1},
+	}, notifications)
+}
@@ -0,0 +1,475 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// nvmeController is a NVMe-oF controller attached by bdev_nvme,
+// with one path per bdev_nvme_attach_controller call.
+type nvmeController struct {
+	name       string
+	subnqn     string
+	paths      []*nvmePath
+	namespaces []*nvmeNamespace
+}
+
+type nvmeNamespace struct {
+	nsid int
+	bdev *bdev
+	// policy is one of the multipath policies.
+	policy string
+}
+
+type nvmePath struct {
+	addr      fabricAddress
+	trid      spdk.NvmeTransportID
+	host      spdk.NvmeControllerHost
+	cntlid    int
+	subsystem *fabricSubsystem
+}
+
+// state is "failed" when the target went away.
+func (p *nvmePath) state() string {
+	if fabricLookup(p.addr, p.trid.Subnqn) == nil {
+		return "failed"
+	}
+	return "enabled"
+}
+
+// anaState returns the ANA state of namespace nsid through p,
+// "" if the target went away.
+func (p *nvmePath) anaState(nsid int) spdk.NvmfAnaState {
+	sub := fabricLookup(p.addr, p.trid.Subnqn)
+	if sub == nil {
+		return ""
+	}
+	for _, ns := range sub.namespaces {
+		if ns.nsid == nsid {
+			return sub.anaState(p.addr, ns.anagrpid)
+		}
+	}
+	return spdk.NvmfAnaInaccessible
+}
+
+func (p *nvmePath) info() map[string]interface{} {
+	return map[string]interface{}{
+		"state":  p.state(),
+		"trid":   p.trid,
+		"cntlid": p.cntlid,
+		"host":   p.host,
+	}
+}
+
+func (c *nvmeController) info() map[string]interface{} {
+	ctrlrs := []interface{}{}
+	for _, p := range c.paths {
+		ctrlrs = append(ctrlrs, p.info())
+	}
+	return map[string]interface{}{
+		"name":   c.name,
+		"ctrlrs": ctrlrs,
+	}
+}
+
+// driverSpecific returns the driver_specific member for the
+// bdev of namespace nsid.
+func (c *nvmeController) driverSpecific(nsid int) map[string]interface{} {
+	paths := []interface{}{}
+	for _, p := range c.paths {
+		paths = append(paths, map[string]interface{}{
+			"trid": p.trid,
+			"ctrlr_data": map[string]interface{}{
+				"cntlid":            p.cntlid,
+				"vendor_id":         "0x8086",
+				"model_number":      p.subsystem.modelNumber,
+				"serial_number":     p.subsystem.serialNumber,
+				"firmware_revision": "23.01",
+				"subnqn":            p.subsystem.nqn,
+			},
+			"vs":      map[string]interface{}{"nvme_version": "1.3"},
+			"ns_data": map[string]interface{}{"id": nsid, "can_share": true},
+		})
+	}
+	return map[string]interface{}{"nvme": paths}
+}
+
+func (s *Server) findNvmeController(name string) *nvmeController {
+	for _, c := range s.nvmeControllers {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupNvmeController(name string) (*nvmeController, error) {
+	c := s.findNvmeController(name)
+	if c == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "NVMe controller %s not found", name)
+	}
+	return c, nil
+}
+
+func (s *Server) registerNvmeMethods() {
+	s.methods["bdev_nvme_attach_controller"] = s.bdevNvmeAttachController
+	s.methods["bdev_nvme_detach_controller"] = s.bdevNvmeDetachController
+	s.methods["bdev_nvme_get_controllers"] = s.bdevNvmeGetControllers
+	s.methods["bdev_nvme_reset_controller"] = s.bdevNvmeResetController
+	s.methods["bdev_nvme_set_options"] = s.bdevNvmeSetOptions
+	s.methods["bdev_nvme_set_hotplug"] = s.bdevNvmeSetHotplug
+	s.methods["bdev_nvme_get_io_paths"] = s.bdevNvmeGetIoPaths
+	s.methods["bdev_nvme_set_multipath_policy"] = s.bdevNvmeSetMultipathPolicy
+}
+
+const nvmeProductName = "NVMe disk"
+
+func (s *Server) bdevNvmeAttachController(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		spdk.BdevNvmeAttachControllerArgs
+		Psk      string `json:"psk"`
+		Priority string `json:"priority"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" || args.Trtype == "" || args.Traddr == "" {
+		return nil, invalidParams("name, trtype and traddr are required")
+	}
+	if strings.EqualFold(args.Trtype, spdk.NvmeTransportPCIe) {
+		return nil, errnoError(spdk.ErrNoDevice, "no NVMe device at %s", args.Traddr)
+	}
+	if args.Subnqn == "" || args.Trsvcid == "" {
+		return nil, invalidParams("subnqn and trsvcid are required for NVMe-oF")
+	}
+	switch args.Multipath {
+	case "", spdk.NvmeMultipathDisable, spdk.NvmeMultipathFailover, spdk.NvmeMultipathMultipath:
+	default:
+		return nil, invalidParams("multipath must be disable, failover or multipath")
+	}
+
+	c := s.findNvmeController(args.Name)
+	if c != nil {
+		if args.Multipath == "" || args.Multipath == spdk.NvmeMultipathDisable {
+			return nil, errnoError(spdk.ErrExist, "A controller named %s already exists and multipath is disabled", args.Name)
+		}
+		if c.subnqn != args.Subnqn {
+			return nil, errnoError(spdk.ErrInvalid, "controller %s is attached to %s", args.Name, c.subnqn)
+		}
+	}
+
+	hostnqn := args.Hostnqn
+	if hostnqn == "" {
+		hostnqn = s.hostnqn
+	}
+	addr := newFabricAddress(args.Trtype, args.Adrfam, args.Traddr, args.Trsvcid)
+	if c != nil {
+		for _, p := range c.paths {
+			if p.addr == addr {
+				return nil, errnoError(spdk.ErrExist, "controller %s already has a path to %s:%s", args.Name, args.Traddr, args.Trsvcid)
+			}
+		}
+	}
+	// Without num_io_queues the fake host connects one I/O qpair.
+	numIoQpairs := args.NumIoQueues
+	if numIoQpairs == 0 {
+		numIoQpairs = 1
+	}
+	sub, cntlid, err := fabricConnect(fabricConnection{
+		addr:        addr,
+		nqn:         args.Subnqn,
+		host:        s,
+		hostnqn:     hostnqn,
+		hostid:      s.hostid,
+		numIoQpairs: numIoQpairs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	path := &nvmePath{
+		addr: addr,
+		trid: spdk.NvmeTransportID{
+			Trtype:  addr.trtype,
+			Adrfam:  args.Adrfam,
+			Traddr:  args.Traddr,
+			Trsvcid: args.Trsvcid,
+			Subnqn:  args.Subnqn,
+		},
+		host: spdk.NvmeControllerHost{
+			Nqn:   hostnqn,
+			Addr:  args.Hostaddr,
+			Svcid: args.Hostsvcid,
+		},
+		cntlid:    cntlid,
+		subsystem: sub,
+	}
+	if path.trid.Adrfam == "" {
+		path.trid.Adrfam = "IPv4"
+	}
+
+	if c == nil {
+		c = &nvmeController{name: args.Name, subnqn: args.Subnqn}
+		for _, ns := range sub.namespaces {
+			nsid := ns.nsid
+			b := &bdev{
+				name:        fmt.Sprintf("%sn%d", c.name, nsid),
+				productName: nvmeProductName,
+				uuid:        ns.uuid,
+				blockSize:   ns.blockSize,
+				numBlocks:   ns.numBlocks,
+				driverSpecific: func() map[string]interface{} {
+					return c.driverSpecific(nsid)
+				},
+			}
+			if s.findBdev(b.uuid) != nil {
+				// The namespace is exported by this server.
+				b.uuid = ""
+			}
+			if err := s.addBdev(b); err != nil {
+				for _, ns := range c.namespaces {
+					s.removeBdev(ns.bdev)
+				}
+				fabricDisconnect(addr, args.Subnqn, cntlid)
+				return nil, err
+			}
+			c.namespaces = append(c.namespaces, &nvmeNamespace{
+				nsid:   nsid,
+				bdev:   b,
+				policy: spdk.NvmeMultipathPolicyActivePassive,
+			})
+		}
+		s.nvmeControllers = append(s.nvmeControllers, c)
+	}
+	c.paths = append(c.paths, path)
+
+	names := []string{}
+	for _, ns := range c.namespaces {
+		names = append(names, ns.bdev.name)
+	}
+	return names, nil
+}
+
+func (s *Server) bdevNvmeDetachController(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevNvmeDetachControllerArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c, err := s.lookupNvmeController(args.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without transport fields all paths get detached.
+	paths := []*nvmePath{}
+	detached := []*nvmePath{}
+	for _, p := range c.paths {
+		if (args.Trtype != "" && !strings.EqualFold(args.Trtype, p.trid.Trtype)) ||
+			(args.Adrfam != "" && !strings.EqualFold(args.Adrfam, p.trid.Adrfam)) ||
+			(args.Traddr != "" && args.Traddr != p.trid.Traddr) ||
+			(args.Trsvcid != "" && args.Trsvcid != p.trid.Trsvcid) ||
+			(args.Subnqn != "" && args.Subnqn != p.trid.Subnqn) ||
+			(args.Hostaddr != "" && args.Hostaddr != p.host.Addr) ||
+			(args.Hostsvcid != "" && args.Hostsvcid != p.host.Svcid) {
+			paths = append(paths, p)
+		} else {
+			detached = append(detached, p)
+		}
+	}
+	if len(detached) == 0 {
+		return nil, errnoError(spdk.ErrNoDevice, "no matching path of NVMe controller %s", c.name)
+	}
+	if len(paths) == 0 {
+		for _, ns := range c.namespaces {
+			if err := ns.bdev.inUse(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range detached {
+		fabricDisconnect(p.addr, p.trid.Subnqn, p.cntlid)
+	}
+	if len(paths) > 0 {
+		c.paths = paths
+		return true, nil
+	}
+
+	for _, ns := range c.namespaces {
+		s.removeBdev(ns.bdev)
+	}
+	for i := range s.nvmeControllers {
+		if s.nvmeControllers[i] == c {
+			s.nvmeControllers = append(s.nvmeControllers[:i], s.nvmeControllers[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) bdevNvmeGetControllers(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevNvmeGetControllersArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	result := []interface{}{}
+	if args.Name != "" {
+		c, err := s.lookupNvmeController(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, c.info()), nil
+	}
+	for _, c := range s.nvmeControllers {
+		result = append(result, c.info())
+	}
+	return result, nil
+}
+
+func (s *Server) bdevNvmeResetController(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevNvmeResetControllerArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c, err := s.lookupNvmeController(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range c.paths {
+		if p.state() == "enabled" {
+			return true, nil
+		}
+	}
+	return nil, errnoError(spdk.ErrIO, "reset of NVMe controller %s", c.name)
+}
+
+func (s *Server) bdevNvmeSetOptions(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		spdk.BdevNvmeSetOptionsArgs
+		RetryCount int `json:"retry_count"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if len(s.nvmeControllers) > 0 {
+		return nil, &spdk.JSONRPCError{
+			Code:    spdk.ErrInvalidState.Code,
+			Message: "RPC not permitted with nvme controllers already attached",
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) bdevNvmeSetHotplug(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevNvmeSetHotplugArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// findNvmeNamespace returns the namespace of the NVMe bdev name.
+func (s *Server) findNvmeNamespace(name string) (*nvmeController, *nvmeNamespace) {
+	for _, c := range s.nvmeControllers {
+		for _, ns := range c.namespaces {
+			if ns.bdev.name == name {
+				return c, ns
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ioPaths returns the paths of namespace ns. Like SPDK, it prefers
+// optimized over non-optimized paths. Active-passive uses the first
+// of them, active-active all of them.
+func (c *nvmeController) ioPaths(ns *nvmeNamespace) []spdk.NvmeIoPath {
+	ioPaths := []spdk.NvmeIoPath{}
+	states := []spdk.NvmfAnaState{}
+	for _, p := range c.paths {
+		state := p.anaState(ns.nsid)
+		ioPaths = append(ioPaths, spdk.NvmeIoPath{
+			BdevName:   ns.bdev.name,
+			Cntlid:     p.cntlid,
+			Connected:  state != "",
+			Accessible: state == spdk.NvmfAnaOptimized || state == spdk.NvmfAnaNonOptimized,
+			Transport:  p.trid,
+		})
+		states = append(states, state)
+	}
+	for _, preferred := range []spdk.NvmfAnaState{spdk.NvmfAnaOptimized, spdk.NvmfAnaNonOptimized} {
+		found := false
+		for i := range ioPaths {
+			if states[i] == preferred {
+				ioPaths[i].Current = true
+				found = true
+				if ns.policy == spdk.NvmeMultipathPolicyActivePassive {
+					break
+				}
+			}
+		}
+		if found {
+			break
+		}
+	}
+	return ioPaths
+}
+
+func (s *Server) bdevNvmeGetIoPaths(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevNvmeGetIoPathsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Name != "" {
+		if _, ns := s.findNvmeNamespace(args.Name); ns == nil {
+			return nil, errnoError(spdk.ErrNoDevice, "NVMe bdev %s not found", args.Name)
+		}
+	}
+	ioPaths := []spdk.NvmeIoPath{}
+	for _, c := range s.nvmeControllers {
+		for _, ns := range c.namespaces {
+			if args.Name == "" || args.Name == ns.bdev.name {
+				ioPaths = append(ioPaths, c.ioPaths(ns)...)
+			}
+		}
+	}
+	return spdk.BdevNvmeGetIoPathsResponse{
+		PollGroups: []spdk.NvmePollGroupIoPaths{{Thread: "app_thread", IoPaths: ioPaths}},
+	}, nil
+}
+
+func (s *Server) bdevNvmeSetMultipathPolicy(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevNvmeSetMultipathPolicyArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	switch args.Policy {
+	case spdk.NvmeMultipathPolicyActivePassive:
+		if args.Selector != "" || args.RrMinIo != 0 {
+			return nil, invalidParams("selector and rr_min_io only valid for active_active policy")
+		}
+	case spdk.NvmeMultipathPolicyActiveActive:
+		switch args.Selector {
+		case "", spdk.NvmeMultipathSelectorRoundRobin, spdk.NvmeMultipathSelectorQueueDepth:
+		default:
+			return nil, invalidParams("selector must be round_robin or queue_depth")
+		}
+	default:
+		return nil, invalidParams("policy must be active_passive or active_active")
+	}
+	_, ns := s.findNvmeNamespace(args.Name)
+	if ns == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "NVMe bdev %s not found", args.Name)
+	}
+	ns.policy = args.Policy
+	return true, nil
+}
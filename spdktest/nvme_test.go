@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNvmeTcp(t *testing.T) {
+	ctx := context.Background()
+	target, targetClient := connect(t)
+	_, client := connect(t)
+	const nqn = "nqn.2016-06.io.spdk:cnode1"
+	exportMalloc(t, targetClient, nqn, "4420", "4421")
+
+	retries := 4
+	_, err := spdk.BdevNvmeSetOptions(ctx, client, spdk.BdevNvmeSetOptionsArgs{TransportRetryCount: &retries})
+	assert.NoError(t, err, "Failed to set NVMe options: %s", err)
+	_, err = spdk.BdevNvmeSetHotplug(ctx, client, spdk.BdevNvmeSetHotplugArgs{Enable: true, PeriodUs: 100000})
+	assert.NoError(t, err, "Failed to enable NVMe hotplug: %s", err)
+
+	attachArgs := spdk.BdevNvmeAttachControllerArgs{
+		Name:    "Nvme0",
+		Trtype:  spdk.NvmeTransportTCP,
+		Adrfam:  "IPv4",
+		Traddr:  "127.0.0.1",
+		Trsvcid: "4420",
+		Subnqn:  nqn,
+		Hostnqn: "nqn.2014-08.org.nvmexpress:uuid:host0",
+		Hdgst:   true,
+		Ddgst:   true,
+	}
+	bdevNames, err := spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.NoError(t, err, "Failed to attach NVMe controller: %s", err)
+	assert.Equal(t, []string{"Nvme0n1"}, bdevNames)
+
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: "Nvme0n1"})
+	assert.NoError(t, err, "Failed to get NVMe bdev: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, int64(1024), bdevs[0].NumBlocks)
+		assert.Equal(t, int64(4096), bdevs[0].BlockSize)
+		paths, ok := bdevs[0].Nvme()
+		if assert.True(t, ok) && assert.Len(t, paths, 1) {
+			assert.Equal(t, "4420", paths[0].Trid.Trsvcid)
+			assert.Equal(t, "SPDK00000000000001", paths[0].CtrlrData.SerialNumber)
+			assert.Equal(t, 1, paths[0].NsData.ID)
+		}
+	}
+
+	// Options are only accepted before the first controller.
+	_, err = spdk.BdevNvmeSetOptions(ctx, client, spdk.BdevNvmeSetOptionsArgs{BdevRetryCount: &retries})
+	assert.ErrorIs(t, err, spdk.ErrInvalidState)
+
+	// A second path needs multipath.
+	attachArgs.Trsvcid = "4421"
+	_, err = spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.ErrorIs(t, err, spdk.ErrExist)
+	attachArgs.Multipath = spdk.NvmeMultipathMultipath
+	bdevNames, err = spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.NoError(t, err, "Failed to attach second path: %s", err)
+	assert.Equal(t, []string{"Nvme0n1"}, bdevNames)
+
+	controllers, err := spdk.BdevNvmeGetControllers(ctx, client, spdk.BdevNvmeGetControllersArgs{Name: "Nvme0"})
+	assert.NoError(t, err, "Failed to get NVMe controllers: %s", err)
+	if assert.Len(t, controllers, 1) && assert.Len(t, controllers[0].Ctrlrs, 2) {
+		paths := controllers[0].Ctrlrs
+		assert.Equal(t, "enabled", paths[0].State)
+		assert.Equal(t, "4421", paths[1].Trid.Trsvcid)
+		assert.Equal(t, "nqn.2014-08.org.nvmexpress:uuid:host0", paths[1].Host.Nqn)
+		assert.NotEqual(t, paths[0].Cntlid, paths[1].Cntlid)
+	}
+
+	_, err = spdk.BdevNvmeDetachController(ctx, client, spdk.BdevNvmeDetachControllerArgs{Name: "Nvme0", Trsvcid: "4421"})
+	assert.NoError(t, err, "Failed to detach path: %s", err)
+	_, err = spdk.BdevNvmeResetController(ctx, client, spdk.BdevNvmeResetControllerArgs{Name: "Nvme0"})
+	assert.NoError(t, err, "Failed to reset controller: %s", err)
+
+	// The exported bdev is in use by the subsystem.
+	_, err = spdk.BdevMallocDelete(ctx, targetClient, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+
+	// Paths fail when the target goes away.
+	target.Close()
+	controllers, err = spdk.BdevNvmeGetControllers(ctx, client, spdk.BdevNvmeGetControllersArgs{})
+	assert.NoError(t, err, "Failed to get NVMe controllers: %s", err)
+	if assert.Len(t, controllers, 1) && assert.Len(t, controllers[0].Ctrlrs, 1) {
+		assert.Equal(t, "failed", controllers[0].Ctrlrs[0].State)
+	}
+	_, err = spdk.BdevNvmeResetController(ctx, client, spdk.BdevNvmeResetControllerArgs{Name: "Nvme0"})
+	assert.ErrorIs(t, err, spdk.ErrIO)
+
+	_, err = spdk.BdevNvmeDetachController(ctx, client, spdk.BdevNvmeDetachControllerArgs{Name: "Nvme0"})
+	assert.NoError(t, err, "Failed to detach controller: %s", err)
+	bdevs, err = spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	assert.Empty(t, bdevs)
+
+	_, err = spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.ErrorIs(t, err, spdk.ErrIO)
+	_, err = spdk.BdevNvmeAttachController(ctx, client, spdk.BdevNvmeAttachControllerArgs{
+		Name: "Nvme1", Trtype: spdk.NvmeTransportPCIe, Traddr: "0000:00:04.0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+	_, err = spdk.BdevNvmeGetControllers(ctx, client, spdk.BdevNvmeGetControllersArgs{Name: "Nvme0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+}
+
+func TestNvmeTcpLoopback(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+	const nqn = "nqn.2016-06.io.spdk:loop"
+	exportMalloc(t, client, nqn, "4430")
+
+	bdevNames, err := spdk.BdevNvmeAttachController(ctx, client, spdk.BdevNvmeAttachControllerArgs{
+		Name: "Nvme0", Trtype: "tcp", Traddr: "127.0.0.1", Trsvcid: "4430", Subnqn: nqn})
+	assert.NoError(t, err, "Failed to attach own subsystem: %s", err)
+	assert.Equal(t, []string{"Nvme0n1"}, bdevNames)
+
+	controllers, err := spdk.BdevNvmeGetControllers(ctx, client, spdk.BdevNvmeGetControllersArgs{})
+	assert.NoError(t, err, "Failed to get NVMe controllers: %s", err)
+	if assert.Len(t, controllers, 1) && assert.Len(t, controllers[0].Ctrlrs, 1) {
+		assert.Contains(t, controllers[0].Ctrlrs[0].Host.Nqn, "nqn.2014-08.org.nvmexpress:uuid:")
+	}
+}
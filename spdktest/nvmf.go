@@ -0,0 +1,673 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+type nvmfSubsystem struct {
+	nqn           string
+	serialNumber  string
+	modelNumber   string
+	allowAnyHost  bool
+	hosts         []string
+	maxNamespaces int
+	anaReporting  bool
+	namespaces    []*nvmfNamespace
+	listeners     []*nvmfListener
+}
+
+type nvmfNamespace struct {
+	nsid     int
+	anagrpid int
+	uuid     string
+	bdev     *bdev
+}
+
+type nvmfListener struct {
+	addr fabricAddress
+	// anaStates has the ANA groups which are not optimized.
+	anaStates map[int]spdk.NvmfAnaState
+}
+
+// maxNsid is the highest namespace id and ANA group id.
+func (sub *nvmfSubsystem) maxNsid() int {
+	if sub.maxNamespaces > 0 {
+		return sub.maxNamespaces
+	}
+	return 32
+}
+
+func (sub *nvmfSubsystem) user() string {
+	return "nvmf subsystem " + sub.nqn
+}
+
+// export returns the state seen by hosts.
+func (sub *nvmfSubsystem) export() *fabricSubsystem {
+	exported := &fabricSubsystem{
+		nqn:          sub.nqn,
+		serialNumber: sub.serialNumber,
+		modelNumber:  sub.modelNumber,
+		allowAnyHost: sub.allowAnyHost,
+		hosts:        make(map[string]bool),
+		anaReporting: sub.anaReporting,
+		anaStates:    make(map[fabricAddress]map[int]spdk.NvmfAnaState),
+	}
+	for _, host := range sub.hosts {
+		exported.hosts[host] = true
+	}
+	for _, l := range sub.listeners {
+		states := make(map[int]spdk.NvmfAnaState)
+		for anagrpid, state := range l.anaStates {
+			states[anagrpid] = state
+		}
+		exported.anaStates[l.addr] = states
+	}
+	for _, ns := range sub.namespaces {
+		exported.namespaces = append(exported.namespaces, fabricNamespace{
+			nsid:      ns.nsid,
+			anagrpid:  ns.anagrpid,
+			uuid:      ns.uuid,
+			blockSize: ns.bdev.blockSize,
+			numBlocks: ns.bdev.numBlocks,
+		})
+	}
+	return exported
+}
+
+func (s *Server) publishSubsystem(sub *nvmfSubsystem) {
+	fabricPublish(s, sub.nqn, sub.export())
+}
+
+func (s *Server) findSubsystem(nqn string) *nvmfSubsystem {
+	for _, sub := range s.subsystems {
+		if sub.nqn == nqn {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupSubsystem(nqn string) (*nvmfSubsystem, error) {
+	sub := s.findSubsystem(nqn)
+	if sub == nil {
+		return nil, invalidParams("Unable to find subsystem with NQN " + nqn)
+	}
+	return sub, nil
+}
+
+func (s *Server) hasTransport(trtype string) bool {
+	for _, t := range s.nvmfTransports {
+		if t.Trtype == strings.ToUpper(trtype) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) registerNvmfMethods() {
+	s.methods["nvmf_create_transport"] = s.nvmfCreateTransport
+	s.methods["nvmf_get_transports"] = s.nvmfGetTransports
+	s.methods["nvmf_create_subsystem"] = s.nvmfCreateSubsystem
+	s.methods["nvmf_delete_subsystem"] = s.nvmfDeleteSubsystem
+	s.methods["nvmf_get_subsystems"] = s.nvmfGetSubsystems
+	s.methods["nvmf_subsystem_add_ns"] = s.nvmfSubsystemAddNs
+	s.methods["nvmf_subsystem_remove_ns"] = s.nvmfSubsystemRemoveNs
+	s.methods["nvmf_subsystem_add_listener"] = s.nvmfSubsystemAddListener
+	s.methods["nvmf_subsystem_remove_listener"] = s.nvmfSubsystemRemoveListener
+	s.methods["nvmf_subsystem_add_host"] = s.nvmfSubsystemAddHost
+	s.methods["nvmf_subsystem_remove_host"] = s.nvmfSubsystemRemoveHost
+	s.methods["nvmf_subsystem_allow_any_host"] = s.nvmfSubsystemAllowAnyHost
+	s.methods["nvmf_subsystem_listener_set_ana_state"] = s.nvmfSubsystemListenerSetAnaState
+	s.methods["nvmf_subsystem_get_listeners"] = s.nvmfSubsystemGetListeners
+	s.methods["nvmf_subsystem_get_controllers"] = s.nvmfSubsystemGetControllers
+	s.methods["nvmf_subsystem_get_qpairs"] = s.nvmfSubsystemGetQpairs
+}
+
+// withDefault returns value, or def if value is not set.
+func withDefault(value, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
+
+func (s *Server) nvmfCreateTransport(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Trtype                 string `json:"trtype"`
+		TgtName                string `json:"tgt_name"`
+		MaxQueueDepth          int    `json:"max_queue_depth"`
+		MaxIoQpairsPerCtrlr    int    `json:"max_io_qpairs_per_ctrlr"`
+		InCapsuleDataSize      int    `json:"in_capsule_data_size"`
+		MaxIoSize              int    `json:"max_io_size"`
+		IoUnitSize             int    `json:"io_unit_size"`
+		MaxAqDepth             int    `json:"max_aq_depth"`
+		NumSharedBuffers       int    `json:"num_shared_buffers"`
+		BufCacheSize           int    `json:"buf_cache_size"`
+		DifInsertOrStrip       bool   `json:"dif_insert_or_strip"`
+		C2hSuccess             *bool  `json:"c2h_success"`
+		SockPriority           int    `json:"sock_priority"`
+		AbortTimeoutSec        int    `json:"abort_timeout_sec"`
+		NoSrq                  bool   `json:"no_srq"`
+		Zcopy                  bool   `json:"zcopy"`
+		AcceptorPollRate       int    `json:"acceptor_poll_rate"`
+		ControlMsgNum          int    `json:"control_msg_num"`
+		MaxSrqDepth            int    `json:"max_srq_depth"`
+		NumCqe                 int    `json:"num_cqe"`
+		AcceptorBacklog        int    `json:"acceptor_backlog"`
+		NoWrBatching           bool   `json:"no_wr_batching"`
+		DisableMappableBar0    bool   `json:"disable_mappable_bar0"`
+		DisableAdaptiveIrq     bool   `json:"disable_adaptive_irq"`
+		DisableShadowDoorbells bool   `json:"disable_shadow_doorbells"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	trtype := strings.ToUpper(args.Trtype)
+	if trtype != spdk.NvmeTransportTCP && trtype != spdk.NvmeTransportRDMA {
+		return nil, invalidParams("Transport type '" + args.Trtype + "' unavailable")
+	}
+	if s.hasTransport(trtype) {
+		return nil, invalidParams("Transport type '" + args.Trtype + "' already exists")
+	}
+	s.nvmfTransports = append(s.nvmfTransports, spdk.NvmfTransport{
+		Trtype:              trtype,
+		MaxQueueDepth:       withDefault(args.MaxQueueDepth, 128),
+		MaxIoQpairsPerCtrlr: withDefault(args.MaxIoQpairsPerCtrlr, 127),
+		InCapsuleDataSize:   withDefault(args.InCapsuleDataSize, 4096),
+		MaxIoSize:           withDefault(args.MaxIoSize, 131072),
+		IoUnitSize:          withDefault(args.IoUnitSize, 131072),
+		MaxAqDepth:          withDefault(args.MaxAqDepth, 128),
+		NumSharedBuffers:    withDefault(args.NumSharedBuffers, 511),
+		BufCacheSize:        withDefault(args.BufCacheSize, 32),
+		DifInsertOrStrip:    args.DifInsertOrStrip,
+		C2hSuccess:          trtype == spdk.NvmeTransportTCP && (args.C2hSuccess == nil || *args.C2hSuccess),
+		SockPriority:        args.SockPriority,
+		AbortTimeoutSec:     withDefault(args.AbortTimeoutSec, 1),
+		Zcopy:               args.Zcopy,
+	})
+	return true, nil
+}
+
+func (s *Server) nvmfGetTransports(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfGetTransportsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	result := []spdk.NvmfTransport{}
+	for _, t := range s.nvmfTransports {
+		if args.Trtype == "" || t.Trtype == strings.ToUpper(args.Trtype) {
+			result = append(result, t)
+		}
+	}
+	if args.Trtype != "" && len(result) == 0 {
+		return nil, invalidParams("Invalid transport type '" + args.Trtype + "'")
+	}
+	return result, nil
+}
+
+func (s *Server) nvmfCreateSubsystem(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Nqn           string `json:"nqn"`
+		SerialNumber  string `json:"serial_number"`
+		ModelNumber   string `json:"model_number"`
+		TgtName       string `json:"tgt_name"`
+		AllowAnyHost  bool   `json:"allow_any_host"`
+		MaxNamespaces int    `json:"max_namespaces"`
+		AnaReporting  bool   `json:"ana_reporting"`
+		MinCntlid     int    `json:"min_cntlid"`
+		MaxCntlid     int    `json:"max_cntlid"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(args.Nqn, "nqn.") || s.findSubsystem(args.Nqn) != nil {
+		return nil, &spdk.JSONRPCError{Code: spdk.ERROR_INTERNAL_ERROR, Message: "Unable to create subsystem " + args.Nqn}
+	}
+
+	sub := &nvmfSubsystem{
+		nqn:           args.Nqn,
+		serialNumber:  args.SerialNumber,
+		modelNumber:   args.ModelNumber,
+		allowAnyHost:  args.AllowAnyHost,
+		maxNamespaces: args.MaxNamespaces,
+		anaReporting:  args.AnaReporting,
+	}
+	if sub.serialNumber == "" {
+		sub.serialNumber = "00000000000000000000"
+	}
+	if sub.modelNumber == "" {
+		sub.modelNumber = "SPDK bdev Controller"
+	}
+	s.subsystems = append(s.subsystems, sub)
+	return true, nil
+}
+
+func (s *Server) nvmfSubsystemAddNs(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Nqn       string `json:"nqn"`
+		TgtName   string `json:"tgt_name"`
+		Namespace struct {
+			BdevName      string `json:"bdev_name"`
+			Nsid          int    `json:"nsid"`
+			Nguid         string `json:"nguid"`
+			Eui64         string `json:"eui64"`
+			UUID          string `json:"uuid"`
+			Anagrpid      int    `json:"anagrpid"`
+			PtplFile      string `json:"ptpl_file"`
+			NoAutoVisible bool   `json:"no_auto_visible"`
+		} `json:"namespace"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	b := s.findBdev(args.Namespace.BdevName)
+	if b == nil || b.claimedBy != "" {
+		return nil, invalidParams("Unable to add namespace")
+	}
+
+	nsid := args.Namespace.Nsid
+	if nsid == 0 {
+		nsid = 1
+		for sub.findNamespace(nsid) != nil {
+			nsid++
+		}
+	}
+	if sub.findNamespace(nsid) != nil ||
+		(sub.maxNamespaces > 0 && (nsid > sub.maxNamespaces || len(sub.namespaces) >= sub.maxNamespaces)) {
+		return nil, invalidParams("Unable to add namespace")
+	}
+
+	ns := &nvmfNamespace{nsid: nsid, anagrpid: args.Namespace.Anagrpid, uuid: args.Namespace.UUID, bdev: b}
+	if ns.anagrpid == 0 {
+		ns.anagrpid = nsid
+	}
+	if ns.anagrpid > sub.maxNsid() {
+		return nil, invalidParams("Unable to add namespace")
+	}
+	if ns.uuid == "" {
+		ns.uuid = b.uuid
+	}
+	b.open(sub.user())
+	sub.namespaces = append(sub.namespaces, ns)
+	s.publishSubsystem(sub)
+	return nsid, nil
+}
+
+func (sub *nvmfSubsystem) findListener(addr fabricAddress) *nvmfListener {
+	for _, l := range sub.listeners {
+		if l.addr == addr {
+			return l
+		}
+	}
+	return nil
+}
+
+func (sub *nvmfSubsystem) findNamespace(nsid int) *nvmfNamespace {
+	for _, ns := range sub.namespaces {
+		if ns.nsid == nsid {
+			return ns
+		}
+	}
+	return nil
+}
+
+type nvmfListenAddress struct {
+	Trtype  string `json:"trtype"`
+	Adrfam  string `json:"adrfam,omitempty"`
+	Traddr  string `json:"traddr"`
+	Trsvcid string `json:"trsvcid,omitempty"`
+}
+
+func (a nvmfListenAddress) fabricAddress() fabricAddress {
+	return newFabricAddress(a.Trtype, a.Adrfam, a.Traddr, a.Trsvcid)
+}
+
+// listenAddress returns addr as reported by nvmf_get_subsystems.
+func (addr fabricAddress) listenAddress() spdk.NvmfListenAddress {
+	adrfam := strings.ToUpper(addr.adrfam)
+	if strings.HasPrefix(adrfam, "IPV") {
+		adrfam = "IPv" + adrfam[3:]
+	}
+	return spdk.NvmfListenAddress{
+		Trtype:  addr.trtype,
+		Adrfam:  adrfam,
+		Traddr:  addr.traddr,
+		Trsvcid: addr.trsvcid,
+	}
+}
+
+func (s *Server) nvmfSubsystemAddListener(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Nqn           string            `json:"nqn"`
+		TgtName       string            `json:"tgt_name"`
+		ListenAddress nvmfListenAddress `json:"listen_address"`
+		SecureChannel bool              `json:"secure_channel"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	if !s.hasTransport(args.ListenAddress.Trtype) {
+		return nil, invalidParams("Unable to find transport " + args.ListenAddress.Trtype)
+	}
+	if args.ListenAddress.Traddr == "" || args.ListenAddress.Trsvcid == "" {
+		return nil, invalidParams("traddr and trsvcid are required")
+	}
+
+	addr := args.ListenAddress.fabricAddress()
+	if sub.findListener(addr) != nil {
+		return nil, invalidParams("Listener already exists")
+	}
+	sub.listeners = append(sub.listeners, &nvmfListener{addr: addr})
+	if err := fabricListen(s, addr, sub.export()); err != nil {
+		sub.listeners = sub.listeners[:len(sub.listeners)-1]
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) nvmfSubsystemRemoveListener(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Nqn           string            `json:"nqn"`
+		TgtName       string            `json:"tgt_name"`
+		ListenAddress nvmfListenAddress `json:"listen_address"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	addr := args.ListenAddress.fabricAddress()
+	for i, listener := range sub.listeners {
+		if listener.addr == addr {
+			fabricUnlisten(s, addr, sub.nqn)
+			sub.listeners = append(sub.listeners[:i], sub.listeners[i+1:]...)
+			return true, nil
+		}
+	}
+	return nil, invalidParams("Unable to find listener")
+}
+
+func (s *Server) nvmfSubsystemRemoveNs(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfSubsystemRemoveNsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	for i, ns := range sub.namespaces {
+		if ns.nsid == args.Nsid {
+			ns.bdev.close(sub.user())
+			sub.namespaces = append(sub.namespaces[:i], sub.namespaces[i+1:]...)
+			s.publishSubsystem(sub)
+			return true, nil
+		}
+	}
+	return nil, invalidParams(fmt.Sprintf("Unable to find namespace %d", args.Nsid))
+}
+
+func (s *Server) nvmfSubsystemAddHost(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		spdk.NvmfSubsystemHostArgs
+		Psk string `json:"psk"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range sub.hosts {
+		if host == args.Host {
+			return nil, &spdk.JSONRPCError{Code: spdk.ERROR_INTERNAL_ERROR, Message: "Internal error"}
+		}
+	}
+	sub.hosts = append(sub.hosts, args.Host)
+	s.publishSubsystem(sub)
+	return true, nil
+}
+
+func (s *Server) nvmfSubsystemRemoveHost(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfSubsystemHostArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	// Like SPDK, removing an unknown host succeeds.
+	for i, host := range sub.hosts {
+		if host == args.Host {
+			sub.hosts = append(sub.hosts[:i], sub.hosts[i+1:]...)
+			s.publishSubsystem(sub)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) nvmfSubsystemAllowAnyHost(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfSubsystemAllowAnyHostArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	sub.allowAnyHost = args.AllowAnyHost
+	s.publishSubsystem(sub)
+	return true, nil
+}
+
+func (s *Server) nvmfDeleteSubsystem(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfDeleteSubsystemArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	for i, sub := range s.subsystems {
+		if sub.nqn != args.Nqn {
+			continue
+		}
+		for _, ns := range sub.namespaces {
+			ns.bdev.close(sub.user())
+		}
+		fabricPublish(s, sub.nqn, nil)
+		s.subsystems = append(s.subsystems[:i], s.subsystems[i+1:]...)
+		return true, nil
+	}
+	return nil, invalidParams("Unable to find subsystem with NQN " + args.Nqn)
+}
+
+func (sub *nvmfSubsystem) info() spdk.NvmfSubsystem {
+	info := spdk.NvmfSubsystem{
+		Nqn:             sub.nqn,
+		Subtype:         spdk.NvmfSubtypeNVMe,
+		ListenAddresses: []spdk.NvmfListenAddress{},
+		AllowAnyHost:    sub.allowAnyHost,
+		Hosts:           []spdk.NvmfHost{},
+		SerialNumber:    sub.serialNumber,
+		ModelNumber:     sub.modelNumber,
+		MaxNamespaces:   sub.maxNamespaces,
+		MinCntlid:       1,
+		MaxCntlid:       65519,
+		Namespaces:      []spdk.NvmfNamespace{},
+	}
+	for _, l := range sub.listeners {
+		info.ListenAddresses = append(info.ListenAddresses, l.addr.listenAddress())
+	}
+	for _, host := range sub.hosts {
+		info.Hosts = append(info.Hosts, spdk.NvmfHost{Nqn: host})
+	}
+	for _, ns := range sub.namespaces {
+		info.Namespaces = append(info.Namespaces, spdk.NvmfNamespace{
+			Nsid:     ns.nsid,
+			BdevName: ns.bdev.name,
+			Name:     ns.bdev.name,
+			UUID:     ns.uuid,
+			Anagrpid: ns.anagrpid,
+		})
+	}
+	return info
+}
+
+func (s *Server) nvmfGetSubsystems(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfGetSubsystemsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	result := []spdk.NvmfSubsystem{{
+		Nqn:             spdk.NvmfDiscoveryNqn,
+		Subtype:         spdk.NvmfSubtypeDiscovery,
+		ListenAddresses: []spdk.NvmfListenAddress{},
+		AllowAnyHost:    true,
+		Hosts:           []spdk.NvmfHost{},
+	}}
+	for _, sub := range s.subsystems {
+		result = append(result, sub.info())
+	}
+	return result, nil
+}
+
+func (s *Server) nvmfSubsystemListenerSetAnaState(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Nqn           string            `json:"nqn"`
+		TgtName       string            `json:"tgt_name"`
+		ListenAddress nvmfListenAddress `json:"listen_address"`
+		AnaState      spdk.NvmfAnaState `json:"ana_state"`
+		Anagrpid      int               `json:"anagrpid"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	switch args.AnaState {
+	case spdk.NvmfAnaOptimized, spdk.NvmfAnaNonOptimized, spdk.NvmfAnaInaccessible:
+	default:
+		return nil, invalidParams("Invalid ANA state " + string(args.AnaState))
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	if !sub.anaReporting || args.Anagrpid > sub.maxNsid() {
+		return nil, &spdk.JSONRPCError{Code: spdk.ERROR_INTERNAL_ERROR, Message: "Internal error"}
+	}
+	l := sub.findListener(args.ListenAddress.fabricAddress())
+	if l == nil {
+		return nil, &spdk.JSONRPCError{Code: spdk.ERROR_INTERNAL_ERROR, Message: "Internal error"}
+	}
+
+	if l.anaStates == nil {
+		l.anaStates = make(map[int]spdk.NvmfAnaState)
+	}
+	for anagrpid := 1; anagrpid <= sub.maxNsid(); anagrpid++ {
+		if args.Anagrpid != 0 && anagrpid != args.Anagrpid {
+			continue
+		}
+		if args.AnaState == spdk.NvmfAnaOptimized {
+			delete(l.anaStates, anagrpid)
+		} else {
+			l.anaStates[anagrpid] = args.AnaState
+		}
+	}
+	s.publishSubsystem(sub)
+	return true, nil
+}
+
+func (s *Server) nvmfSubsystemGetListeners(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfSubsystemGetListenersArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	result := []spdk.NvmfListener{}
+	for _, l := range sub.listeners {
+		listener := spdk.NvmfListener{Address: l.addr.listenAddress()}
+		if sub.anaReporting {
+			for anagrpid := 1; anagrpid <= sub.maxNsid(); anagrpid++ {
+				state := l.anaStates[anagrpid]
+				if state == "" {
+					state = spdk.NvmfAnaOptimized
+				}
+				listener.AnaStates = append(listener.AnaStates, spdk.NvmfListenerAnaGroupState{
+					AnaGroup: anagrpid,
+					AnaState: state,
+				})
+			}
+		}
+		result = append(result, listener)
+	}
+	return result, nil
+}
+
+func (s *Server) nvmfSubsystemGetControllers(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfSubsystemGetControllersArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	result := []spdk.NvmfController{}
+	for _, conn := range fabricConnections(s, sub.nqn) {
+		result = append(result, spdk.NvmfController{
+			Cntlid:      conn.cntlid,
+			Hostnqn:     conn.hostnqn,
+			Hostid:      conn.hostid,
+			NumIoQpairs: conn.numIoQpairs,
+		})
+	}
+	return result, nil
+}
+
+func (s *Server) nvmfSubsystemGetQpairs(params json.RawMessage) (interface{}, error) {
+	var args spdk.NvmfSubsystemGetQpairsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	sub, err := s.lookupSubsystem(args.Nqn)
+	if err != nil {
+		return nil, err
+	}
+	result := []spdk.NvmfQpair{}
+	for _, conn := range fabricConnections(s, sub.nqn) {
+		for qid := 0; qid <= conn.numIoQpairs; qid++ {
+			result = append(result, spdk.NvmfQpair{
+				Cntlid:        conn.cntlid,
+				Qid:           qid,
+				State:         "active",
+				Thread:        "nvmf_tgt_poll_group_000",
+				Hostnqn:       conn.hostnqn,
+				ListenAddress: conn.addr.listenAddress(),
+			})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportMalloc exports a new malloc bdev as namespace of a NVMe-oF
+// subsystem listening on TCP at 127.0.0.1:port.
+func exportMalloc(t *testing.T, client *spdk.Client, nqn string, ports ...string) {
+	ctx := context.Background()
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{Name: "Malloc0", NumBlocks: 1024, BlockSize: 4096})
+	_, err := spdk.NvmfCreateTransport(ctx, client, spdk.NvmfCreateTransportArgs{Trtype: spdk.NvmeTransportTCP})
+	if err != nil {
+		t.Fatalf("Failed to create TCP transport: %s", err)
+	}
+	_, err = spdk.NvmfCreateSubsystem(ctx, client, spdk.NvmfCreateSubsystemArgs{Nqn: nqn, AllowAnyHost: true, SerialNumber: "SPDK00000000000001"})
+	if err != nil {
+		t.Fatalf("Failed to create subsystem: %s", err)
+	}
+	_, err = spdk.NvmfSubsystemAddNs(ctx, client, spdk.NvmfSubsystemAddNsArgs{Nqn: nqn, Namespace: spdk.NvmfNamespaceParams{BdevName: "Malloc0"}})
+	if err != nil {
+		t.Fatalf("Failed to add namespace: %s", err)
+	}
+	for _, port := range ports {
+		_, err = spdk.NvmfSubsystemAddListener(ctx, client, spdk.NvmfSubsystemListenerArgs{
+			Nqn:           nqn,
+			ListenAddress: tcpListenAddress(port),
+		})
+		if err != nil {
+			t.Fatalf("Failed to add listener: %s", err)
+		}
+	}
+}
+
+func tcpListenAddress(port string) spdk.NvmfListenAddress {
+	return spdk.NvmfListenAddress{
+		Trtype:  spdk.NvmeTransportTCP,
+		Adrfam:  "IPv4",
+		Traddr:  "127.0.0.1",
+		Trsvcid: port,
+	}
+}
+
+func TestNvmf(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+	const nqn = "nqn.2016-06.io.spdk:cnode2"
+	exportMalloc(t, client, nqn, "4440")
+
+	transports, err := spdk.NvmfGetTransports(ctx, client, spdk.NvmfGetTransportsArgs{})
+	assert.NoError(t, err, "Failed to get transports: %s", err)
+	if assert.Len(t, transports, 1) {
+		assert.Equal(t, spdk.NvmeTransportTCP, transports[0].Trtype)
+		assert.Equal(t, 128, transports[0].MaxQueueDepth)
+		assert.True(t, transports[0].C2hSuccess)
+	}
+	_, err = spdk.NvmfCreateTransport(ctx, client, spdk.NvmfCreateTransportArgs{Trtype: spdk.NvmeTransportTCP})
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{Name: "Malloc1", NumBlocks: 256, BlockSize: 512})
+	nsid, err := spdk.NvmfSubsystemAddNs(ctx, client, spdk.NvmfSubsystemAddNsArgs{
+		Nqn:       nqn,
+		Namespace: spdk.NvmfNamespaceParams{BdevName: "Malloc1", Nsid: 5},
+	})
+	assert.NoError(t, err, "Failed to add namespace: %s", err)
+	assert.Equal(t, 5, nsid)
+	_, err = spdk.NvmfSubsystemAddNs(ctx, client, spdk.NvmfSubsystemAddNsArgs{
+		Nqn:       "nqn.2016-06.io.spdk:none",
+		Namespace: spdk.NvmfNamespaceParams{BdevName: "Malloc1"},
+	})
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	_, err = spdk.NvmfSubsystemAllowAnyHost(ctx, client, spdk.NvmfSubsystemAllowAnyHostArgs{Nqn: nqn})
+	assert.NoError(t, err, "Failed to disallow any host: %s", err)
+	_, err = spdk.NvmfSubsystemAddHost(ctx, client, spdk.NvmfSubsystemHostArgs{Nqn: nqn, Host: "nqn.2014-08.org.nvmexpress:uuid:host1"})
+	assert.NoError(t, err, "Failed to add host: %s", err)
+	_, err = spdk.NvmfSubsystemAddListener(ctx, client, spdk.NvmfSubsystemListenerArgs{Nqn: nqn, ListenAddress: tcpListenAddress("4441")})
+	assert.NoError(t, err, "Failed to add listener: %s", err)
+
+	subsystems, err := spdk.NvmfGetSubsystems(ctx, client, spdk.NvmfGetSubsystemsArgs{})
+	assert.NoError(t, err, "Failed to get subsystems: %s", err)
+	if assert.Len(t, subsystems, 2) {
+		assert.Equal(t, spdk.NvmfDiscoveryNqn, subsystems[0].Nqn)
+		assert.Equal(t, spdk.NvmfSubtypeDiscovery, subsystems[0].Subtype)
+		sub := subsystems[1]
+		assert.Equal(t, nqn, sub.Nqn)
+		assert.Equal(t, spdk.NvmfSubtypeNVMe, sub.Subtype)
+		assert.False(t, sub.AllowAnyHost)
+		assert.Equal(t, []spdk.NvmfHost{{Nqn: "nqn.2014-08.org.nvmexpress:uuid:host1"}}, sub.Hosts)
+		assert.Equal(t, []spdk.NvmfListenAddress{tcpListenAddress("4440"), tcpListenAddress("4441")}, sub.ListenAddresses)
+		assert.Equal(t, "SPDK00000000000001", sub.SerialNumber)
+		if assert.Len(t, sub.Namespaces, 2) {
+			assert.Equal(t, 1, sub.Namespaces[0].Nsid)
+			assert.Equal(t, "Malloc0", sub.Namespaces[0].BdevName)
+			assert.Equal(t, 5, sub.Namespaces[1].Nsid)
+			assert.Equal(t, "Malloc1", sub.Namespaces[1].Name)
+			assert.NotEmpty(t, sub.Namespaces[1].UUID)
+		}
+	}
+
+	// Only the added host may connect.
+	attachArgs := spdk.BdevNvmeAttachControllerArgs{
+		Name:    "Nvme0",
+		Trtype:  spdk.NvmeTransportTCP,
+		Traddr:  "127.0.0.1",
+		Trsvcid: "4441",
+		Subnqn:  nqn,
+	}
+	_, err = spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.ErrorIs(t, err, spdk.ErrIO)
+	attachArgs.Hostnqn = "nqn.2014-08.org.nvmexpress:uuid:host1"
+	bdevNames, err := spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.NoError(t, err, "Failed to attach NVMe controller: %s", err)
+	assert.Equal(t, []string{"Nvme0n1", "Nvme0n5"}, bdevNames)
+	_, err = spdk.BdevNvmeDetachController(ctx, client, spdk.BdevNvmeDetachControllerArgs{Name: "Nvme0"})
+	assert.NoError(t, err, "Failed to detach NVMe controller: %s", err)
+
+	// A namespace keeps its bdev open.
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc1"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	_, err = spdk.NvmfSubsystemRemoveNs(ctx, client, spdk.NvmfSubsystemRemoveNsArgs{Nqn: nqn, Nsid: 5})
+	assert.NoError(t, err, "Failed to remove namespace: %s", err)
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc1"})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+
+	_, err = spdk.NvmfSubsystemRemoveHost(ctx, client, spdk.NvmfSubsystemHostArgs{Nqn: nqn, Host: "nqn.2014-08.org.nvmexpress:uuid:host1"})
+	assert.NoError(t, err, "Failed to remove host: %s", err)
+	_, err = spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+	assert.ErrorIs(t, err, spdk.ErrIO)
+
+	_, err = spdk.NvmfSubsystemRemoveListener(ctx, client, spdk.NvmfSubsystemListenerArgs{Nqn: nqn, ListenAddress: tcpListenAddress("4441")})
+	assert.NoError(t, err, "Failed to remove listener: %s", err)
+	_, err = spdk.NvmfSubsystemRemoveListener(ctx, client, spdk.NvmfSubsystemListenerArgs{Nqn: nqn, ListenAddress: tcpListenAddress("4441")})
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	_, err = spdk.NvmfDeleteSubsystem(ctx, client, spdk.NvmfDeleteSubsystemArgs{Nqn: nqn})
+	assert.NoError(t, err, "Failed to delete subsystem: %s", err)
+	subsystems, err = spdk.NvmfGetSubsystems(ctx, client, spdk.NvmfGetSubsystemsArgs{})
+	assert.NoError(t, err, "Failed to get subsystems: %s", err)
+	assert.Len(t, subsystems, 1)
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+}
+
+func TestNvmfAna(t *testing.T) {
+	ctx := context.Background()
+	_, targetClient := connect(t)
+	_, client := connect(t)
+	const nqn = "nqn.2016-06.io.spdk:ana"
+
+	createMalloc(t, targetClient, spdk.BdevMallocCreateArgs{Name: "Malloc0", NumBlocks: 1024, BlockSize: 512})
+	_, err := spdk.NvmfCreateTransport(ctx, targetClient, spdk.NvmfCreateTransportArgs{Trtype: spdk.NvmeTransportTCP})
+	if err != nil {
+		t.Fatalf("Failed to create TCP transport: %s", err)
+	}
+	_, err = spdk.NvmfCreateSubsystem(ctx, targetClient, spdk.NvmfCreateSubsystemArgs{Nqn: nqn, AllowAnyHost: true, AnaReporting: true, MaxNamespaces: 2})
+	if err != nil {
+		t.Fatalf("Failed to create subsystem: %s", err)
+	}
+	_, err = spdk.NvmfSubsystemAddNs(ctx, targetClient, spdk.NvmfSubsystemAddNsArgs{
+		Nqn:       nqn,
+		Namespace: spdk.NvmfNamespaceParams{BdevName: "Malloc0", Anagrpid: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add namespace: %s", err)
+	}
+	for _, port := range []string{"4450", "4451"} {
+		_, err = spdk.NvmfSubsystemAddListener(ctx, targetClient, spdk.NvmfSubsystemListenerArgs{Nqn: nqn, ListenAddress: tcpListenAddress(port)})
+		if err != nil {
+			t.Fatalf("Failed to add listener: %s", err)
+		}
+	}
+
+	attachArgs := spdk.BdevNvmeAttachControllerArgs{
+		Name:        "Nvme0",
+		Trtype:      spdk.NvmeTransportTCP,
+		Traddr:      "127.0.0.1",
+		Trsvcid:     "4450",
+		Subnqn:      nqn,
+		Multipath:   spdk.NvmeMultipathMultipath,
+		NumIoQueues: 2,
+	}
+	for _, port := range []string{"4450", "4451"} {
+		attachArgs.Trsvcid = port
+		_, err = spdk.BdevNvmeAttachController(ctx, client, attachArgs)
+		if err != nil {
+			t.Fatalf("Failed to attach path to %s: %s", port, err)
+		}
+	}
+
+	// current returns the ports of the current paths of Nvme0n1.
+	current := func() []string {
+		ioPaths, err := spdk.BdevNvmeGetIoPaths(ctx, client, spdk.BdevNvmeGetIoPathsArgs{Name: "Nvme0n1"})
+		assert.NoError(t, err, "Failed to get I/O paths: %s", err)
+		ports := []string{}
+		for _, group := range ioPaths.PollGroups {
+			for _, ioPath := range group.IoPaths {
+				assert.True(t, ioPath.Connected)
+				if ioPath.Current {
+					ports = append(ports, ioPath.Transport.Trsvcid)
+				}
+			}
+		}
+		return ports
+	}
+	setAnaState := func(port string, state spdk.NvmfAnaState) {
+		_, err := spdk.NvmfSubsystemListenerSetAnaState(ctx, targetClient, spdk.NvmfSubsystemListenerSetAnaStateArgs{
+			Nqn:           nqn,
+			ListenAddress: tcpListenAddress(port),
+			AnaState:      state,
+		})
+		assert.NoError(t, err, "Failed to set ANA state: %s", err)
+	}
+
+	assert.Equal(t, []string{"4450"}, current())
+	setAnaState("4450", spdk.NvmfAnaInaccessible)
+	setAnaState("4451", spdk.NvmfAnaNonOptimized)
+	assert.Equal(t, []string{"4451"}, current())
+	setAnaState("4450", spdk.NvmfAnaOptimized)
+	assert.Equal(t, []string{"4450"}, current())
+
+	listeners, err := spdk.NvmfSubsystemGetListeners(ctx, targetClient, spdk.NvmfSubsystemGetListenersArgs{Nqn: nqn})
+	assert.NoError(t, err, "Failed to get listeners: %s", err)
+	if assert.Len(t, listeners, 2) {
+		assert.Equal(t, tcpListenAddress("4450"), listeners[0].Address)
+		assert.Equal(t, spdk.NvmfAnaOptimized, listeners[0].State(2))
+		assert.Equal(t, spdk.NvmfAnaNonOptimized, listeners[1].State(2))
+		assert.Len(t, listeners[1].AnaStates, 2)
+	}
+
+	_, err = spdk.BdevNvmeSetMultipathPolicy(ctx, client, spdk.BdevNvmeSetMultipathPolicyArgs{
+		Name:     "Nvme0n1",
+		Policy:   spdk.NvmeMultipathPolicyActiveActive,
+		Selector: spdk.NvmeMultipathSelectorRoundRobin,
+	})
+	assert.NoError(t, err, "Failed to set multipath policy: %s", err)
+	setAnaState("4451", spdk.NvmfAnaOptimized)
+	assert.Equal(t, []string{"4450", "4451"}, current())
+	_, err = spdk.BdevNvmeSetMultipathPolicy(ctx, client, spdk.BdevNvmeSetMultipathPolicyArgs{
+		Name:     "Nvme0n1",
+		Policy:   spdk.NvmeMultipathPolicyActivePassive,
+		Selector: spdk.NvmeMultipathSelectorQueueDepth,
+	})
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	controllers, err := spdk.NvmfSubsystemGetControllers(ctx, targetClient, spdk.NvmfSubsystemGetControllersArgs{Nqn: nqn})
+	assert.NoError(t, err, "Failed to get controllers: %s", err)
+	if assert.Len(t, controllers, 2) {
+		assert.Equal(t, 2, controllers[0].NumIoQpairs)
+		assert.Contains(t, controllers[0].Hostnqn, controllers[0].Hostid)
+	}
+	qpairs, err := spdk.NvmfSubsystemGetQpairs(ctx, targetClient, spdk.NvmfSubsystemGetQpairsArgs{Nqn: nqn})
+	assert.NoError(t, err, "Failed to get qpairs: %s", err)
+	assert.Len(t, qpairs, 6)
+
+	// Detaching a path disconnects its controller.
+	_, err = spdk.BdevNvmeDetachController(ctx, client, spdk.BdevNvmeDetachControllerArgs{Name: "Nvme0", Trsvcid: "4450"})
+	assert.NoError(t, err, "Failed to detach path: %s", err)
+	controllers, err = spdk.NvmfSubsystemGetControllers(ctx, targetClient, spdk.NvmfSubsystemGetControllersArgs{Nqn: nqn})
+	assert.NoError(t, err, "Failed to get controllers: %s", err)
+	assert.Len(t, controllers, 1)
+	assert.Equal(t, []string{"4451"}, current())
+}
@@ -0,0 +1,481 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+const (
+	raidProductName = "Raid Volume"
+	// raidSuperblockSize is the space reserved for the
+	// superblock at the start of each base bdev.
+	raidSuperblockSize = 1024 * 1024
+)
+
+// raidBdev is a RAID bdev. It is registered as bdev while it is online.
+type raidBdev struct {
+	name        string
+	uuid        string
+	level       string
+	stripSizeKB int64
+	superblock  bool
+	slots       []*raidSlot
+	state       string
+	bdev        *bdev
+	// dataOffset and dataSize are the blocks used on each base bdev,
+	// set when the RAID bdev goes online.
+	dataOffset int64
+	dataSize   int64
+	// rebuild is the slot being rebuilt. The fake completes a rebuild
+	// once bdev_raid_get_bdevs reported it.
+	rebuild *raidSlot
+}
+
+// raidSlot is an entry of the base bdev list.
+type raidSlot struct {
+	// name is the base bdev to wait for while configuring,
+	// empty after a base bdev was removed.
+	name string
+	base *bdev
+	// removed is set when the slot lost its base bdev.
+	removed bool
+}
+
+// minOperational returns how many base bdevs the RAID bdev needs to
+// stay online.
+func (r *raidBdev) minOperational() int {
+	switch r.level {
+	case spdk.RaidLevel1:
+		return 1
+	case spdk.RaidLevel5f:
+		return len(r.slots) - 1
+	}
+	return len(r.slots)
+}
+
+func (r *raidBdev) numDiscovered() int {
+	n := 0
+	for _, slot := range r.slots {
+		if slot.base != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *raidBdev) numOperational() int {
+	n := 0
+	for _, slot := range r.slots {
+		if !slot.removed {
+			n++
+		}
+	}
+	return n
+}
+
+// stripBlocks returns the strip size in blocks, 1 without strips.
+func (r *raidBdev) stripBlocks(blockSize int64) int64 {
+	if r.stripSizeKB == 0 {
+		return 1
+	}
+	return r.stripSizeKB * 1024 / blockSize
+}
+
+// numBlocks returns the size of the RAID bdev.
+func (r *raidBdev) numBlocks() int64 {
+	switch r.level {
+	case spdk.RaidLevel1:
+		return r.dataSize
+	case spdk.RaidLevel5f:
+		return r.dataSize * int64(len(r.slots)-1)
+	}
+	return r.dataSize * int64(len(r.slots))
+}
+
+func (r *raidBdev) info() map[string]interface{} {
+	bases := []interface{}{}
+	for _, slot := range r.slots {
+		base := map[string]interface{}{
+			"name":          nil,
+			"uuid":          "00000000-0000-0000-0000-000000000000",
+			"is_configured": slot.base != nil,
+			"data_offset":   r.dataOffset,
+			"data_size":     r.dataSize,
+		}
+		if slot.name != "" {
+			base["name"] = slot.name
+		}
+		if slot.base != nil {
+			base["uuid"] = slot.base.uuid
+		}
+		bases = append(bases, base)
+	}
+	info := map[string]interface{}{
+		"uuid":                       r.uuid,
+		"strip_size_kb":              r.stripSizeKB,
+		"state":                      r.state,
+		"raid_level":                 r.level,
+		"superblock":                 r.superblock,
+		"num_base_bdevs":             len(r.slots),
+		"num_base_bdevs_discovered":  r.numDiscovered(),
+		"num_base_bdevs_operational": r.numOperational(),
+		"base_bdevs_list":            bases,
+	}
+	if r.rebuild != nil {
+		info["process"] = map[string]interface{}{
+			"type":     "rebuild",
+			"target":   r.rebuild.name,
+			"progress": map[string]interface{}{"blocks": 0, "percent": 0},
+		}
+	}
+	return info
+}
+
+func (s *Server) findRaidBdev(name string) *raidBdev {
+	for _, r := range s.raidBdevs {
+		if r.name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupRaidBdev(name string) (*raidBdev, error) {
+	r := s.findRaidBdev(name)
+	if r == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "raid bdev %s not found", name)
+	}
+	return r, nil
+}
+
+// claimBase checks whether base fits into r and claims it for slot.
+func (r *raidBdev) claimBase(slot *raidSlot, base *bdev) error {
+	if err := base.inUse(); err != nil {
+		return err
+	}
+	for _, other := range r.slots {
+		if other.base != nil && other.base.blockSize != base.blockSize {
+			return errnoError(spdk.ErrInvalid, "block size of base bdev %s differs from raid bdev %s", base.name, r.name)
+		}
+	}
+	if r.state != spdk.RaidStateConfiguring && base.numBlocks < r.dataOffset+r.dataSize {
+		return errnoError(spdk.ErrInvalid, "base bdev %s too small for raid bdev %s", base.name, r.name)
+	}
+	slot.name = base.name
+	slot.base = base
+	slot.removed = false
+	base.claimedBy = "raid"
+	return nil
+}
+
+// configureRaidBdev registers r once all base bdevs appeared.
+func (s *Server) configureRaidBdev(r *raidBdev) error {
+	if r.state != spdk.RaidStateConfiguring || r.numDiscovered() < len(r.slots) {
+		return nil
+	}
+
+	blockSize := r.slots[0].base.blockSize
+	stripBlocks := r.stripBlocks(blockSize)
+	if stripBlocks == 0 {
+		return errnoError(spdk.ErrInvalid, "strip size of raid bdev %s smaller than block size", r.name)
+	}
+	r.dataOffset = 0
+	if r.superblock {
+		r.dataOffset = (raidSuperblockSize/blockSize + stripBlocks - 1) / stripBlocks * stripBlocks
+	}
+	r.dataSize = 0
+	for _, slot := range r.slots {
+		size := slot.base.numBlocks - r.dataOffset
+		if r.dataSize == 0 || size < r.dataSize {
+			r.dataSize = size
+		}
+	}
+	r.dataSize = r.dataSize / stripBlocks * stripBlocks
+	if r.dataSize <= 0 {
+		return errnoError(spdk.ErrNoSpace, "base bdevs too small for raid bdev %s", r.name)
+	}
+
+	r.bdev = &bdev{
+		name:        r.name,
+		productName: raidProductName,
+		uuid:        r.uuid,
+		blockSize:   blockSize,
+		numBlocks:   r.numBlocks(),
+		driverSpecific: func() map[string]interface{} {
+			return map[string]interface{}{"raid": r.info()}
+		},
+	}
+	r.state = spdk.RaidStateOnline
+	if err := s.addBdev(r.bdev); err != nil {
+		r.state = spdk.RaidStateConfiguring
+		r.bdev = nil
+		return err
+	}
+	return nil
+}
+
+// examineRaid lets configuring RAID bdevs claim b, like the examine
+// callback of the raid module does for new bdevs.
+func (s *Server) examineRaid(b *bdev) {
+	for _, r := range s.raidBdevs {
+		if r.state != spdk.RaidStateConfiguring {
+			continue
+		}
+		for _, slot := range r.slots {
+			if slot.base == nil && !slot.removed && slot.name == b.name {
+				if r.claimBase(slot, b) == nil {
+					s.configureRaidBdev(r)
+				}
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) registerRaidMethods() {
+	s.methods["bdev_raid_create"] = s.bdevRaidCreate
+	s.methods["bdev_raid_delete"] = s.bdevRaidDelete
+	s.methods["bdev_raid_get_bdevs"] = s.bdevRaidGetBdevs
+	s.methods["bdev_raid_add_base_bdev"] = s.bdevRaidAddBaseBdev
+	s.methods["bdev_raid_remove_base_bdev"] = s.bdevRaidRemoveBaseBdev
+}
+
+func (s *Server) bdevRaidCreate(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevRaidCreateArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" || args.RaidLevel == "" || len(args.BaseBdevs) == 0 {
+		return nil, invalidParams("name, raid_level and base_bdevs are required")
+	}
+
+	minBaseBdevs := 1
+	level := args.RaidLevel
+	switch level {
+	case spdk.RaidLevel0, "0":
+		level = spdk.RaidLevel0
+	case spdk.RaidLevel1, "1":
+		level = spdk.RaidLevel1
+		minBaseBdevs = 2
+	case spdk.RaidLevel5f, "5f":
+		level = spdk.RaidLevel5f
+		minBaseBdevs = 3
+	case spdk.RaidLevelConcat:
+	default:
+		return nil, invalidParams("unsupported raid_level " + args.RaidLevel)
+	}
+	if level == spdk.RaidLevel1 {
+		if args.StripSizeKB != 0 {
+			return nil, invalidParams("strip size is not supported by raid1")
+		}
+	} else if args.StripSizeKB <= 0 || args.StripSizeKB&(args.StripSizeKB-1) != 0 {
+		return nil, invalidParams("strip_size_kb must be a power of two")
+	}
+	if len(args.BaseBdevs) < minBaseBdevs {
+		return nil, invalidParams(fmt.Sprintf("at least %d base bdevs required for %s", minBaseBdevs, level))
+	}
+	if s.findRaidBdev(args.Name) != nil || s.findBdev(args.Name) != nil {
+		return nil, errnoError(spdk.ErrExist, "raid bdev %s already exists", args.Name)
+	}
+
+	r := &raidBdev{
+		name:        args.Name,
+		uuid:        args.UUID,
+		level:       level,
+		stripSizeKB: args.StripSizeKB,
+		superblock:  args.Superblock,
+		state:       spdk.RaidStateConfiguring,
+	}
+	if r.uuid == "" {
+		r.uuid = newUUID()
+	}
+	for i, name := range args.BaseBdevs {
+		for _, other := range args.BaseBdevs[:i] {
+			if other == name {
+				return nil, errnoError(spdk.ErrExist, "base bdev %s listed twice", name)
+			}
+		}
+		for _, other := range s.raidBdevs {
+			for _, slot := range other.slots {
+				if slot.name == name {
+					return nil, errnoError(spdk.ErrBusy, "base bdev %s belongs to raid bdev %s", name, other.name)
+				}
+			}
+		}
+		r.slots = append(r.slots, &raidSlot{name: name})
+	}
+
+	// Check all base bdevs before claiming any.
+	blockSize := int64(0)
+	for _, slot := range r.slots {
+		base := s.findBdev(slot.name)
+		if base == nil {
+			continue
+		}
+		if err := base.inUse(); err != nil {
+			return nil, err
+		}
+		if blockSize != 0 && base.blockSize != blockSize {
+			return nil, errnoError(spdk.ErrInvalid, "block sizes of the base bdevs of raid bdev %s differ", r.name)
+		}
+		blockSize = base.blockSize
+	}
+	for _, slot := range r.slots {
+		if base := s.findBdev(slot.name); base != nil {
+			r.claimBase(slot, base)
+		}
+	}
+	if err := s.configureRaidBdev(r); err != nil {
+		for _, slot := range r.slots {
+			if slot.base != nil {
+				slot.base.claimedBy = ""
+			}
+		}
+		return nil, err
+	}
+	s.raidBdevs = append(s.raidBdevs, r)
+	return true, nil
+}
+
+func (s *Server) bdevRaidDelete(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevRaidDeleteArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	r, err := s.lookupRaidBdev(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	if r.bdev != nil {
+		if err := s.deleteBdev(r.bdev); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, slot := range r.slots {
+		if slot.base != nil {
+			slot.base.claimedBy = ""
+		}
+	}
+	for i := range s.raidBdevs {
+		if s.raidBdevs[i] == r {
+			s.raidBdevs = append(s.raidBdevs[:i], s.raidBdevs[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) bdevRaidGetBdevs(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevRaidGetBdevsArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	switch args.Category {
+	case spdk.RaidCategoryAll, spdk.RaidStateOnline, spdk.RaidStateConfiguring, spdk.RaidStateOffline:
+	default:
+		return nil, invalidParams("invalid category " + args.Category)
+	}
+
+	result := []interface{}{}
+	for _, r := range s.raidBdevs {
+		if args.Category != spdk.RaidCategoryAll && args.Category != r.state {
+			continue
+		}
+		info := r.info()
+		info["name"] = r.name
+		result = append(result, info)
+		r.rebuild = nil
+	}
+	return result, nil
+}
+
+func (s *Server) bdevRaidAddBaseBdev(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevRaidAddBaseBdevArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	r, err := s.lookupRaidBdev(args.RaidBdev)
+	if err != nil {
+		return nil, err
+	}
+	base, err := s.lookupBdev(args.BaseBdev)
+	if err != nil {
+		return nil, err
+	}
+	if r.state == spdk.RaidStateOffline {
+		return nil, errnoError(spdk.ErrInvalid, "raid bdev %s is offline", r.name)
+	}
+
+	// The base bdev takes the slot waiting for it or one which
+	// lost its base bdev.
+	var slot *raidSlot
+	for _, candidate := range r.slots {
+		if candidate.base == nil && (candidate.removed || candidate.name == base.name) {
+			slot = candidate
+			break
+		}
+	}
+	if slot == nil {
+		return nil, errnoError(spdk.ErrInvalid, "raid bdev %s has no free base bdev slot", r.name)
+	}
+	if err := r.claimBase(slot, base); err != nil {
+		return nil, err
+	}
+	if r.state == spdk.RaidStateOnline {
+		r.rebuild = slot
+		return true, nil
+	}
+	if err := s.configureRaidBdev(r); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) bdevRaidRemoveBaseBdev(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevRaidRemoveBaseBdevArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	var r *raidBdev
+	var slot *raidSlot
+	for _, candidate := range s.raidBdevs {
+		for _, candidateSlot := range candidate.slots {
+			if candidateSlot.base != nil && candidateSlot.base.name == args.Name {
+				r, slot = candidate, candidateSlot
+			}
+		}
+	}
+	if slot == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "base bdev %s of a raid bdev not found", args.Name)
+	}
+
+	if r.state == spdk.RaidStateOnline && r.numOperational()-1 < r.minOperational() {
+		// Unlike SPDK, the fake does not hot-remove the RAID bdev.
+		if err := s.deleteBdev(r.bdev); err != nil {
+			return nil, err
+		}
+		r.bdev = nil
+		r.state = spdk.RaidStateOffline
+	}
+	slot.base.claimedBy = ""
+	slot.base = nil
+	if r.state == spdk.RaidStateConfiguring {
+		return true, nil
+	}
+	slot.name = ""
+	slot.removed = true
+	if r.rebuild == slot {
+		r.rebuild = nil
+	}
+	return true, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func raidBdev(t *testing.T, client *spdk.Client, name string) spdk.RaidBdev {
+	raids, err := spdk.BdevRaidGetBdevs(context.Background(), client, spdk.BdevRaidGetBdevsArgs{})
+	assert.NoError(t, err, "Failed to list raid bdevs: %s", err)
+	for _, raid := range raids {
+		if raid.Name == name {
+			return raid
+		}
+	}
+	t.Fatalf("raid bdev %s not found", name)
+	return spdk.RaidBdev{}
+}
+
+func TestRaid(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	for i := 0; i < 3; i++ {
+		createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+	}
+
+	_, err := spdk.BdevRaidCreate(ctx, client, spdk.BdevRaidCreateArgs{
+		Name: "Raid0", RaidLevel: spdk.RaidLevel0, StripSizeKB: 64, BaseBdevs: []string{"Malloc0", "Malloc1"}})
+	assert.NoError(t, err, "Failed to create raid0: %s", err)
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: "Raid0"})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, int64(2048), bdevs[0].NumBlocks)
+		raid, ok := bdevs[0].Raid()
+		assert.True(t, ok)
+		assert.Equal(t, spdk.RaidStateOnline, raid.State)
+	}
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	_, err = spdk.BdevRaidCreate(ctx, client, spdk.BdevRaidCreateArgs{
+		Name: "Raid1", RaidLevel: spdk.RaidLevel1, StripSizeKB: 64, BaseBdevs: []string{"Malloc2", "Malloc3"}})
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	// A raid0 goes offline without one of its base bdevs.
+	_, err = spdk.BdevRaidRemoveBaseBdev(ctx, client, spdk.BdevRaidRemoveBaseBdevArgs{Name: "Malloc1"})
+	assert.NoError(t, err, "Failed to remove base bdev: %s", err)
+	raids, err := spdk.BdevRaidGetBdevs(ctx, client, spdk.BdevRaidGetBdevsArgs{Category: spdk.RaidStateOffline})
+	assert.NoError(t, err, "Failed to list raid bdevs: %s", err)
+	if assert.Len(t, raids, 1) {
+		assert.Equal(t, "Raid0", raids[0].Name)
+	}
+	_, err = spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: "Raid0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+	_, err = spdk.BdevRaidDelete(ctx, client, spdk.BdevRaidDeleteArgs{Name: "Raid0"})
+	assert.NoError(t, err, "Failed to delete raid0: %s", err)
+
+	// A raid1 is configuring until its base bdevs appear.
+	_, err = spdk.BdevRaidCreate(ctx, client, spdk.BdevRaidCreateArgs{
+		Name: "Raid1", RaidLevel: spdk.RaidLevel1, BaseBdevs: []string{"Malloc0", "Malloc3"}, Superblock: true})
+	assert.NoError(t, err, "Failed to create raid1: %s", err)
+	raids, err = spdk.BdevRaidGetBdevs(ctx, client, spdk.BdevRaidGetBdevsArgs{Category: spdk.RaidStateConfiguring})
+	assert.NoError(t, err, "Failed to list raid bdevs: %s", err)
+	if assert.Len(t, raids, 1) {
+		assert.Equal(t, 1, raids[0].NumBaseBdevsDiscovered)
+	}
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+	raid := raidBdev(t, client, "Raid1")
+	assert.Equal(t, spdk.RaidStateOnline, raid.State)
+	assert.False(t, raid.Degraded())
+	if assert.Len(t, raid.BaseBdevsList, 2) {
+		// The superblock takes 1 MiB.
+		assert.Equal(t, int64(256), raid.BaseBdevsList[0].DataOffset)
+		assert.Equal(t, int64(768), raid.BaseBdevsList[0].DataSize)
+	}
+
+	// A raid1 is degraded without one of its base bdevs and
+	// rebuilds onto a new one.
+	_, err = spdk.BdevRaidRemoveBaseBdev(ctx, client, spdk.BdevRaidRemoveBaseBdevArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to remove base bdev: %s", err)
+	raid = raidBdev(t, client, "Raid1")
+	assert.Equal(t, spdk.RaidStateOnline, raid.State)
+	assert.True(t, raid.Degraded())
+	assert.Equal(t, []spdk.RaidBaseBdevState{spdk.RaidBaseBdevMissing, spdk.RaidBaseBdevOnline}, raid.BaseBdevStates())
+
+	_, err = spdk.BdevRaidAddBaseBdev(ctx, client, spdk.BdevRaidAddBaseBdevArgs{RaidBdev: "Raid1", BaseBdev: "Malloc2"})
+	assert.NoError(t, err, "Failed to add base bdev: %s", err)
+	raid = raidBdev(t, client, "Raid1")
+	assert.Equal(t, []spdk.RaidBaseBdevState{spdk.RaidBaseBdevRebuilding, spdk.RaidBaseBdevOnline}, raid.BaseBdevStates())
+	raid = raidBdev(t, client, "Raid1")
+	assert.False(t, raid.Degraded())
+	assert.Nil(t, raid.Process)
+
+	_, err = spdk.BdevRaidAddBaseBdev(ctx, client, spdk.BdevRaidAddBaseBdevArgs{RaidBdev: "Raid1", BaseBdev: "Malloc1"})
+	assert.ErrorIs(t, err, spdk.ErrInvalid)
+
+	_, err = spdk.BdevRaidDelete(ctx, client, spdk.BdevRaidDeleteArgs{Name: "Raid1"})
+	assert.NoError(t, err, "Failed to delete raid1: %s", err)
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("Malloc%d", i)
+		_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: name})
+		assert.NoError(t, err, "Failed to delete %s: %s", name, err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"sort"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// version is the SPDK release whose RPC interface gets simulated.
+var version = spdk.SpdkGetVersionResponse{
+	Version: "SPDK v23.01 git sha1 spdktest",
+	Fields:  spdk.SpdkVersionFields{Major: 23, Minor: 1, Commit: "spdktest"},
+}
+
+func (s *Server) registerRpcMethods() {
+	s.methods["rpc_get_methods"] = s.rpcGetMethods
+	s.methods["spdk_get_version"] = s.spdkGetVersion
+}
+
+func (s *Server) rpcGetMethods(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Current        bool `json:"current"`
+		IncludeAliases bool `json:"include_aliases"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	// The fake is always past framework_start_init and
+	// has no deprecated aliases.
+	methods := []string{}
+	for method := range s.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods, nil
+}
+
+func (s *Server) spdkGetVersion(params json.RawMessage) (interface{}, error) {
+	if params != nil {
+		return nil, invalidParams("spdk_get_version requires no parameters")
+	}
+	return version, nil
+}
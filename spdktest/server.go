@@ -0,0 +1,316 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package spdktest provides a fake SPDK application for hermetic tests.
+// The Server speaks SPDK's JSON-RPC on a unix socket and simulates
+// bdevs (malloc, aio, RAID), logical volumes including snapshots and
+// clones, vhost controllers, virtio initiators, nbd disks, bdev
+// notifications, NVMe-oF subsystems, NVMe controllers and iSCSI target
+// nodes in memory, closely enough to run the spdkctrl wrappers and code
+// built on them without SPDK, sudo or hugepages.
+//
+// NVMe-oF subsystems which listen on an address can be attached with
+// bdev_nvme_attach_controller by any Server of the test process,
+// including the exporting one, as if they were connected by loopback.
+// Likewise the socket of a vhost controller can be attached with
+// bdev_virtio_attach_controller.
+//
+// Compared to SPDK the simulation is deliberately strict: a bdev which
+// is in use by a vhost controller, a nbd disk, a NVMe-oF subsystem, an
+// iSCSI target node, a RAID bdev or a logical volume store cannot be
+// deleted, whereas SPDK would hot-remove it.
+package spdktest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// Method implements a JSON-RPC method. params is nil when the request
+// had none. Errors of type *spdkctrl.JSONRPCError are passed to the
+// client as they are, others are reported as ERROR_INTERNAL_ERROR.
+type Method func(params json.RawMessage) (interface{}, error)
+
+// Server is a fake SPDK application.
+type Server struct {
+	sockPath string
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	// mutex serializes all requests, like the single
+	// RPC thread of SPDK.
+	mutex   sync.Mutex
+	methods map[string]Method
+	conns   map[net.Conn]struct{}
+	closed  bool
+
+	bdevs       []*bdev
+	lvstores    []*lvstore
+	controllers []*vhostController
+	nbdDisks    []*nbdDisk
+	nextMalloc  int
+
+	notifications    []spdk.Notification
+	nextNotification uint64
+
+	nvmfTransports  []spdk.NvmfTransport
+	subsystems      []*nvmfSubsystem
+	nvmeControllers []*nvmeController
+	iscsiOptions    spdk.IscsiOptions
+	portalGroups    []*spdk.IscsiPortalGroup
+	initiatorGroups []*spdk.IscsiInitiatorGroup
+	targetNodes     []*iscsiTargetNode
+	authGroups      []*spdk.IscsiAuthGroup
+
+	virtioControllers []*virtioController
+	raidBdevs         []*raidBdev
+
+	// hostnqn is the default NQN of the NVMe-oF host, made of hostid.
+	hostnqn string
+	hostid  string
+}
+
+// NewServer starts serving on a new unix socket at sockPath.
+func NewServer(sockPath string) (*Server, error) {
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hostid := newUUID()
+	s := &Server{
+		sockPath: sockPath,
+		listener: listener,
+		methods:  make(map[string]Method),
+		conns:    make(map[net.Conn]struct{}),
+		hostnqn:  "nqn.2014-08.org.nvmexpress:uuid:" + hostid,
+		hostid:   hostid,
+	}
+	s.registerRpcMethods()
+	s.registerBdevMethods()
+	s.registerLvolMethods()
+	s.registerVhostMethods()
+	s.registerNbdMethods()
+	s.registerNotifyMethods()
+	s.registerNvmfMethods()
+	s.registerNvmeMethods()
+	s.registerIscsiMethods()
+	s.registerVirtioMethods()
+	s.registerRaidMethods()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Run starts a Server in a temporary directory of the test and
+// stops it when the test is done.
+func Run(t testing.TB) *Server {
+	t.Helper()
+	s, err := NewServer(filepath.Join(t.TempDir(), "spdk.sock"))
+	if err != nil {
+		t.Fatalf("Failed to start fake SPDK: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// SocketPath returns the path of the RPC socket.
+func (s *Server) SocketPath() string {
+	return s.sockPath
+}
+
+// Handle adds a method or replaces a simulated one, for example to
+// inject failures. It is called with the server state locked.
+func (s *Server) Handle(method string, m Method) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.methods[method] = m
+}
+
+// Close stops serving and closes all client connections.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	fabricClose(s)
+	vhostUserClose(s)
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   interface{}     `json:"error,omitempty"`
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				enc.Encode(errorResponse(nil, spdk.ErrParseError))
+			}
+			return
+		}
+		if resp := s.handleMessage(msg); resp != nil {
+			if err := enc.Encode(resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMessage returns the response to a request, nil if there is
+// nothing to respond. Like SPDK, it rejects batch arrays with a single
+// error without id.
+func (s *Server) handleMessage(msg json.RawMessage) interface{} {
+	trimmed := bytes.TrimLeft(msg, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return errorResponse(nil, spdk.ErrInvalidRequest)
+	}
+	return s.handleRequest(msg)
+}
+
+// handleRequest returns the response to a request, nil for notifications.
+func (s *Server) handleRequest(msg json.RawMessage) interface{} {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return errorResponse(nil, spdk.ErrInvalidRequest)
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, spdk.ErrInvalidRequest)
+	}
+
+	result, err := s.call(req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return errorResponse(req.ID, err)
+	}
+	if result == nil {
+		result = true
+	}
+	return &response{Version: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *Server) call(method string, params json.RawMessage) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.methods[method]
+	if !ok {
+		return nil, spdk.ErrMethodNotFound
+	}
+	if string(params) == "null" {
+		params = nil
+	}
+	return m(params)
+}
+
+func errorResponse(id json.RawMessage, err error) *response {
+	var jsonErr *spdk.JSONRPCError
+	if !errors.As(err, &jsonErr) {
+		jsonErr = &spdk.JSONRPCError{Code: spdk.ERROR_INTERNAL_ERROR, Message: err.Error()}
+	}
+	return &response{Version: "2.0", ID: id, Error: jsonErr}
+}
+
+// decodeParams decodes params strictly like SPDK, which rejects
+// unknown parameters. It is a no-op when there were no params.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if params == nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return invalidParams(err.Error())
+	}
+	return nil
+}
+
+func invalidParams(msg string) error {
+	return &spdk.JSONRPCError{Code: spdk.ERROR_INVALID_PARAMS, Message: "Invalid parameters: " + msg}
+}
+
+// errnoError returns an error with the code of sentinel and
+// a message describing the object concerned.
+func errnoError(sentinel *spdk.JSONRPCError, format string, a ...interface{}) error {
+	return &spdk.JSONRPCError{
+		Code:    sentinel.Code,
+		Message: fmt.Sprintf(format, a...) + ": " + sentinel.Message,
+	}
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/dong-liuliu/spdkctrl/spdktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func connect(t *testing.T) (*spdktest.Server, *spdk.Client) {
+	server := spdktest.Run(t)
+	client, err := spdk.NewClient(server.SocketPath(), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect fake SPDK: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// createMalloc creates a malloc bdev and returns its name.
+func createMalloc(t *testing.T, client spdk.Invoker, args spdk.BdevMallocCreateArgs) string {
+	t.Helper()
+	name, err := spdk.BdevMallocCreate(context.Background(), client, args)
+	if err != nil {
+		t.Fatalf("Failed to create malloc bdev: %s", err)
+	}
+	return name
+}
+
+// createLvstore creates the lvstore Lvs0 on a new malloc bdev of
+// numBlocks 4 KiB blocks and returns its UUID.
+func createLvstore(t *testing.T, client spdk.Invoker, numBlocks int64) string {
+	t.Helper()
+	bdev := createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: numBlocks, BlockSize: 4096})
+	uuid, err := spdk.BdevLvolCreateLvstore(context.Background(), client, spdk.BdevLvolCreateLvstoreArgs{BdevName: bdev, LvsName: "Lvs0"})
+	if err != nil {
+		t.Fatalf("Failed to create lvstore: %s", err)
+	}
+	return uuid
+}
+
+func TestServerHandle(t *testing.T) {
+	ctx := context.Background()
+	server, client := connect(t)
+
+	err := client.Invoke(ctx, "no_such_method", nil, nil)
+	assert.ErrorIs(t, err, spdk.ErrMethodNotFound)
+
+	// Unknown parameters are rejected like by SPDK.
+	err = client.Invoke(ctx, "bdev_get_bdevs", map[string]string{"bdev_name": "Malloc0"}, nil)
+	assert.ErrorIs(t, err, spdk.ErrInvalidParams)
+
+	server.Handle("bdev_malloc_create", func(params json.RawMessage) (interface{}, error) {
+		return nil, spdk.ErrNoMemory
+	})
+	_, err = spdk.BdevMallocCreate(ctx, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+	assert.ErrorIs(t, err, spdk.ErrNoMemory)
+}
+
+func TestServerRejectsBatch(t *testing.T) {
+	server := spdktest.Run(t)
+	conn, err := net.Dial("unix", server.SocketPath())
+	if err != nil {
+		t.Fatalf("Failed to connect fake SPDK: %s", err)
+	}
+	defer conn.Close()
+
+	// Like SPDK, the fake answers a batch array with one error without id.
+	_, err = conn.Write([]byte(`[{"jsonrpc": "2.0", "method": "bdev_get_bdevs", "id": 1}]`))
+	if err != nil {
+		t.Fatalf("Failed to write batch: %s", err)
+	}
+	var resp struct {
+		ID    json.RawMessage   `json:"id"`
+		Error spdk.JSONRPCError `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		t.Fatalf("Failed to read response: %s", err)
+	}
+	assert.Equal(t, "null", string(resp.ID))
+	assert.Equal(t, spdk.ERROR_INVALID_REQUEST, resp.Error.Code)
+}
+
+func TestRpcMethods(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	methods, err := spdk.RpcGetMethods(ctx, client, spdk.RpcGetMethodsArgs{Current: true})
+	assert.NoError(t, err, "Failed to get methods: %s", err)
+	assert.Contains(t, methods, "bdev_malloc_create")
+	assert.Contains(t, methods, "spdk_get_version")
+
+	version, err := spdk.SpdkGetVersion(ctx, client)
+	assert.NoError(t, err, "Failed to get version: %s", err)
+	assert.Equal(t, 23, version.Fields.Major)
+	assert.Contains(t, version.Version, "SPDK v23.01")
+}
@@ -0,0 +1,355 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+type vhostController struct {
+	name          string
+	cpumask       string
+	delayBaseUs   int
+	iopsThreshold int
+	// bdevs are opened by the controller.
+	bdevs []*bdev
+	// scsiTargets are the bdevs of the targets of a vhost-scsi
+	// controller, nil if there is no target with that number.
+	scsiTargets []*bdev
+	// backendSpecific returns the backend_specific member of
+	// vhost_get_controllers.
+	backendSpecific func() map[string]interface{}
+}
+
+func (c *vhostController) user() string {
+	return "vhost controller " + c.name
+}
+
+// socketPath returns the path of the vhost-user socket of c.
+func (s *Server) socketPath(c *vhostController) string {
+	return filepath.Join(filepath.Dir(s.sockPath), c.name)
+}
+
+// export returns what c exposes to virtio controllers.
+func (c *vhostController) export() *vhostExport {
+	export := &vhostExport{devType: spdk.VirtioDevTypeBlk, disks: make(map[int]vhostDisk)}
+	if c.scsiTargets == nil {
+		export.disks[0] = vhostDisk{blockSize: c.bdevs[0].blockSize, numBlocks: c.bdevs[0].numBlocks}
+		return export
+	}
+	export.devType = spdk.VirtioDevTypeScsi
+	for num, b := range c.scsiTargets {
+		if b != nil {
+			export.disks[num] = vhostDisk{blockSize: b.blockSize, numBlocks: b.numBlocks}
+		}
+	}
+	return export
+}
+
+func (s *Server) vhostControllerInfo(c *vhostController) map[string]interface{} {
+	return map[string]interface{}{
+		"ctrlr":            c.name,
+		"cpumask":          c.cpumask,
+		"delay_base_us":    c.delayBaseUs,
+		"iops_threshold":   c.iopsThreshold,
+		"socket":           s.socketPath(c),
+		"backend_specific": c.backendSpecific(),
+	}
+}
+
+func (s *Server) findVhostController(name string) *vhostController {
+	for _, c := range s.controllers {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupVhostController(name string) (*vhostController, error) {
+	c := s.findVhostController(name)
+	if c == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "vhost controller %s not found", name)
+	}
+	return c, nil
+}
+
+func (s *Server) addVhostController(c *vhostController) error {
+	if s.findVhostController(c.name) != nil {
+		return errnoError(spdk.ErrExist, "vhost controller %s already exists", c.name)
+	}
+	if c.cpumask == "" {
+		c.cpumask = "0x1"
+	}
+	c.iopsThreshold = 60000
+	for _, b := range c.bdevs {
+		b.open(c.user())
+	}
+	s.controllers = append(s.controllers, c)
+	vhostUserListen(s, s.socketPath(c), c.export())
+	return nil
+}
+
+func (s *Server) registerVhostMethods() {
+	s.methods["vhost_create_blk_controller"] = s.vhostCreateBlkController
+	s.methods["vhost_get_controllers"] = s.vhostGetControllers
+	s.methods["vhost_delete_controller"] = s.vhostDeleteController
+	s.methods["vhost_create_scsi_controller"] = s.vhostCreateScsiController
+	s.methods["vhost_scsi_controller_add_target"] = s.vhostScsiControllerAddTarget
+	s.methods["vhost_scsi_controller_remove_target"] = s.vhostScsiControllerRemoveTarget
+	s.methods["vhost_controller_set_coalescing"] = s.vhostControllerSetCoalescing
+}
+
+func (s *Server) vhostCreateBlkController(params json.RawMessage) (interface{}, error) {
+	var args spdk.VhostCreateBlkControllerArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Ctrlr == "" || args.DevName == "" {
+		return nil, invalidParams("ctrlr and dev_name are required")
+	}
+	b, err := s.lookupBdev(args.DevName)
+	if err != nil {
+		return nil, err
+	}
+	if b.claimedBy != "" {
+		return nil, b.inUse()
+	}
+
+	block := spdk.VhostBlkBackendSpecific{
+		Bdev:       b.name,
+		Readonly:   args.Readonly,
+		Transport:  args.Transport,
+		PackedRing: args.PackedRing,
+	}
+	if block.Transport == "" {
+		block.Transport = "vhost_user_blk"
+	}
+	if block.Transport != "vhost_user_blk" {
+		return nil, invalidParams("Unknown transport " + block.Transport)
+	}
+	c := &vhostController{
+		name:    args.Ctrlr,
+		cpumask: args.Cpumask,
+		bdevs:   []*bdev{b},
+		backendSpecific: func() map[string]interface{} {
+			return map[string]interface{}{"block": block}
+		},
+	}
+	if err := s.addVhostController(c); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) vhostGetControllers(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	result := []interface{}{}
+	if args.Name != "" {
+		c, err := s.lookupVhostController(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, s.vhostControllerInfo(c)), nil
+	}
+	for _, c := range s.controllers {
+		result = append(result, s.vhostControllerInfo(c))
+	}
+	return result, nil
+}
+
+func (s *Server) vhostDeleteController(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Ctrlr string `json:"ctrlr"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c, err := s.lookupVhostController(args.Ctrlr)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.bdevs) > 0 && c.scsiTargets != nil {
+		return nil, errnoError(spdk.ErrBusy, "vhost-scsi controller %s has targets", c.name)
+	}
+	if err := vhostUserUnlisten(s.socketPath(c)); err != nil {
+		return nil, err
+	}
+
+	for _, b := range c.bdevs {
+		b.close(c.user())
+	}
+	for i := range s.controllers {
+		if s.controllers[i] == c {
+			s.controllers = append(s.controllers[:i], s.controllers[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+// vhostScsiMaxTargets is the number of targets of a vhost-scsi controller.
+const vhostScsiMaxTargets = 8
+
+func (s *Server) vhostCreateScsiController(params json.RawMessage) (interface{}, error) {
+	var args struct {
+		spdk.VhostCreateScsiControllerArgs
+		Delay bool `json:"delay"`
+	}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Ctrlr == "" {
+		return nil, invalidParams("ctrlr is required")
+	}
+	c := &vhostController{
+		name:        args.Ctrlr,
+		cpumask:     args.Cpumask,
+		scsiTargets: make([]*bdev, vhostScsiMaxTargets),
+	}
+	c.backendSpecific = func() map[string]interface{} {
+		targets := []spdk.VhostScsiBackend{}
+		for num, b := range c.scsiTargets {
+			if b == nil {
+				continue
+			}
+			targets = append(targets, spdk.VhostScsiBackend{
+				TargetName: fmt.Sprintf("Target %d", num),
+				ID:         int32(num),
+				ScsiDevNum: uint32(num),
+				Luns:       []spdk.VhostScsiLun{{ID: 0, BdevName: b.name}},
+			})
+		}
+		return map[string]interface{}{"scsi": targets}
+	}
+	if err := s.addVhostController(c); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *Server) lookupVhostScsiController(name string) (*vhostController, error) {
+	c, err := s.lookupVhostController(name)
+	if err != nil {
+		return nil, err
+	}
+	if c.scsiTargets == nil {
+		return nil, errnoError(spdk.ErrInvalid, "vhost controller %s is not a vhost-scsi controller", name)
+	}
+	return c, nil
+}
+
+func (s *Server) vhostScsiControllerAddTarget(params json.RawMessage) (interface{}, error) {
+	var args spdk.VhostScsiControllerAddTargetArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c, err := s.lookupVhostScsiController(args.Ctrlr)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.lookupBdev(args.BdevName)
+	if err != nil {
+		return nil, err
+	}
+	if b.claimedBy != "" {
+		return nil, b.inUse()
+	}
+
+	num := args.ScsiTargetNum
+	if num == -1 {
+		num = 0
+		for num < vhostScsiMaxTargets && c.scsiTargets[num] != nil {
+			num++
+		}
+		if num == vhostScsiMaxTargets {
+			return nil, errnoError(spdk.ErrNoSpace, "vhost-scsi controller %s has no free target", c.name)
+		}
+	}
+	if num < 0 || num >= vhostScsiMaxTargets {
+		return nil, errnoError(spdk.ErrInvalid, "target %d out of range", num)
+	}
+	if c.scsiTargets[num] != nil {
+		return nil, errnoError(spdk.ErrExist, "target %d of vhost-scsi controller %s", num, c.name)
+	}
+
+	c.scsiTargets[num] = b
+	c.bdevs = append(c.bdevs, b)
+	b.open(c.user())
+	vhostUserPublish(s.socketPath(c), c.export())
+	return num, nil
+}
+
+func (s *Server) vhostScsiControllerRemoveTarget(params json.RawMessage) (interface{}, error) {
+	var args spdk.VhostScsiControllerRemoveTargetArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c, err := s.lookupVhostScsiController(args.Ctrlr)
+	if err != nil {
+		return nil, err
+	}
+	if args.ScsiTargetNum < 0 || args.ScsiTargetNum >= vhostScsiMaxTargets || c.scsiTargets[args.ScsiTargetNum] == nil {
+		return nil, errnoError(spdk.ErrInvalid, "target %d of vhost-scsi controller %s", args.ScsiTargetNum, c.name)
+	}
+	// Unlike SPDK, the fake does not hot-remove targets from
+	// connected virtio controllers.
+	if err := vhostUserConnected(s.socketPath(c)); err != nil {
+		return nil, err
+	}
+
+	b := c.scsiTargets[args.ScsiTargetNum]
+	c.scsiTargets[args.ScsiTargetNum] = nil
+	for i := range c.bdevs {
+		if c.bdevs[i] == b {
+			c.bdevs = append(c.bdevs[:i], c.bdevs[i+1:]...)
+			break
+		}
+	}
+	// The same bdev may back several targets.
+	if !containsBdev(c.bdevs, b) {
+		b.close(c.user())
+	}
+	vhostUserPublish(s.socketPath(c), c.export())
+	return true, nil
+}
+
+func containsBdev(bdevs []*bdev, b *bdev) bool {
+	for _, other := range bdevs {
+		if other == b {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) vhostControllerSetCoalescing(params json.RawMessage) (interface{}, error) {
+	var args spdk.VhostControllerSetCoalescingArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c, err := s.lookupVhostController(args.Ctrlr)
+	if err != nil {
+		return nil, err
+	}
+	if args.DelayBaseUs < 0 || args.IopsThreshold < 0 {
+		return nil, invalidParams("delay_base_us and iops_threshold must not be negative")
+	}
+	c.delayBaseUs = args.DelayBaseUs
+	c.iopsThreshold = args.IopsThreshold
+	return true, nil
+}
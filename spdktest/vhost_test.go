@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVhost(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 4096})
+
+	_, err := spdk.VhostCreateBlkController(ctx, client,
+		spdk.VhostCreateBlkControllerArgs{DevName: "Malloc0", Ctrlr: "vhostblk0", PackedRing: true})
+	assert.NoError(t, err, "Failed to create vhost-blk: %s", err)
+
+	controllers, err := spdk.VhostGetControllers(ctx, client, spdk.VhostGetControllersArgs{Name: "vhostblk0"})
+	assert.NoError(t, err, "Failed to list vhost: %s", err)
+	if assert.Len(t, controllers, 1) {
+		assert.Equal(t, "vhostblk0", controllers[0].Ctrlr)
+		assert.Equal(t, spdk.VhostBlkBackendSpecific{
+			Bdev:       "Malloc0",
+			Transport:  "vhost_user_blk",
+			PackedRing: true,
+		}, controllers[0].Backend)
+	}
+
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+
+	_, err = spdk.VhostDeleteController(ctx, client, spdk.VhostDeleteControllerArgs{Ctrlr: "vhostblk0"})
+	assert.NoError(t, err, "Failed to delete vhost: %s", err)
+
+	_, err = spdk.VhostGetControllers(ctx, client, spdk.VhostGetControllersArgs{Name: "vhostblk0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+}
+
+func TestVhostScsi(t *testing.T) {
+	ctx := context.Background()
+	_, client := connect(t)
+
+	for i := 0; i < 2; i++ {
+		createMalloc(t, client, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: 512})
+	}
+	_, err := spdk.VhostCreateScsiController(ctx, client, spdk.VhostCreateScsiControllerArgs{Ctrlr: "vhostscsi0", Cpumask: "0x2"})
+	assert.NoError(t, err, "Failed to create vhost-scsi: %s", err)
+
+	num, err := spdk.VhostScsiControllerAddTarget(ctx, client,
+		spdk.VhostScsiControllerAddTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: 3, BdevName: "Malloc0"})
+	assert.NoError(t, err, "Failed to add target: %s", err)
+	assert.Equal(t, 3, num)
+	num, err = spdk.VhostScsiControllerAddTarget(ctx, client,
+		spdk.VhostScsiControllerAddTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: -1, BdevName: "Malloc1"})
+	assert.NoError(t, err, "Failed to add target: %s", err)
+	assert.Equal(t, 0, num)
+	_, err = spdk.VhostScsiControllerAddTarget(ctx, client,
+		spdk.VhostScsiControllerAddTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: 3, BdevName: "Malloc1"})
+	assert.ErrorIs(t, err, spdk.ErrExist)
+
+	_, err = spdk.VhostControllerSetCoalescing(ctx, client,
+		spdk.VhostControllerSetCoalescingArgs{Ctrlr: "vhostscsi0", DelayBaseUs: 80, IopsThreshold: 100000})
+	assert.NoError(t, err, "Failed to set coalescing: %s", err)
+
+	controllers, err := spdk.VhostGetControllers(ctx, client, spdk.VhostGetControllersArgs{Name: "vhostscsi0"})
+	assert.NoError(t, err, "Failed to list vhost: %s", err)
+	if assert.Len(t, controllers, 1) {
+		assert.Equal(t, "0x2", controllers[0].Cpumask)
+		assert.Equal(t, 80, controllers[0].DelayBaseUs)
+		assert.Equal(t, 100000, controllers[0].IposThreshold)
+		assert.Equal(t, spdk.VhostScsiBackendSpecific{
+			{TargetName: "Target 0", ID: 0, ScsiDevNum: 0, Luns: []spdk.VhostScsiLun{{ID: 0, BdevName: "Malloc1"}}},
+			{TargetName: "Target 3", ID: 3, ScsiDevNum: 3, Luns: []spdk.VhostScsiLun{{ID: 0, BdevName: "Malloc0"}}},
+		}, controllers[0].Backend)
+	}
+
+	// A controller with targets cannot be deleted.
+	_, err = spdk.VhostDeleteController(ctx, client, spdk.VhostDeleteControllerArgs{Ctrlr: "vhostscsi0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	for _, num := range []int{0, 3} {
+		_, err = spdk.VhostScsiControllerRemoveTarget(ctx, client,
+			spdk.VhostScsiControllerRemoveTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: num})
+		assert.NoError(t, err, "Failed to remove target %d: %s", num, err)
+	}
+	_, err = spdk.VhostDeleteController(ctx, client, spdk.VhostDeleteControllerArgs{Ctrlr: "vhostscsi0"})
+	assert.NoError(t, err, "Failed to delete vhost: %s", err)
+	_, err = spdk.BdevMallocDelete(ctx, client, spdk.BdevMallocDeleteArgs{Name: "Malloc0"})
+	assert.NoError(t, err, "Failed to delete malloc bdev: %s", err)
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+)
+
+// vhostUser connects the vhost controllers and virtio initiators of
+// all Servers in the process like vhost-user sockets. Like fabric, it
+// has its own lock, which is taken while holding the lock of a Server,
+// never the other way round.
+var vhostUser = struct {
+	mutex   sync.Mutex
+	sockets map[string]*vhostSocket
+}{
+	sockets: make(map[string]*vhostSocket),
+}
+
+type vhostSocket struct {
+	path   string
+	server *Server
+	export *vhostExport
+	// hosts are the virtio controllers connected to the socket.
+	hosts []vhostUserHost
+}
+
+type vhostUserHost struct {
+	server *Server
+	name   string
+}
+
+// vhostExport is what a vhost controller exposes. It is never
+// modified, the controller publishes a new one when it changes.
+type vhostExport struct {
+	// devType is spdk.VirtioDevTypeBlk or spdk.VirtioDevTypeScsi.
+	devType string
+	// disks maps target numbers to their disks,
+	// a vhost-blk controller has target 0 only.
+	disks map[int]vhostDisk
+}
+
+type vhostDisk struct {
+	blockSize int64
+	numBlocks int64
+}
+
+// vhostUserListen exports a vhost controller of s at path.
+func vhostUserListen(s *Server, path string, export *vhostExport) {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	vhostUser.sockets[path] = &vhostSocket{path: path, server: s, export: export}
+}
+
+// vhostUserPublish replaces the exported state at path. Connected
+// virtio controllers keep what they saw when they attached.
+func vhostUserPublish(path string, export *vhostExport) {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	if socket := vhostUser.sockets[path]; socket != nil {
+		socket.export = export
+	}
+}
+
+// vhostUserConnected returns an error while a virtio controller
+// is connected to path.
+func vhostUserConnected(path string) error {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	return vhostUser.sockets[path].busy()
+}
+
+func (socket *vhostSocket) busy() error {
+	if socket == nil || len(socket.hosts) == 0 {
+		return nil
+	}
+	return errnoError(spdk.ErrBusy, "vhost socket %s has still valid connection", socket.path)
+}
+
+// vhostUserUnlisten removes the socket at path unless a virtio
+// controller is connected.
+func vhostUserUnlisten(path string) error {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	if err := vhostUser.sockets[path].busy(); err != nil {
+		return err
+	}
+	delete(vhostUser.sockets, path)
+	return nil
+}
+
+// vhostUserConnect connects the virtio controller host to path
+// and returns what is exported there.
+func vhostUserConnect(host vhostUserHost, path string) (*vhostExport, error) {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	socket := vhostUser.sockets[path]
+	if socket == nil {
+		return nil, errnoError(spdk.ErrNoEntry, "connect to vhost socket %s", path)
+	}
+	socket.hosts = append(socket.hosts, host)
+	return socket.export, nil
+}
+
+// vhostUserDisconnect removes the virtio controller host from path.
+func vhostUserDisconnect(host vhostUserHost, path string) {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	socket := vhostUser.sockets[path]
+	if socket == nil {
+		return
+	}
+	for i := range socket.hosts {
+		if socket.hosts[i] == host {
+			socket.hosts = append(socket.hosts[:i], socket.hosts[i+1:]...)
+			return
+		}
+	}
+}
+
+// vhostUserClose removes all sockets of s and disconnects
+// the virtio controllers of s.
+func vhostUserClose(s *Server) {
+	vhostUser.mutex.Lock()
+	defer vhostUser.mutex.Unlock()
+
+	for path, socket := range vhostUser.sockets {
+		if socket.server == s {
+			delete(vhostUser.sockets, path)
+			continue
+		}
+		hosts := []vhostUserHost{}
+		for _, host := range socket.hosts {
+			if host.server != s {
+				hosts = append(hosts, host)
+			}
+		}
+		socket.hosts = hosts
+	}
+}
+
+// virtioController is a virtio initiator attached by
+// bdev_virtio_attach_controller.
+type virtioController struct {
+	name    string
+	devType string
+	device  spdk.VirtioDevice
+	bdevs   []*bdev
+}
+
+func (c *virtioController) host(s *Server) vhostUserHost {
+	return vhostUserHost{server: s, name: c.name}
+}
+
+func (s *Server) findVirtioController(name string) *virtioController {
+	for _, c := range s.virtioControllers {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) registerVirtioMethods() {
+	s.methods["bdev_virtio_attach_controller"] = s.bdevVirtioAttachController
+	s.methods["bdev_virtio_detach_controller"] = s.bdevVirtioDetachController
+	s.methods["bdev_virtio_scsi_get_devices"] = s.bdevVirtioScsiGetDevices
+	s.methods["bdev_virtio_blk_set_hotplug"] = s.bdevVirtioBlkSetHotplug
+}
+
+const (
+	virtioBlkProductName  = "VirtioBlk Disk"
+	virtioScsiProductName = "Virtio SCSI Disk"
+)
+
+func (s *Server) bdevVirtioAttachController(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevVirtioAttachControllerArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" || args.Trtype == "" || args.Traddr == "" || args.DevType == "" {
+		return nil, invalidParams("name, trtype, traddr and dev_type are required")
+	}
+	if args.DevType != spdk.VirtioDevTypeBlk && args.DevType != spdk.VirtioDevTypeScsi {
+		return nil, invalidParams("Invalid dev_type " + args.DevType)
+	}
+	switch args.Trtype {
+	case spdk.VirtioTransportUser:
+	case spdk.VirtioTransportPCI:
+		return nil, errnoError(spdk.ErrNoDevice, "no virtio device at %s", args.Traddr)
+	default:
+		return nil, invalidParams("Invalid trtype " + args.Trtype)
+	}
+	if s.findVirtioController(args.Name) != nil {
+		return nil, errnoError(spdk.ErrExist, "virtio controller %s already exists", args.Name)
+	}
+
+	c := &virtioController{
+		name:    args.Name,
+		devType: args.DevType,
+		device: spdk.VirtioDevice{
+			VqCount: args.VqCount,
+			VqSize:  args.VqSize,
+			Type:    args.Trtype,
+			Socket:  args.Traddr,
+		},
+	}
+	if c.device.VqCount == 0 {
+		c.device.VqCount = 1
+	}
+	if c.device.VqSize == 0 {
+		c.device.VqSize = 512
+	}
+	export, err := vhostUserConnect(c.host(s), args.Traddr)
+	if err != nil {
+		return nil, err
+	}
+	if export.devType != args.DevType {
+		vhostUserDisconnect(c.host(s), args.Traddr)
+		return nil, errnoError(spdk.ErrInvalid, "vhost socket %s is not a vhost-%s controller", args.Traddr, args.DevType)
+	}
+
+	for num := 0; num < vhostScsiMaxTargets; num++ {
+		disk, ok := export.disks[num]
+		if !ok {
+			continue
+		}
+		b := &bdev{
+			name:        c.name,
+			productName: virtioBlkProductName,
+			blockSize:   disk.blockSize,
+			numBlocks:   disk.numBlocks,
+			driverSpecific: func() map[string]interface{} {
+				return map[string]interface{}{"virtio": c.device}
+			},
+		}
+		if c.devType == spdk.VirtioDevTypeScsi {
+			b.name = fmt.Sprintf("%st%d", c.name, num)
+			b.productName = virtioScsiProductName
+		}
+		if err := s.addBdev(b); err != nil {
+			for _, b := range c.bdevs {
+				s.removeBdev(b)
+			}
+			vhostUserDisconnect(c.host(s), args.Traddr)
+			return nil, err
+		}
+		c.bdevs = append(c.bdevs, b)
+	}
+	s.virtioControllers = append(s.virtioControllers, c)
+
+	names := []string{}
+	for _, b := range c.bdevs {
+		names = append(names, b.name)
+	}
+	return names, nil
+}
+
+func (s *Server) bdevVirtioDetachController(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevVirtioDetachControllerArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	c := s.findVirtioController(args.Name)
+	if c == nil {
+		return nil, errnoError(spdk.ErrNoDevice, "virtio controller %s not found", args.Name)
+	}
+	for _, b := range c.bdevs {
+		if err := b.inUse(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range c.bdevs {
+		s.removeBdev(b)
+	}
+	vhostUserDisconnect(c.host(s), c.device.Socket)
+	for i := range s.virtioControllers {
+		if s.virtioControllers[i] == c {
+			s.virtioControllers = append(s.virtioControllers[:i], s.virtioControllers[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) bdevVirtioScsiGetDevices(params json.RawMessage) (interface{}, error) {
+	result := []spdk.VirtioScsiDevice{}
+	for _, c := range s.virtioControllers {
+		if c.devType == spdk.VirtioDevTypeScsi {
+			result = append(result, spdk.VirtioScsiDevice{Name: c.name, Virtio: c.device})
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) bdevVirtioBlkSetHotplug(params json.RawMessage) (interface{}, error) {
+	var args spdk.BdevVirtioBlkSetHotplugArgs
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.PeriodUs < 0 {
+		return nil, invalidParams("period_us must not be negative")
+	}
+	return true, nil
+}
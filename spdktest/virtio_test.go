@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Intel Corporation.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package spdktest_test
+
+import (
+	"context"
+	"testing"
+
+	spdk "github.com/dong-liuliu/spdkctrl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtio(t *testing.T) {
+	ctx := context.Background()
+	_, targetClient := connect(t)
+	_, client := connect(t)
+
+	for _, blockSize := range []int64{4096, 512} {
+		createMalloc(t, targetClient, spdk.BdevMallocCreateArgs{NumBlocks: 1024, BlockSize: blockSize})
+	}
+	_, err := spdk.VhostCreateBlkController(ctx, targetClient,
+		spdk.VhostCreateBlkControllerArgs{DevName: "Malloc0", Ctrlr: "vhostblk0"})
+	assert.NoError(t, err, "Failed to create vhost-blk: %s", err)
+	_, err = spdk.VhostCreateScsiController(ctx, targetClient, spdk.VhostCreateScsiControllerArgs{Ctrlr: "vhostscsi0"})
+	assert.NoError(t, err, "Failed to create vhost-scsi: %s", err)
+	_, err = spdk.VhostScsiControllerAddTarget(ctx, targetClient,
+		spdk.VhostScsiControllerAddTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: 2, BdevName: "Malloc1"})
+	assert.NoError(t, err, "Failed to add target: %s", err)
+
+	controllers, err := spdk.VhostGetControllers(ctx, targetClient, spdk.VhostGetControllersArgs{})
+	assert.NoError(t, err, "Failed to list vhost: %s", err)
+	if !assert.Len(t, controllers, 2) {
+		return
+	}
+	blkSocket, scsiSocket := controllers[0].Socket, controllers[1].Socket
+
+	names, err := spdk.BdevVirtioAttachController(ctx, client, spdk.BdevVirtioAttachControllerArgs{
+		Name:    "VirtioBlk0",
+		Trtype:  spdk.VirtioTransportUser,
+		Traddr:  blkSocket,
+		DevType: spdk.VirtioDevTypeBlk,
+	})
+	assert.NoError(t, err, "Failed to attach virtio-blk: %s", err)
+	assert.Equal(t, []string{"VirtioBlk0"}, names)
+	names, err = spdk.BdevVirtioAttachController(ctx, client, spdk.BdevVirtioAttachControllerArgs{
+		Name:    "VirtioScsi0",
+		Trtype:  spdk.VirtioTransportUser,
+		Traddr:  scsiSocket,
+		DevType: spdk.VirtioDevTypeScsi,
+		VqCount: 2,
+	})
+	assert.NoError(t, err, "Failed to attach virtio-scsi: %s", err)
+	assert.Equal(t, []string{"VirtioScsi0t2"}, names)
+
+	_, err = spdk.BdevVirtioAttachController(ctx, client, spdk.BdevVirtioAttachControllerArgs{
+		Name: "VirtioScsi1", Trtype: spdk.VirtioTransportUser, Traddr: blkSocket, DevType: spdk.VirtioDevTypeScsi})
+	assert.ErrorIs(t, err, spdk.ErrInvalid)
+	_, err = spdk.BdevVirtioAttachController(ctx, client, spdk.BdevVirtioAttachControllerArgs{
+		Name: "VirtioBlk1", Trtype: spdk.VirtioTransportUser, Traddr: blkSocket + ".missing", DevType: spdk.VirtioDevTypeBlk})
+	assert.ErrorIs(t, err, spdk.ErrNoEntry)
+	_, err = spdk.BdevVirtioAttachController(ctx, client, spdk.BdevVirtioAttachControllerArgs{
+		Name: "VirtioBlk1", Trtype: spdk.VirtioTransportPCI, Traddr: "0000:00:04.0", DevType: spdk.VirtioDevTypeBlk})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+
+	bdevs, err := spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{Name: "VirtioScsi0t2"})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	if assert.Len(t, bdevs, 1) {
+		assert.Equal(t, int64(512), bdevs[0].BlockSize)
+		assert.Equal(t, int64(1024), bdevs[0].NumBlocks)
+	}
+	devices, err := spdk.BdevVirtioScsiGetDevices(ctx, client)
+	assert.NoError(t, err, "Failed to list virtio-scsi devices: %s", err)
+	assert.Equal(t, spdk.BdevVirtioScsiGetDevicesResponse{{
+		Name:   "VirtioScsi0",
+		Virtio: spdk.VirtioDevice{VqCount: 2, VqSize: 512, Type: spdk.VirtioTransportUser, Socket: scsiSocket},
+	}}, devices)
+
+	_, err = spdk.BdevVirtioBlkSetHotplug(ctx, client, spdk.BdevVirtioBlkSetHotplugArgs{Enable: true, PeriodUs: 100000})
+	assert.NoError(t, err, "Failed to set hotplug: %s", err)
+
+	// Connected vhost controllers cannot be deleted.
+	_, err = spdk.VhostDeleteController(ctx, targetClient, spdk.VhostDeleteControllerArgs{Ctrlr: "vhostblk0"})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+	_, err = spdk.VhostScsiControllerRemoveTarget(ctx, targetClient,
+		spdk.VhostScsiControllerRemoveTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: 2})
+	assert.ErrorIs(t, err, spdk.ErrBusy)
+
+	for _, name := range []string{"VirtioBlk0", "VirtioScsi0"} {
+		_, err = spdk.BdevVirtioDetachController(ctx, client, spdk.BdevVirtioDetachControllerArgs{Name: name})
+		assert.NoError(t, err, "Failed to detach %s: %s", name, err)
+	}
+	_, err = spdk.BdevVirtioDetachController(ctx, client, spdk.BdevVirtioDetachControllerArgs{Name: "VirtioBlk0"})
+	assert.ErrorIs(t, err, spdk.ErrNoDevice)
+	bdevs, err = spdk.BdevGetBdevs(ctx, client, spdk.BdevGetBdevsArgs{})
+	assert.NoError(t, err, "Failed to list bdevs: %s", err)
+	assert.Empty(t, bdevs)
+
+	_, err = spdk.VhostDeleteController(ctx, targetClient, spdk.VhostDeleteControllerArgs{Ctrlr: "vhostblk0"})
+	assert.NoError(t, err, "Failed to delete vhost: %s", err)
+	_, err = spdk.VhostScsiControllerRemoveTarget(ctx, targetClient,
+		spdk.VhostScsiControllerRemoveTargetArgs{Ctrlr: "vhostscsi0", ScsiTargetNum: 2})
+	assert.NoError(t, err, "Failed to remove target: %s", err)
+}